@@ -0,0 +1,310 @@
+package access
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+)
+
+// Linux socket option to read supplementary groups of a peer as of connect time, not exposed by 'syscall' package
+const soPeerGroups = 59
+
+// Credentials of a process on the other end of a UNIX socket connection as reported by the kernel upon connect
+type Credentials struct {
+	Pid        int32
+	Uid        uint32
+	Gid        uint32
+	Groups     []uint32 // supplementary groups
+	Executable string   // path of the executable from /proc, empty if the process is gone or now runs as another uid
+}
+
+// Rule allows callers matching it to call methods matching any of its paths. A caller matches a rule if its uid or
+// any of its groups is listed and, if executables are listed, its executable is among them. Executables only narrow
+// uids and gids down as a process can be replaced by another one with the same pid before its executable is read,
+// so a rule has to either list uids or gids or explicitly allow everyone.
+type Rule struct {
+	Uids        []uint32
+	Gids        []uint32
+	Executables []string // absolute paths, e.g. '/usr/bin/dockerd'
+	AllowAll    bool     // matches any caller, cannot be combined with uids, gids and executables
+	Paths       []string // glob patterns for request paths, e.g. '/VolumeDriver.*' or '/v1/volumes/*/reset'
+}
+
+// Validate checks that every rule identifies callers by uids or gids or explicitly allows everyone, that executables
+// are absolute paths and that rule allows at least one path given as a valid glob pattern
+func Validate(rules []Rule) error {
+	for idx, rule := range rules {
+		identified := len(rule.Uids) > 0 || len(rule.Gids) > 0
+		if rule.AllowAll && (identified || len(rule.Executables) > 0) {
+			return errors.Errorf("rule #%d allows all callers and cannot list uids, gids or executables", idx+1)
+		}
+		if !rule.AllowAll && !identified {
+			return errors.Errorf("rule #%d has to list uids or gids or explicitly allow all callers", idx+1)
+		}
+		for _, executable := range rule.Executables {
+			if !filepath.IsAbs(executable) {
+				return errors.Errorf("executable '%s' of rule #%d is not an absolute path", executable, idx+1)
+			}
+		}
+		if len(rule.Paths) == 0 {
+			return errors.Errorf("rule #%d does not allow any paths", idx+1)
+		}
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(pattern, ""); err != nil || !strings.HasPrefix(pattern, "/") {
+				return errors.Errorf("path '%s' of rule #%d is not a valid glob pattern of an absolute path", pattern, idx+1)
+			}
+		}
+	}
+	return nil
+}
+
+// Listener reads credentials of every accepted UNIX socket connection so that handlers can authorize requests
+type Listener struct {
+	net.Listener
+}
+
+func (l Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, nil
+	}
+	credentials, err := peerCredentials(unixConn)
+	return &credentialsConn{Conn: conn, credentials: credentials, err: err}, nil
+}
+
+// credentialsConn passes credentials to handlers via local address that http.Server puts into request context
+type credentialsConn struct {
+	net.Conn
+	credentials Credentials
+	err         error
+}
+
+func (c *credentialsConn) LocalAddr() net.Addr {
+	return credentialsAddr{Addr: c.Conn.LocalAddr(), conn: c}
+}
+
+type credentialsAddr struct {
+	net.Addr
+	conn *credentialsConn
+}
+
+// FromRequest returns credentials of the caller that sent a request over a connection accepted by Listener
+func FromRequest(r *http.Request) (credentials Credentials, err error) {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(credentialsAddr)
+	if !ok {
+		err = errors.New("caller credentials are not known")
+		return
+	}
+	return addr.conn.credentials, addr.conn.err
+}
+
+func peerCredentials(conn *net.UnixConn) (credentials Credentials, err error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		err = errors.Wrap(err, "cannot access socket")
+		return
+	}
+
+	var ucred *syscall.Ucred
+	var groups []uint32
+	var errSockopt, errGroups error
+	err = raw.Control(func(fd uintptr) {
+		ucred, errSockopt = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+		groups, errGroups = peerGroups(int(fd))
+	})
+	if err == nil {
+		err = errSockopt
+	}
+	if err != nil {
+		err = errors.Wrap(err, "cannot read peer credentials")
+		return
+	}
+
+	credentials = Credentials{Pid: ucred.Pid, Uid: ucred.Uid, Gid: ucred.Gid, Groups: groups}
+	executable, status := processInfo(ucred.Pid, ucred.Uid)
+	if errGroups == syscall.ENOPROTOOPT {
+		// kernels before 4.13 do not report groups, they can only be read from /proc
+		credentials.Groups = statusIds(status, "Groups:")
+	} else if errGroups != nil {
+		err = errors.Wrap(errGroups, "cannot read peer groups")
+		return
+	}
+	credentials.Executable = executable
+	return
+}
+
+// peerGroups reads supplementary groups of a peer as of connect time
+func peerGroups(fd int) (groups []uint32, err error) {
+	buffer := make([]uint32, 64)
+	for {
+		size := uint32(len(buffer) * 4)
+		_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, uintptr(fd), syscall.SOL_SOCKET, soPeerGroups,
+			uintptr(unsafe.Pointer(&buffer[0])), uintptr(unsafe.Pointer(&size)), 0)
+		if errno == syscall.ERANGE && int(size/4) > len(buffer) {
+			buffer = make([]uint32, size/4)
+			continue
+		}
+		if errno != 0 {
+			return nil, errno
+		}
+		return buffer[:size/4], nil
+	}
+}
+
+// processInfo reads executable path and '/proc/<pid>/status' of a process unless it runs as another uid than the
+// peer, i.e. unless the peer is gone and its pid has been reused by a process of another user
+func processInfo(pid int32, uid uint32) (executable string, status string) {
+	executable, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return "", ""
+	}
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return "", ""
+	}
+	status = string(data)
+
+	// real, effective, saved and filesystem uids
+	for _, id := range statusIds(status, "Uid:") {
+		if id != uid {
+			return "", ""
+		}
+	}
+	return strings.TrimSuffix(executable, " (deleted)"), status
+}
+
+// statusIds parses a line of ids such as 'Groups:' from contents of '/proc/<pid>/status'
+func statusIds(status string, prefix string) (ids []uint32) {
+	scanner := bufio.NewScanner(strings.NewReader(status))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		for _, field := range strings.Fields(strings.TrimPrefix(line, prefix)) {
+			if id, errParse := strconv.ParseUint(field, 10, 32); errParse == nil {
+				ids = append(ids, uint32(id))
+			}
+		}
+		break
+	}
+	return
+}
+
+func (r Rule) matchesCaller(credentials Credentials) bool {
+	if r.AllowAll {
+		return true
+	}
+	if len(r.Executables) > 0 && !containsString(r.Executables, credentials.Executable) {
+		return false
+	}
+	if containsId(r.Uids, credentials.Uid) || containsId(r.Gids, credentials.Gid) {
+		return true
+	}
+	for _, gid := range credentials.Groups {
+		if containsId(r.Gids, gid) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) matchesPath(requestPath string) bool {
+	for _, pattern := range r.Paths {
+		if matched, _ := path.Match(pattern, requestPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed tells whether any of the rules lets a caller call a path
+func Allowed(rules []Rule, credentials Credentials, requestPath string) bool {
+	for _, rule := range rules {
+		if rule.matchesPath(requestPath) && rule.matchesCaller(credentials) {
+			return true
+		}
+	}
+	return false
+}
+
+// DenyFunc writes a response to a denied request in the format of the API being guarded
+type DenyFunc func(w http.ResponseWriter, err error)
+
+// Guard only passes requests allowed by rules to the handler, every request is passed if there are no rules.
+// Denied requests are logged along with caller credentials and their trace is included into the error.
+func Guard(socket string, rules []Rule, deny DenyFunc, handler http.Handler) http.Handler {
+	if len(rules) == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credentials, err := FromRequest(r)
+		if err == nil && Allowed(rules, credentials, r.URL.Path) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.New().
+			Field(":func", "access/Guard").
+			Field("socket", socket).
+			Field("method", r.Method).
+			Field("path", r.URL.Path)
+
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("denied call from unknown caller")
+			deny(w, errors.Wrap(errors.Wrap(err, "call is denied"), ctx.Trace))
+			return
+		}
+
+		ctx.
+			Level(context.Warning).
+			Field("pid", credentials.Pid).
+			Field("uid", credentials.Uid).
+			Field("gid", credentials.Gid).
+			Field("groups", credentials.Groups).
+			Field("executable", credentials.Executable).
+			Message("denied call")
+		deny(w, errors.Wrap(
+			errors.Errorf("caller with uid %d and gid %d is not allowed to call '%s'",
+				credentials.Uid, credentials.Gid, r.URL.Path),
+			ctx.Trace))
+	})
+}
+
+func containsId(ids []uint32, id uint32) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/ashald/docker-volume-loopback/manager"
+	"github.com/pkg/errors"
+)
+
+// Error codes are part of the API and must not change once released
+const (
+	CodeBadRequest           = "bad-request"
+	CodeNotFound             = "not-found"
+	CodeMethodNotAllowed     = "method-not-allowed"
+	CodeForbidden            = "forbidden"
+	CodeProtected            = "protected"
+	CodeInUse                = "in-use"
+	CodeExists               = "exists"
+	CodeInsufficientCapacity = "insufficient-capacity"
+	CodeInternal             = "internal"
+)
+
+var codes = map[error]string{
+	manager.ErrNotFound:  CodeNotFound,
+	manager.ErrProtected: CodeProtected,
+	manager.ErrInUse:     CodeInUse,
+	manager.ErrExists:    CodeExists,
+	manager.ErrCapacity:  CodeInsufficientCapacity,
+	manager.ErrInvalid:   CodeBadRequest,
+}
+
+var statuses = map[string]int{
+	CodeBadRequest:           http.StatusBadRequest,
+	CodeNotFound:             http.StatusNotFound,
+	CodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	CodeForbidden:            http.StatusForbidden,
+	CodeProtected:            http.StatusConflict,
+	CodeInUse:                http.StatusConflict,
+	CodeExists:               http.StatusConflict,
+	CodeInsufficientCapacity: http.StatusInsufficientStorage,
+	CodeInternal:             http.StatusInternalServerError,
+}
+
+type Volume struct {
+	Name       string                 `json:"name"`
+	CreatedAt  string                 `json:"created-at,omitempty"`
+	Mountpoint string                 `json:"mountpoint,omitempty"`
+	Status     map[string]interface{} `json:"status,omitempty"`
+}
+
+type ListResponse struct {
+	Volumes []Volume `json:"volumes"`
+}
+
+type GetResponse struct {
+	Volume Volume `json:"volume"`
+}
+
+type ResizeRequest struct {
+	Size string `json:"size"`
+}
+
+type SnapshotRequest struct {
+	Name string `json:"name"`
+}
+
+type RenameRequest struct {
+	Name string `json:"name"`
+}
+
+// MoveRequest either fails for a volume in use or, with OnUnmount set, schedules the move until it's un-mounted
+type MoveRequest struct {
+	Pool      string `json:"pool"`
+	OnUnmount bool   `json:"on-unmount,omitempty"`
+}
+
+type ProtectRequest struct {
+	Protected bool `json:"protected"`
+}
+
+// ConvertRequest changes one property per request
+type ConvertRequest struct {
+	Sparse *bool  `json:"sparse,omitempty"`
+	Fs     string `json:"fs,omitempty"`
+}
+
+// Tenant describes quota usage of a tenant, limits are omitted when there are none
+type Tenant struct {
+	Name         string `json:"name"`
+	Volumes      int    `json:"volumes"`
+	Size         int64  `json:"size"`
+	Allocated    int64  `json:"allocated"`
+	MaxVolumes   int    `json:"max-volumes,omitempty"`
+	MaxSize      int64  `json:"max-size,omitempty"`
+	MaxAllocated int64  `json:"max-allocated,omitempty"`
+}
+
+type TenantsResponse struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+type TenantResponse struct {
+	Tenant Tenant `json:"tenant"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Code maps an error returned by the driver to a stable error code
+func Code(err error) string {
+	if code, ok := codes[errors.Cause(err)]; ok {
+		return code
+	}
+	return CodeInternal
+}
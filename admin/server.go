@@ -0,0 +1,318 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ashald/docker-volume-loopback/access"
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/ashald/docker-volume-loopback/driver"
+	"github.com/docker/go-connections/sockets"
+	v "github.com/docker/go-plugins-helpers/volume"
+	"github.com/pkg/errors"
+)
+
+// Prefixes of API paths so that incompatible changes can be introduced under new ones
+const (
+	PathPrefix        = "/v1/volumes"
+	TenantsPathPrefix = "/v1/tenants"
+)
+
+// Server exposes driver operations that are not part of Docker volume plugin protocol over HTTP
+type Server struct {
+	driver *driver.Driver
+	rules  []access.Rule
+}
+
+// New creates a server that only lets callers allowed by rules through, everyone is allowed if there are no rules
+func New(d *driver.Driver, rules []access.Rule) *Server {
+	return &Server{driver: d, rules: rules}
+}
+
+// ListenUnix listens on a UNIX socket replacing a stale one if any, the socket is owned by root and the group and is
+// only accessible as the mode allows - it's not accessible at all until then
+func ListenUnix(socket string, gid int, mode os.FileMode) (listener net.Listener, err error) {
+	listener, err = sockets.NewUnixSocket(socket, gid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot listen on '%s'", socket)
+	}
+	err = os.Chmod(socket, mode)
+	if err != nil {
+		_ = listener.Close()
+		return nil, errors.Wrapf(err, "cannot change mode of socket '%s' to %#o", socket, mode)
+	}
+	return
+}
+
+// Serve serves API requests accepted by a listener with an HTTP server until either fails or the HTTP server is shut down
+func (s *Server) Serve(server *http.Server, listener net.Listener) error {
+	server.Handler = access.Guard(listener.Addr().String(), s.rules, forbidden, s)
+	return server.Serve(access.Listener{Listener: listener})
+}
+
+func forbidden(w http.ResponseWriter, err error) {
+	writeError(w, CodeForbidden, err)
+}
+
+// ServeHTTP routes requests:
+//
+//	GET  /v1/volumes
+//	GET  /v1/volumes/{name}
+//	GET  /v1/volumes/{name}/export
+//	POST /v1/volumes/{name}/{resize|snapshot|rename|move|protect|reset|convert|force-unmount|cancel-erase}
+//	GET  /v1/tenants
+//	GET  /v1/tenants/{name}
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := context.New().
+		Field(":func", "admin/ServeHTTP").
+		Field("method", r.Method).
+		Field("path", r.URL.Path)
+
+	ctx.
+		Level(context.Debug).
+		Message("invoked")
+
+	if strings.HasPrefix(r.URL.Path, TenantsPathPrefix) {
+		name := strings.Trim(strings.TrimPrefix(r.URL.Path, TenantsPathPrefix), "/")
+		s.handle(w, r, http.MethodGet, func(r *http.Request) (interface{}, error) { return s.tenants(name) })
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, PathPrefix) {
+		writeError(w, CodeNotFound, errors.Errorf("unknown path '%s'", r.URL.Path))
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+
+	var name, action string
+	if path != "" {
+		parts := strings.SplitN(path, "/", 2)
+		name = parts[0]
+		if len(parts) > 1 {
+			action = parts[1]
+		}
+	}
+
+	switch {
+	case name == "":
+		s.handle(w, r, http.MethodGet, s.list)
+	case action == "":
+		s.handle(w, r, http.MethodGet, func(r *http.Request) (interface{}, error) { return s.get(name) })
+	case action == "export":
+		if r.Method != http.MethodGet {
+			writeError(w, CodeMethodNotAllowed, errors.Errorf("method '%s' is not allowed", r.Method))
+			return
+		}
+		s.export(w, name)
+	default:
+		operation, known := s.operations(name)[action]
+		if !known {
+			writeError(w, CodeNotFound, errors.Errorf("unknown operation '%s'", action))
+			return
+		}
+		s.handle(w, r, http.MethodPost, operation)
+	}
+}
+
+type handlerFunc func(r *http.Request) (interface{}, error)
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request, method string, handler handlerFunc) {
+	if r.Method != method {
+		writeError(w, CodeMethodNotAllowed, errors.Errorf("method '%s' is not allowed", r.Method))
+		return
+	}
+
+	response, err := handler(r)
+	if err != nil {
+		code := Code(err)
+		if _, isBadRequest := err.(badRequest); isBadRequest {
+			code = CodeBadRequest
+		}
+		if _, isNotFound := err.(notFound); isNotFound {
+			code = CodeNotFound
+		}
+		writeError(w, code, err)
+		return
+	}
+
+	if response == nil {
+		response = struct{}{}
+	}
+	writeJson(w, http.StatusOK, response)
+}
+
+func (s *Server) operations(name string) map[string]handlerFunc {
+	return map[string]handlerFunc{
+		"resize": func(r *http.Request) (interface{}, error) {
+			var request ResizeRequest
+			if err := decode(r, &request); err != nil {
+				return nil, err
+			}
+			return s.get(name, s.driver.Resize(name, request.Size))
+		},
+		"snapshot": func(r *http.Request) (interface{}, error) {
+			var request SnapshotRequest
+			if err := decode(r, &request); err != nil {
+				return nil, err
+			}
+			return s.get(request.Name, s.driver.Snapshot(name, request.Name))
+		},
+		"rename": func(r *http.Request) (interface{}, error) {
+			var request RenameRequest
+			if err := decode(r, &request); err != nil {
+				return nil, err
+			}
+			return s.get(request.Name, s.driver.Rename(name, request.Name))
+		},
+		"move": func(r *http.Request) (interface{}, error) {
+			var request MoveRequest
+			if err := decode(r, &request); err != nil {
+				return nil, err
+			}
+			return s.get(name, s.driver.Move(name, request.Pool, request.OnUnmount))
+		},
+		"protect": func(r *http.Request) (interface{}, error) {
+			var request ProtectRequest
+			if err := decode(r, &request); err != nil {
+				return nil, err
+			}
+			return s.get(name, s.driver.SetProtected(name, request.Protected))
+		},
+		"reset": func(r *http.Request) (interface{}, error) {
+			return s.get(name, s.driver.Reset(name))
+		},
+		"convert": func(r *http.Request) (interface{}, error) {
+			var request ConvertRequest
+			if err := decode(r, &request); err != nil {
+				return nil, err
+			}
+			switch {
+			case request.Sparse != nil && request.Fs == "":
+				return s.get(name, s.driver.ConvertSparse(name, *request.Sparse))
+			case request.Sparse == nil && request.Fs != "":
+				return s.get(name, s.driver.ConvertFs(name, request.Fs))
+			default:
+				return nil, badRequest{errors.New("exactly one of 'sparse' and 'fs' has to be specified")}
+			}
+		},
+		"force-unmount": func(r *http.Request) (interface{}, error) {
+			return s.get(name, s.driver.ForceUnmount(name))
+		},
+		"cancel-erase": func(r *http.Request) (interface{}, error) {
+			return nil, s.driver.CancelErase(name)
+		},
+	}
+}
+
+func (s *Server) list(r *http.Request) (interface{}, error) {
+	response, err := s.driver.ListAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := ListResponse{Volumes: make([]Volume, 0, len(response.Volumes))}
+	for _, vol := range response.Volumes {
+		result.Volumes = append(result.Volumes, convertVolume(vol))
+	}
+	return result, nil
+}
+
+// tenants describes either all tenants or a single one if its name is given
+func (s *Server) tenants(name string) (interface{}, error) {
+	tenants, err := s.driver.Tenants()
+	if err != nil {
+		return nil, err
+	}
+
+	if name != "" {
+		for _, usage := range tenants {
+			if usage.Name == name {
+				return TenantResponse{Tenant: Tenant(usage)}, nil
+			}
+		}
+		return nil, notFound{errors.Errorf("tenant '%s' does not exist", name)}
+	}
+
+	result := TenantsResponse{Tenants: make([]Tenant, 0, len(tenants))}
+	for _, usage := range tenants {
+		result.Tenants = append(result.Tenants, Tenant(usage))
+	}
+	return result, nil
+}
+
+// get describes a volume after an operation on it unless the operation failed
+func (s *Server) get(name string, errs ...error) (interface{}, error) {
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := s.driver.Inspect(name)
+	if err != nil {
+		return nil, err
+	}
+	return GetResponse{Volume: convertVolume(response.Volume)}, nil
+}
+
+func (s *Server) export(w http.ResponseWriter, name string) {
+	// errors can only be reported until first byte of the archive has been written
+	writer := &trackingWriter{writer: w}
+	w.Header().Set("Content-Type", "application/x-tar")
+
+	err := s.driver.Export(name, writer)
+	if err != nil && !writer.written {
+		writeError(w, Code(err), err)
+	}
+}
+
+func convertVolume(vol *v.Volume) Volume {
+	return Volume{
+		Name:       vol.Name,
+		CreatedAt:  vol.CreatedAt,
+		Mountpoint: vol.Mountpoint,
+		Status:     vol.Status,
+	}
+}
+
+type badRequest struct {
+	error
+}
+
+type notFound struct {
+	error
+}
+
+func decode(r *http.Request, request interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(request)
+	if err != nil {
+		return badRequest{errors.Wrap(err, "cannot parse request body")}
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, code string, err error) {
+	writeJson(w, statuses[code], ErrorResponse{Error: Error{Code: code, Message: err.Error()}})
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+type trackingWriter struct {
+	writer  io.Writer
+	written bool
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	t.written = true
+	return t.writer.Write(p)
+}
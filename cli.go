@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alexflint/go-arg"
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/ashald/docker-volume-loopback/driver"
+	v "github.com/docker/go-plugins-helpers/volume"
+	"github.com/pkg/errors"
+)
+
+// Lease used by CLI commands when one is not specified explicitly
+const cliLease = "cli"
+
+// command operates directly on data dir while neither the plugin nor another command is running
+type command struct {
+	help string
+	args interface{}
+	run  func(d *driver.Driver) error
+}
+
+type nameArgs struct {
+	Name string `arg:"positional,required,help:volume name"`
+}
+
+type createArgs struct {
+	Name    string   `arg:"positional,required,help:volume name"`
+	Options []string `arg:"-o,--opt,separate,help:volume option as key=value - same as for 'docker volume create'"`
+}
+
+type mountArgs struct {
+	Name  string `arg:"positional,required,help:volume name"`
+	Lease string `arg:"--lease,help:lease ID to mount volume for"`
+}
+
+type umountArgs struct {
+	Name  string `arg:"positional,required,help:volume name"`
+	Lease string `arg:"--lease,help:lease ID to un-mount volume for"`
+	Force bool   `arg:"--force,help:drop all leases and un-mount volume"`
+}
+
+type moveArgs struct {
+	Name string `arg:"positional,required,help:volume name"`
+	Pool string `arg:"--pool,required,help:pool to move volume to"`
+}
+
+type fsckArgs struct {
+	Name   string `arg:"positional,required,help:volume name"`
+	Repair bool   `arg:"--repair,help:repair fs instead of only checking it"`
+}
+
+type gcArgs struct {
+	DryRun bool `arg:"--dry-run,help:only report leftovers that would be removed"`
+}
+
+func commands() map[string]command {
+	var (
+		name   nameArgs
+		create createArgs
+		mount  = mountArgs{Lease: cliLease}
+		umount = umountArgs{Lease: cliLease}
+		move   moveArgs
+		fsck   fsckArgs
+		gc     gcArgs
+	)
+
+	return map[string]command{
+		"ls": {
+			help: "list volumes",
+			run:  listVolumes,
+		},
+		"inspect": {
+			help: "display detailed information on a volume",
+			args: &name,
+			run: func(d *driver.Driver) error {
+				response, err := d.Inspect(name.Name)
+				if err != nil {
+					return err
+				}
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "    ")
+				return encoder.Encode(response.Volume)
+			},
+		},
+		"create": {
+			help: "create a volume",
+			args: &create,
+			run: func(d *driver.Driver) error {
+				options := make(map[string]string)
+				for _, option := range create.Options {
+					pair := strings.SplitN(option, "=", 2)
+					if len(pair) != 2 {
+						return errors.Errorf("option '%s' is not in key=value format", option)
+					}
+					options[pair[0]] = pair[1]
+				}
+				err := d.Create(&v.CreateRequest{Name: create.Name, Options: options})
+				if err == nil {
+					fmt.Println(create.Name)
+				}
+				return err
+			},
+		},
+		"rm": {
+			help: "remove a volume",
+			args: &name,
+			run: func(d *driver.Driver) error {
+				return d.Remove(&v.RemoveRequest{Name: name.Name})
+			},
+		},
+		"mount": {
+			help: "mount a volume and print its mount-point",
+			args: &mount,
+			run: func(d *driver.Driver) error {
+				response, err := d.Mount(&v.MountRequest{Name: mount.Name, ID: mount.Lease})
+				if err == nil {
+					fmt.Println(response.Mountpoint)
+				}
+				return err
+			},
+		},
+		"umount": {
+			help: "un-mount a volume",
+			args: &umount,
+			run: func(d *driver.Driver) error {
+				if umount.Force {
+					return d.ForceUnmount(umount.Name)
+				}
+				return d.Unmount(&v.UnmountRequest{Name: umount.Name, ID: umount.Lease})
+			},
+		},
+		"move": {
+			help: "move a volume that is not in use to another pool",
+			args: &move,
+			run: func(d *driver.Driver) error {
+				return d.Move(move.Name, move.Pool, false)
+			},
+		},
+		"fsck": {
+			help: "check (and repair) fs of a volume that is not in use",
+			args: &fsck,
+			run: func(d *driver.Driver) error {
+				output, err := d.Fsck(fsck.Name, fsck.Repair)
+				if output != "" {
+					fmt.Println(output)
+				}
+				return err
+			},
+		},
+		"gc": {
+			help: "remove leftovers of crashes and interrupted operations",
+			args: &gc,
+			run: func(d *driver.Driver) error {
+				removed, err := d.GC(gc.DryRun)
+				for _, path := range removed {
+					fmt.Println(path)
+				}
+				return err
+			},
+		},
+	}
+}
+
+func listVolumes(d *driver.Driver) error {
+	response, err := d.ListAll()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPOOL\tFS\tSPARSE\tSIZE\tALLOCATED\tLEASES")
+	for _, vol := range response.Volumes {
+		response, err := d.Inspect(vol.Name)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t?\t?\t?\t?\t?\t?\n", vol.Name)
+			continue
+		}
+		status := response.Volume.Status
+		fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			vol.Name, status["pool"], status["fs"], status["sparse"], status["size-max"], status["size-allocated"], status["leases"])
+	}
+	return w.Flush()
+}
+
+func usage(commands map[string]command) string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{"Commands (run while the plugin is stopped):"}
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("  %-10s %s", name, commands[name].help))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// runCommand executes a CLI command and returns exit code, it's invoked when the first argument is a command name
+func runCommand(name string, cmd command, cmdArgs []string) int {
+	args.LogLevel = context.Error
+	if path := configFilePath(cmdArgs); path != "" {
+		err := readConfigFile(path, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
+
+	dests := []interface{}{args}
+	if cmd.args != nil {
+		dests = append(dests, cmd.args)
+	}
+	parser, err := arg.NewParser(arg.Config{Program: os.Args[0] + " " + name}, dests...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	err = parser.Parse(cmdArgs)
+	if err == arg.ErrHelp {
+		parser.WriteHelp(os.Stdout)
+		return 0
+	}
+	if err != nil {
+		parser.WriteUsage(os.Stderr)
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	// errors are printed anyway so logs are only shown when asked for
+	logOutput := ioutil.Discard
+	if _, isSet := os.LookupEnv("LOG_LEVEL"); isSet || hasFlag(cmdArgs, "--log-level") {
+		logOutput = os.Stderr
+	}
+	context.Init(args.LogLevel, args.LogFormat, logOutput)
+	ctx := context.New()
+
+	lock, err := acquireLock(lockFilePath(args.StateDir), false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	defer lock.Close()
+
+	// background routines are not started so that the command only does what it's asked to
+	cfg := driverConfig(args)
+	cfg.JanitorInterval = 0
+	cfg.ArchiveAfter = 0
+	cfg.SpaceWarning = ""
+	cfg.SpaceCritical = ""
+	driverInstance, err := driver.New(ctx.Derived(), cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	err = cmd.run(driverInstance)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+func hasFlag(cmdArgs []string, flag string) bool {
+	for _, cmdArg := range cmdArgs {
+		if cmdArg == flag || strings.HasPrefix(cmdArg, flag+"=") {
+			return true
+		}
+	}
+	return false
+}
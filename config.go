@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/alexflint/go-arg"
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/ashald/docker-volume-loopback/driver"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Config file keys that are applied on SIGHUP, changes to the rest are only applied on restart
+var reloadable = map[string]bool{
+	"log-level":    true,
+	"log-format":   true,
+	"default-size": true,
+	"list-status":  true,
+	"profiles":     true,
+	"policies":     true,
+	"tenants":      true,
+}
+
+// configFilePath looks the config file up before flags are parsed so that flags and env vars can override the file
+func configFilePath(cmdArgs []string) string {
+	path := os.Getenv("CONFIG_FILE")
+	for idx, cmdArg := range cmdArgs {
+		if cmdArg == "--config" && idx+1 < len(cmdArgs) {
+			path = cmdArgs[idx+1]
+		} else if strings.HasPrefix(cmdArg, "--config=") {
+			path = strings.TrimPrefix(cmdArg, "--config=")
+		}
+	}
+	return path
+}
+
+// readConfigFile fills cfg with values from a YAML (or JSON, as it's a subset of YAML) file, unknown keys are rejected
+func readConfigFile(path string, cfg *config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read config file '%s'", path)
+	}
+	err = yaml.UnmarshalStrict(data, cfg)
+	if err != nil {
+		return errors.Wrapf(err, "invalid config file '%s'", path)
+	}
+	return nil
+}
+
+// loadConfig builds configuration the same way as on startup: defaults, then config file, then env vars and flags
+func loadConfig(path string, cmdArgs []string) (cfg *config, err error) {
+	cfg = defaultConfig()
+	err = readConfigFile(path, cfg)
+	if err != nil {
+		return
+	}
+	parser, err := arg.NewParser(arg.Config{}, cfg)
+	if err != nil {
+		return
+	}
+	err = parser.Parse(cmdArgs)
+	return
+}
+
+type configChange struct {
+	key      string
+	old, new interface{}
+}
+
+// configChanges lists settings whose values differ between two configs by their config file keys
+func configChanges(old, new *config) (changes []configChange) {
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(new).Elem()
+	for idx := 0; idx < oldValue.NumField(); idx++ {
+		key := strings.Split(oldValue.Type().Field(idx).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		change := configChange{key: key, old: oldValue.Field(idx).Interface(), new: newValue.Field(idx).Interface()}
+		if !reflect.DeepEqual(change.old, change.new) {
+			changes = append(changes, change)
+		}
+	}
+	return
+}
+
+// watchConfig reloads config file on SIGHUP and applies settings that can safely change while volumes are in use
+func watchConfig(ctx *context.Context, d *driver.Driver) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		ctx := ctx.Derived().
+			Field("path", args.Config)
+
+		ctx.
+			Level(context.Info).
+			Message("reloading config file")
+
+		cfg, err := loadConfig(args.Config, os.Args[1:])
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", err).
+				Message("failed to reload config file - keeping current config")
+			continue
+		}
+
+		err = context.Reconfigure(cfg.LogLevel, cfg.LogFormat)
+		if err == nil {
+			err = d.Reload(driverConfig(cfg))
+			if err != nil {
+				_ = context.Reconfigure(args.LogLevel, args.LogFormat)
+			}
+		}
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", err).
+				Message("failed to apply reloaded config - keeping current config")
+			continue
+		}
+
+		for _, change := range configChanges(args, cfg) {
+			if !reloadable[change.key] {
+				ctx.
+					Level(context.Warning).
+					Field("key", change.key).
+					Field("new", change.new).
+					Message("setting cannot be changed without restart - ignoring it")
+				continue
+			}
+			ctx.
+				Level(context.Info).
+				Field("key", change.key).
+				Field("old", change.old).
+				Field("new", change.new).
+				Message("changed setting")
+		}
+		args.LogLevel = cfg.LogLevel
+		args.LogFormat = cfg.LogFormat
+		args.DefaultSize = cfg.DefaultSize
+		args.ListStatus = cfg.ListStatus
+		args.Profiles = cfg.Profiles
+		args.Policies = cfg.Policies
+		args.Tenants = cfg.Tenants
+	}
+}
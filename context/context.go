@@ -50,10 +50,16 @@ type Context struct {
 	Trace string
 	index uint64 // given Context is intended to be used in single-threaded fashion so we use uint instead of ULID
 
-	level  logrus.Level
-	fields map[string]interface{}
+	level   logrus.Level
+	fields  map[string]interface{}
+	started time.Time
 }
 
+// Observer is notified about every finished operation, operation is named after the ':func' field of its context
+type Observer func(operation string, elapsed time.Duration, err error)
+
+var observer Observer
+
 func Init(level int, format string, output io.Writer) {
 	formatter, valid := formats[format]
 	if !valid {
@@ -67,10 +73,34 @@ func Init(level int, format string, output io.Writer) {
 	logrus.SetLevel(convertLevel(level))
 }
 
+// Reconfigure changes level and format of logs written after Init, invalid values are reported instead of panicking
+func Reconfigure(level int, format string) error {
+	formatter, valid := formats[format]
+	if !valid {
+		return fmt.Errorf(
+			"wrong log format '%s' - only following are supported: %s", format, strings.Join(allFormats, ", "))
+	}
+	if level < 0 || level >= len(allLevels) {
+		return fmt.Errorf(
+			"wrong log level '%d' - only '0' (least verbose) to '%d' (most verbose) supported",
+			level, len(allLevels)-1)
+	}
+	logrus.SetFormatter(formatter)
+	logrus.SetLevel(allLevels[level])
+	return nil
+}
+
+// SetObserver registers a function to be notified about finished operations, nil to stop notifications.
+// Not safe to be called concurrently with operations being finished.
+func SetObserver(o Observer) {
+	observer = o
+}
+
 func New() (ctx *Context) {
 	ctx = new(Context)
 	ctx.Trace = newULID()
 	ctx.fields = make(map[string]interface{})
+	ctx.started = time.Now()
 	return
 }
 
@@ -80,6 +110,7 @@ func (ctx *Context) Copy() *Context {
 	newContext.index = ctx.index
 	newContext.level = ctx.level
 	newContext.fields = make(map[string]interface{})
+	newContext.started = ctx.started
 
 	for k, v := range ctx.fields {
 		newContext.fields[k] = v
@@ -115,6 +146,20 @@ func (ctx *Context) Message(message string) {
 	logrus.WithFields(ctx.fields).Log(ctx.level, message)
 }
 
+// Elapsed reports time passed since the context was created
+func (ctx *Context) Elapsed() time.Duration {
+	return time.Since(ctx.started)
+}
+
+// Finish reports the operation traced by the context to the observer, if any
+func (ctx *Context) Finish(err error) {
+	if observer == nil {
+		return
+	}
+	operation, _ := ctx.fields[":func"].(string)
+	observer(operation, ctx.Elapsed(), err)
+}
+
 func convertLevel(level int) logrus.Level {
 	if level < 0 || level >= len(allLevels) {
 		panic(
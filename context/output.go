@@ -0,0 +1,269 @@
+package context
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log outputs, any other output is an absolute path to a log file
+const (
+	OutputStdout   = "stdout"
+	OutputJournald = "journald"
+	OutputSyslog   = "syslog" // 'syslog:<socket>' to use a socket other than a default one, e.g. /dev/log
+)
+
+// Identifier logs are tagged with in journald and syslog
+const Identifier = "docker-volume-loopback"
+
+const journaldSocket = "/run/systemd/journal/socket"
+
+// SetOutput sends logs written after Init to stdout, journald, syslog or a file rotated once it grows beyond maxSize
+// bytes keeping up to maxFiles rotated files, maxSize of 0 disables rotation. Log format applies to all of them but
+// journald that gets context fields as structured fields instead, e.g. '::trace' as 'TRACE' and ':param/name' as
+// 'PARAM_NAME'.
+func SetOutput(output string, maxSize int64, maxFiles int) error {
+	logger := logrus.StandardLogger()
+
+	switch {
+	case output == OutputStdout:
+		logger.ReplaceHooks(make(logrus.LevelHooks))
+		logger.SetOutput(os.Stdout)
+
+	case output == OutputJournald:
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+		if err != nil {
+			return fmt.Errorf("cannot connect to journald socket '%s': %s", journaldSocket, err)
+		}
+		logger.ReplaceHooks(make(logrus.LevelHooks))
+		logger.AddHook(&journaldHook{conn: conn})
+		logger.SetOutput(ioutil.Discard)
+
+	case output == OutputSyslog || strings.HasPrefix(output, OutputSyslog+":"):
+		var writer *syslog.Writer
+		var err error
+		if socket := strings.TrimPrefix(output, OutputSyslog+":"); socket != output {
+			writer, err = syslog.Dial("unixgram", socket, syslog.LOG_DAEMON, Identifier)
+		} else {
+			writer, err = syslog.New(syslog.LOG_DAEMON, Identifier)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot connect to syslog via '%s': %s", output, err)
+		}
+		logger.ReplaceHooks(make(logrus.LevelHooks))
+		logger.AddHook(&syslogHook{writer: writer})
+		logger.SetOutput(ioutil.Discard)
+
+	case filepath.IsAbs(output):
+		file, err := openRotatingFile(output, maxSize, maxFiles)
+		if err != nil {
+			return err
+		}
+		logger.ReplaceHooks(make(logrus.LevelHooks))
+		logger.SetOutput(file)
+
+	default:
+		return fmt.Errorf(
+			"wrong log output '%s' - only %s, %s, %s[:<socket>] or an absolute file path are supported",
+			output, OutputStdout, OutputJournald, OutputSyslog)
+	}
+	return nil
+}
+
+// journaldHook sends entries to journald using its native protocol so that every field can be matched on
+type journaldHook struct {
+	conn *net.UnixConn
+}
+
+var journaldPriorities = map[logrus.Level]int{
+	logrus.ErrorLevel: 3,
+	logrus.WarnLevel:  4,
+	logrus.InfoLevel:  6,
+	logrus.DebugLevel: 7,
+	logrus.TraceLevel: 7,
+}
+
+func (h *journaldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *journaldHook) Fire(entry *logrus.Entry) error {
+	var datagram bytes.Buffer
+	writeJournaldField(&datagram, "MESSAGE", entry.Message)
+	writeJournaldField(&datagram, "PRIORITY", fmt.Sprint(journaldPriorities[entry.Level]))
+	writeJournaldField(&datagram, "SYSLOG_IDENTIFIER", Identifier)
+	for name, value := range entry.Data {
+		writeJournaldField(&datagram, journaldFieldName(name), formatValue(value))
+	}
+
+	_, err := h.conn.Write(datagram.Bytes())
+	if err != nil {
+		return fmt.Errorf("cannot write to journald: %s", err)
+	}
+	return nil
+}
+
+// journaldFieldName converts a context field name such as ':param/name' into a valid journald field name
+func journaldFieldName(name string) string {
+	converted := strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, name), "_")
+	if converted == "" || converted[0] >= '0' && converted[0] <= '9' {
+		converted = "FIELD_" + converted
+	}
+	if len(converted) > 64 {
+		converted = converted[:64]
+	}
+	return converted
+}
+
+// writeJournaldField serializes a field, values spanning multiple lines are prefixed with their length
+func writeJournaldField(datagram *bytes.Buffer, name, value string) {
+	datagram.WriteString(name)
+	if strings.Contains(value, "\n") {
+		datagram.WriteByte('\n')
+		_ = binary.Write(datagram, binary.LittleEndian, uint64(len(value)))
+	} else {
+		datagram.WriteByte('=')
+	}
+	datagram.WriteString(value)
+	datagram.WriteByte('\n')
+}
+
+func formatValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	}
+	serialized, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(serialized)
+}
+
+// syslogHook sends entries formatted according to log format to syslog
+type syslogHook struct {
+	writer *syslog.Writer
+}
+
+func (h *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *syslogHook) Fire(entry *logrus.Entry) error {
+	serialized, err := entry.Logger.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	line := strings.TrimSuffix(string(serialized), "\n")
+
+	switch entry.Level {
+	case logrus.ErrorLevel:
+		return h.writer.Err(line)
+	case logrus.WarnLevel:
+		return h.writer.Warning(line)
+	case logrus.InfoLevel:
+		return h.writer.Info(line)
+	default:
+		return h.writer.Debug(line)
+	}
+}
+
+// rotatingFile appends to a log file and renames it to '<path>.1' once it grows too big, shifting older ones
+type rotatingFile struct {
+	sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create dir for log file '%s': %s", path, err)
+	}
+	f := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	err = f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("cannot open log file '%s': %s", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("cannot access log file '%s': %s", f.path, err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (n int, err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	var errRotate error
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		errRotate = f.rotate()
+	}
+	n, err = f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = errRotate
+	}
+	return
+}
+
+func (f *rotatingFile) rotate() error {
+	_ = f.file.Close()
+
+	for idx := f.maxFiles - 1; idx > 0; idx-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.path, idx), fmt.Sprintf("%s.%d", f.path, idx+1))
+	}
+	var errRotate error
+	if f.maxFiles > 0 {
+		errRotate = os.Rename(f.path, f.path+".1")
+	} else {
+		errRotate = os.Remove(f.path)
+	}
+
+	// keep logging into the same file if it cannot be rotated
+	err := f.open()
+	if err != nil {
+		return err
+	}
+	if errRotate != nil && !os.IsNotExist(errRotate) {
+		return fmt.Errorf("cannot rotate log file '%s': %s", f.path, errRotate)
+	}
+	return nil
+}
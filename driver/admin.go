@@ -0,0 +1,875 @@
+package driver
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/ashald/docker-volume-loopback/manager"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// Operations below are not part of Docker volume plugin protocol and are meant for plugin administrators.
+
+func (d *Driver) SetProtected(name string, protected bool) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/SetProtected")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/protected", protected).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Field("protected", protected).
+					Message("changed volume protection")
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	err = d.manager.SetProtected(ctx.Derived(), name, protected)
+
+	return
+}
+
+func (d *Driver) Reset(name string) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Reset")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Message("reset volume")
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	err = d.manager.Reset(ctx.Derived(), name)
+
+	return
+}
+
+func (d *Driver) Rename(name string, newName string) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Rename")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/newName", newName).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Field("new-name", newName).
+					Message("renamed volume")
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	vol, err := d.manager.Get(ctx.Derived(), name)
+	if err != nil {
+		return
+	}
+
+	// Validation: policies - volume has to comply with policies matching its new name
+	{
+		ctx.
+			Level(context.Trace).
+			Message("enforcing policies")
+		spec, options, only := d.existingVolumeSpec(newName, vol)
+		spec.replaces = name
+		err = d.enforcePolicies(ctx.Derived(), &spec, options, only)
+		if err != nil {
+			return
+		}
+	}
+
+	// Validation: tenant quota - volume is charged to the tenant of its new name if that's a different one
+	{
+		ctx.
+			Level(context.Trace).
+			Message("enforcing tenant quota")
+		newTenant := d.tenantOf(newName, vol.Metadata)
+		if newTenant != d.tenantOf(name, vol.Metadata) {
+			err = d.enforceQuota(ctx.Derived(), newTenant, 1, int64(vol.MaxSizeInBytes), int64(vol.AllocatedSizeInBytes))
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	err = d.manager.Rename(ctx.Derived(), name, newName)
+
+	return
+}
+
+func (d *Driver) ConvertSparse(name string, sparse bool) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/ConvertSparse")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/sparse", sparse).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Field("sparse", sparse).
+					Message("converted volume")
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	vol, err := d.manager.Get(ctx.Derived(), name)
+	if err != nil {
+		return
+	}
+
+	// Validation: policies
+	{
+		ctx.
+			Level(context.Trace).
+			Message("enforcing policies")
+		spec, options, only := d.existingVolumeSpec(name, vol)
+		spec.sparse = sparse
+		spec.replaces = name
+		err = d.enforcePolicies(ctx.Derived(), &spec, options, only)
+		if err != nil {
+			return
+		}
+	}
+
+	// Validation: tenant quota - a regular volume allocates all of its size
+	if !sparse && vol.Metadata.Sparse {
+		ctx.
+			Level(context.Trace).
+			Message("enforcing tenant quota")
+		growth := int64(vol.MaxSizeInBytes) - int64(vol.AllocatedSizeInBytes)
+		err = d.enforceQuota(ctx.Derived(), d.tenantOf(name, vol.Metadata), 0, 0, growth)
+		if err != nil {
+			return
+		}
+	}
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	err = d.manager.ConvertSparse(ctx.Derived(), name, sparse)
+
+	return
+}
+
+func (d *Driver) ConvertFs(name string, fs string) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/ConvertFs")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/fs", fs).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Field("fs", fs).
+					Message("converted volume")
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	fs = strings.ToLower(strings.TrimSpace(fs))
+	vol, err := d.manager.Get(ctx.Derived(), name)
+	if err != nil {
+		return
+	}
+
+	// Validation: policies
+	{
+		ctx.
+			Level(context.Trace).
+			Message("enforcing policies")
+		spec, options, only := d.existingVolumeSpec(name, vol)
+		spec.fs = fs
+		spec.replaces = name
+		err = d.enforcePolicies(ctx.Derived(), &spec, options, only)
+		if err != nil {
+			return
+		}
+	}
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	err = d.manager.ConvertFs(ctx.Derived(), name, fs)
+
+	return
+}
+
+func (d *Driver) Resize(name string, size string) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Resize")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/size", size).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Field("size", size).
+					Message("resized volume")
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Validation
+	sizeInBytes, err := FromHumanSize(size)
+	if err != nil {
+		return errors.Wrapf(manager.ErrInvalid, "cannot convert size '%s' into bytes", size)
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	vol, err := d.manager.Get(ctx.Derived(), name)
+	if err != nil {
+		return
+	}
+
+	// Validation: policies - only size limits apply as nothing else changes
+	{
+		ctx.
+			Level(context.Trace).
+			Message("enforcing policies")
+		spec, options, only := d.existingVolumeSpec(name, vol)
+		spec.size = sizeInBytes
+		spec.replaces = name
+		spec.sizeOnly = true
+		err = d.enforcePolicies(ctx.Derived(), &spec, options, only)
+		if err != nil {
+			return
+		}
+	}
+
+	// Validation: tenant quota
+	{
+		ctx.
+			Level(context.Trace).
+			Message("enforcing tenant quota")
+		growth := sizeInBytes - int64(vol.MaxSizeInBytes)
+		if growth > 0 {
+			allocated := growth
+			if vol.Metadata.Sparse {
+				allocated = 0
+			}
+			err = d.enforceQuota(ctx.Derived(), d.tenantOf(name, vol.Metadata), 0, growth, allocated)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	err = d.manager.Resize(ctx.Derived(), name, sizeInBytes)
+
+	return
+}
+
+func (d *Driver) Snapshot(name string, snapshotName string) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Snapshot")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/snapshotName", snapshotName).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Field("snapshot", snapshotName).
+					Message("created volume snapshot")
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	vol, err := d.manager.Get(ctx.Derived(), name)
+	if err != nil {
+		return
+	}
+
+	// Validation: policies - snapshot inherits volume's metadata so it has to comply with policies matching its name
+	{
+		ctx.
+			Level(context.Trace).
+			Message("enforcing policies")
+		spec, options, only := d.existingVolumeSpec(snapshotName, vol)
+		err = d.enforcePolicies(ctx.Derived(), &spec, options, only)
+		if err != nil {
+			return
+		}
+	}
+
+	// Validation: tenant quota - snapshot takes as much space as the volume does
+	{
+		ctx.
+			Level(context.Trace).
+			Message("enforcing tenant quota")
+		err = d.enforceQuota(ctx.Derived(), d.tenantOf(snapshotName, vol.Metadata), 1,
+			int64(vol.MaxSizeInBytes), int64(vol.AllocatedSizeInBytes))
+		if err != nil {
+			return
+		}
+	}
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	err = d.manager.Snapshot(ctx.Derived(), name, snapshotName)
+
+	return
+}
+
+// Export streams volume contents as a tar archive, the lock is only held while volume is being (un)mounted
+func (d *Driver) Export(name string, w io.Writer) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Export")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Message("exported volume")
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// every export gets its own lease so that concurrent exports don't interfere
+	lease := "export-" + ctx.Trace
+
+	// Mounting
+	var mountPath string
+	{
+		ctx.
+			Level(context.Trace).
+			Message("waiting for a lock")
+
+		d.Lock()
+		mountPath, err = d.manager.Mount(ctx.Derived(), name, lease, d)
+		d.Unlock()
+		if err != nil {
+			return
+		}
+
+		defer func() {
+			ctx.
+				Level(context.Trace).
+				Message("waiting for a lock")
+
+			d.Lock()
+			errUnMount := d.manager.UnMount(ctx.Derived(), name, lease, d)
+			d.Unlock()
+			if err == nil {
+				err = errUnMount
+			}
+		}()
+	}
+
+	// Processing
+	ctx.
+		Level(context.Trace).
+		Message("streaming volume contents")
+	err = manager.Export(ctx.Derived(), mountPath, w)
+
+	return
+}
+
+func (d *Driver) ForceUnmount(name string) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/ForceUnmount")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Message("force un-mounted volume")
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	err = d.manager.ForceUnmount(ctx.Derived(), name)
+
+	return
+}
+
+// CancelErase does not take the lock as erasures are tracked apart from it - the removal it interrupts releases the
+// lock while erasing and only takes it back to leave the volume in place once the erasure is cancelled
+func (d *Driver) CancelErase(name string) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/CancelErase")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Message("cancelled volume erasure")
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Processing
+	err = d.manager.CancelErase(ctx.Derived(), name)
+
+	return
+}
+
+func (d *Driver) Fsck(name string, repair bool) (output string, err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Fsck")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/repair", repair).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Field("repair", repair).
+					Message("checked volume fs")
+				initial.
+					Level(context.Debug).
+					Field(":return/output", output).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	output, err = d.manager.Fsck(ctx.Derived(), name, repair)
+
+	return
+}
+
+func (d *Driver) GC(dryRun bool) (removed []string, err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/GC")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/dryRun", dryRun).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Info).
+					Field("count", len(removed)).
+					Field("dry-run", dryRun).
+					Message("removed leftovers")
+				initial.
+					Level(context.Debug).
+					Field(":return/removed", removed).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	removed, err = d.manager.GC(ctx.Derived(), dryRun)
+
+	return
+}
+
+// Move relocates a volume into another pool. A volume that is in use is either refused or, when onUnmount is set,
+// frozen and moved once it's un-mounted for its last lease.
+func (d *Driver) Move(name string, pool string, onUnmount bool) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Move")
+	var moved bool
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/pool", pool).
+			Field(":param/onUnmount", onUnmount).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				message := "moved volume"
+				if !moved {
+					message = "scheduled volume move until it's un-mounted"
+				}
+				initial.
+					Level(context.Info).
+					Field("volume", name).
+					Field("pool", pool).
+					Message(message)
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	if onUnmount {
+		moved, err = d.manager.MoveOnUnmount(ctx.Derived(), name, pool, d)
+	} else {
+		err = d.manager.Move(ctx.Derived(), name, pool, d)
+		moved = true
+	}
+
+	return
+}
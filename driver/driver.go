@@ -1,7 +1,6 @@
 package driver
 
 import (
-	"fmt"
 	"github.com/ashald/docker-volume-loopback/context"
 	"sort"
 	"strconv"
@@ -15,21 +14,61 @@ import (
 )
 
 type Config struct {
-	StateDir    string
-	DataDir     string
-	MountDir    string
-	DefaultSize string
+	StateDir            string
+	DataDir             string
+	MountDir            string
+	DefaultSize         string
+	SecureDelete        string
+	JanitorInterval     time.Duration
+	ArchiveAfter        time.Duration
+	MinFreeSpace        string
+	MaxOversubscription float64
+	SpaceWarning        string
+	SpaceCritical       string
+	SpaceCheckInterval  time.Duration
+	ReadOnlyOnCritical  bool
+	ListStatus          bool
+	Pools               []PoolConfig
+	Placement           string
+	Profiles            []ProfileConfig
+	Policies            []PolicyConfig
+	Tenants             []TenantConfig
+	Endpoints           []EndpointConfig
+}
+
+// PoolConfig describes a pool in addition to the default one that keeps volumes in DataDir
+type PoolConfig struct {
+	Name                string
+	DataDir             string
+	Fs                  string
+	Sparse              bool
+	MinFreeSpace        string
+	MaxOversubscription float64
 }
 
 type Driver struct {
-	defaultSize string
-	manager     *manager.Manager
+	defaultSize  string
+	manager      *manager.Manager
+	listStatus   bool
+	profiles     map[string]ProfileConfig
+	policies     []policy
+	tenants      []tenant
+	endpoints    map[string]EndpointConfig
+	archiveAfter time.Duration
+	space        spaceMonitor
+	// expired volumes the janitor skipped as protected, kept so that it only logs each of them once
+	expiredProtected map[string]struct{}
+	// closed by Shutdown to stop background loops, guarded so that calling Shutdown again does not panic
+	stop     chan struct{}
+	stopOnce sync.Once
+	// guards settings that are read before acquiring the main lock and can be changed by Reload
+	settingsLock sync.RWMutex
 	sync.Mutex
 }
 
-var AllowedOptions = []string{"size", "sparse", "fs", "uid", "gid", "mode"}
+var AllowedOptions = []string{"size", "sparse", "fs", "uid", "gid", "mode", "secure-delete", "protected", "ttl", "reserve", "pool", "profile", "tenant"}
 
-func New(ctx *context.Context, cfg Config) (driver Driver, err error) {
+func New(ctx *context.Context, cfg Config) (driver *Driver, err error) {
 	ctx = ctx.
 		Field(":func", "driver/New")
 	{
@@ -59,6 +98,9 @@ func New(ctx *context.Context, cfg Config) (driver Driver, err error) {
 		}()
 	}
 
+	driver = new(Driver)
+	driver.stop = make(chan struct{})
+
 	ctx.
 		Level(context.Trace).
 		Field("DefaultSize", cfg.DefaultSize).
@@ -68,14 +110,103 @@ func New(ctx *context.Context, cfg Config) (driver Driver, err error) {
 		return
 	}
 	driver.defaultSize = cfg.DefaultSize
+	driver.listStatus = cfg.ListStatus
+
+	ctx.
+		Level(context.Trace).
+		Field("Profiles", cfg.Profiles).
+		Message("validating 'Profiles' config field")
+	driver.profiles, err = validateProfiles(cfg.Profiles)
+	if err != nil {
+		return
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("Policies", cfg.Policies).
+		Message("validating 'Policies' config field")
+	driver.policies, err = validatePolicies(cfg.Policies)
+	if err != nil {
+		return
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("Tenants", cfg.Tenants).
+		Message("validating 'Tenants' config field")
+	driver.tenants, err = validateTenants(cfg.Tenants)
+	if err != nil {
+		return
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("ArchiveAfter", cfg.ArchiveAfter.String()).
+		Message("validating 'ArchiveAfter' config field")
+	if cfg.ArchiveAfter < 0 {
+		err = errors.Errorf("ArchiveAfter (%s) must not be negative", cfg.ArchiveAfter)
+		return
+	}
+	if cfg.ArchiveAfter > 0 && cfg.JanitorInterval <= 0 {
+		err = errors.Errorf("JanitorInterval must be positive when ArchiveAfter is set")
+		return
+	}
+	driver.archiveAfter = cfg.ArchiveAfter
+
+	ctx.
+		Level(context.Trace).
+		Field("MinFreeSpace", cfg.MinFreeSpace).
+		Message("validating 'MinFreeSpace' config field")
+	var minFreeSpace int64
+	if cfg.MinFreeSpace != "" {
+		minFreeSpace, err = FromHumanSize(cfg.MinFreeSpace)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot convert 'MinFreeSpace' value '%s' into bytes", cfg.MinFreeSpace)
+			return
+		}
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("Pools", cfg.Pools).
+		Message("validating 'Pools' config field")
+	var pools []manager.Pool
+	for _, poolCfg := range cfg.Pools {
+		pool := manager.Pool{
+			Name:                poolCfg.Name,
+			DataDir:             poolCfg.DataDir,
+			Fs:                  strings.ToLower(strings.TrimSpace(poolCfg.Fs)),
+			Sparse:              poolCfg.Sparse,
+			MaxOversubscription: poolCfg.MaxOversubscription,
+		}
+		if pool.Fs == "" {
+			pool.Fs = "xfs"
+		}
+		if poolCfg.MinFreeSpace != "" {
+			pool.MinFreeSpace, err = FromHumanSize(poolCfg.MinFreeSpace)
+			if err != nil {
+				err = errors.Wrapf(err,
+					"cannot convert 'MinFreeSpace' value '%s' of pool '%s' into bytes", poolCfg.MinFreeSpace, poolCfg.Name)
+				return
+			}
+		}
+		pools = append(pools, pool)
+	}
 
 	ctx.
 		Level(context.Trace).
 		Message("creating volume manager instance")
 	mgr, err := manager.New(ctx.Derived(), manager.Config{
-		StateDir: cfg.StateDir,
-		DataDir:  cfg.DataDir,
-		MountDir: cfg.MountDir,
+		StateDir:     cfg.StateDir,
+		DataDir:      cfg.DataDir,
+		MountDir:     cfg.MountDir,
+		SecureDelete: cfg.SecureDelete,
+
+		MinFreeSpace:        minFreeSpace,
+		MaxOversubscription: cfg.MaxOversubscription,
+
+		Pools:     pools,
+		Placement: cfg.Placement,
 	})
 	if err != nil {
 		err = errors.Wrapf(err,
@@ -85,10 +216,90 @@ func New(ctx *context.Context, cfg Config) (driver Driver, err error) {
 	}
 	driver.manager = &mgr
 
+	ctx.
+		Level(context.Trace).
+		Message("rolling back operations interrupted by previous shutdown")
+	recovered, errRecover := driver.manager.Recover(ctx.Derived())
+	if errRecover != nil {
+		ctx.
+			Level(context.Warning).
+			Field("err", errRecover).
+			Message("cannot roll back interrupted operations")
+	} else if len(recovered) > 0 {
+		ctx.
+			Level(context.Warning).
+			Field("volumes", recovered).
+			Message("rolled back operations interrupted by previous shutdown")
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("Endpoints", cfg.Endpoints).
+		Message("validating 'Endpoints' config field")
+	driver.endpoints, err = validateEndpoints(cfg.Endpoints, driver.manager, driver.policies)
+	if err != nil {
+		return
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("SpaceWarning", cfg.SpaceWarning).
+		Field("SpaceCritical", cfg.SpaceCritical).
+		Message("validating free space thresholds config fields")
+	driver.space = spaceMonitor{
+		readOnly:  cfg.ReadOnlyOnCritical,
+		pools:     make(map[string]*poolSpace),
+		remounted: make(map[string]struct{}),
+	}
+	if cfg.SpaceWarning != "" {
+		driver.space.warning, err = FromHumanSize(cfg.SpaceWarning)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot convert 'SpaceWarning' value '%s' into bytes", cfg.SpaceWarning)
+			return
+		}
+	}
+	if cfg.SpaceCritical != "" {
+		driver.space.critical, err = FromHumanSize(cfg.SpaceCritical)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot convert 'SpaceCritical' value '%s' into bytes", cfg.SpaceCritical)
+			return
+		}
+	}
+	if driver.space.warning > 0 && driver.space.warning < driver.space.critical {
+		err = errors.Errorf(
+			"SpaceWarning (%s) must not be lower than SpaceCritical (%s)", cfg.SpaceWarning, cfg.SpaceCritical)
+		return
+	}
+
+	if cfg.JanitorInterval > 0 {
+		ctx.
+			Level(context.Debug).
+			Field("interval", cfg.JanitorInterval.String()).
+			Field("archive-after", cfg.ArchiveAfter.String()).
+			Message("starting janitor to remove expired and archive idle volumes")
+		go driver.runJanitor(cfg.JanitorInterval)
+	}
+
+	if driver.space.enabled() {
+		if cfg.SpaceCheckInterval <= 0 {
+			err = errors.Errorf("SpaceCheckInterval must be positive when free space thresholds are set")
+			return
+		}
+		ctx.
+			Level(context.Debug).
+			Field("interval", cfg.SpaceCheckInterval.String()).
+			Message("starting data dir free space monitor")
+		go driver.runSpaceMonitor(cfg.SpaceCheckInterval)
+	}
+
 	return
 }
 
-func (d Driver) Create(request *v.CreateRequest) (err error) {
+func (d *Driver) Create(request *v.CreateRequest) error {
+	return d.create(EndpointConfig{}, request)
+}
+
+func (d *Driver) create(ep EndpointConfig, request *v.CreateRequest) (err error) {
 	// Context definition
 	ctx := context.New().
 		Field(":func", "driver/Create")
@@ -98,15 +309,17 @@ func (d Driver) Create(request *v.CreateRequest) (err error) {
 		initial.
 			Level(context.Debug).
 			Field(":param/request", request).
+			Field(":param/endpoint", ep.Name).
 			Message("invoked")
 
 		defer func() {
+			initial.Finish(err)
 			if err != nil {
 				initial.
 					Level(context.Error).
 					Field(":return/err", err).
 					Message("failed with an error")
-				err = errors.Wrapf(err, initial.Trace)
+				err = errors.Wrap(err, initial.Trace)
 				return
 			} else {
 				initial.
@@ -139,12 +352,24 @@ func (d Driver) Create(request *v.CreateRequest) (err error) {
 		}
 		if len(wrongOptions) > 0 {
 			sort.Strings(wrongOptions)
-			return errors.Errorf(
+			return errors.Wrapf(manager.ErrInvalid,
 				"options '%s' are not among supported ones: %s",
 				strings.Join(wrongOptions, ", "), strings.Join(AllowedOptions, ", "))
 		}
 	}
 
+	// Validation: 'profile' option if present, explicit options below are resolved against it
+	{
+		ctx.
+			Level(context.Trace).
+			Field("profile", request.Options["profile"]).
+			Message("applying 'profile' option")
+		request.Options, err = d.applyProfile(ctx.Derived(), request.Options)
+		if err != nil {
+			return
+		}
+	}
+
 	// Validation: 'size' option if present
 	var sizeInBytes int64
 	{
@@ -154,21 +379,58 @@ func (d Driver) Create(request *v.CreateRequest) (err error) {
 			Field("size", size).
 			Message("validating 'size' option")
 		if !sizePresent {
+			d.settingsLock.RLock()
+			size = d.defaultSize
+			d.settingsLock.RUnlock()
+			if ep.DefaultSize != "" {
+				size = ep.DefaultSize
+			}
 			ctx.
 				Level(context.Debug).
-				Field("default", d.defaultSize).
+				Field("default", size).
 				Message("no 'size' option found - using default")
-			size = d.defaultSize
 		}
 
 		sizeInBytes, err = FromHumanSize(size)
 		if err != nil {
-			return errors.Errorf("cannot convert 'size' option value '%s' into bytes", size)
+			return errors.Wrapf(manager.ErrInvalid, "cannot convert 'size' option value '%s' into bytes", size)
+		}
+	}
+
+	// Validation: 'pool' option if present, pool defaults apply to options below
+	var pool manager.Pool
+	{
+		poolName, poolPresent := request.Options["pool"]
+		ctx.
+			Level(context.Trace).
+			Field("pool", poolName).
+			Message("validating 'pool' option")
+		if !poolPresent && ep.Pool != "" {
+			poolName = ep.Pool
+			ctx.
+				Level(context.Debug).
+				Field("default", poolName).
+				Message("no 'pool' option found - using endpoint default")
+		}
+		if len(poolName) > 0 {
+			pool, err = d.manager.Pool(poolName)
+			if err != nil {
+				return errors.Wrapf(err, "cannot use 'pool' option value '%s'", poolName)
+			}
+		} else {
+			pool, err = d.manager.Place(ctx.Derived())
+			if err != nil {
+				return errors.Wrap(err, "cannot pick a pool for the volume")
+			}
+			ctx.
+				Level(context.Debug).
+				Field("pool", pool.Name).
+				Message("no 'pool' option found - placing volume automatically")
 		}
 	}
 
 	// Validation: 'sparse' option if present
-	sparse := false
+	sparse := pool.Sparse
 	{
 		sparseStr, sparsePresent := request.Options["sparse"]
 		ctx.
@@ -178,7 +440,7 @@ func (d Driver) Create(request *v.CreateRequest) (err error) {
 		if sparsePresent {
 			sparse, err = strconv.ParseBool(sparseStr)
 			if err != nil {
-				return errors.Wrapf(err, "cannot parse 'sparse' option value '%s' as bool", sparseStr)
+				return errors.Wrapf(manager.ErrInvalid, "cannot parse 'sparse' option value '%s' as bool", sparseStr)
 			}
 		}
 	}
@@ -194,7 +456,10 @@ func (d Driver) Create(request *v.CreateRequest) (err error) {
 		if fsPresent {
 			fs = strings.ToLower(strings.TrimSpace(fsInput))
 		} else {
-			fs = "xfs"
+			fs = pool.Fs
+			if ep.Fs != "" {
+				fs = ep.Fs
+			}
 			ctx.
 				Level(context.Debug).
 				Field("default", fs).
@@ -213,10 +478,10 @@ func (d Driver) Create(request *v.CreateRequest) (err error) {
 		if uidPresent && len(uidStr) > 0 {
 			uid, err = strconv.Atoi(uidStr)
 			if err != nil {
-				return errors.Wrapf(err, "cannot parse 'uid' option value '%s' as an integer", uidStr)
+				return errors.Wrapf(manager.ErrInvalid, "cannot parse 'uid' option value '%s' as an integer", uidStr)
 			}
 			if uid < 0 {
-				return errors.Errorf("'uid' option should be >= 0 but received '%d'", uid)
+				return errors.Wrapf(manager.ErrInvalid, "'uid' option should be >= 0 but received '%d'", uid)
 			}
 
 			ctx.
@@ -237,10 +502,10 @@ func (d Driver) Create(request *v.CreateRequest) (err error) {
 		if gidPresent && len(gidStr) > 0 {
 			gid, err = strconv.Atoi(gidStr)
 			if err != nil {
-				return errors.Wrapf(err, "cannot parse 'gid' option value '%s' as an integer", gidStr)
+				return errors.Wrapf(manager.ErrInvalid, "cannot parse 'gid' option value '%s' as an integer", gidStr)
 			}
 			if gid < 0 {
-				return errors.Errorf("'gid' option should be >= 0 but received '%d'", gid)
+				return errors.Wrapf(manager.ErrInvalid, "'gid' option should be >= 0 but received '%d'", gid)
 			}
 
 			ctx.
@@ -266,17 +531,132 @@ func (d Driver) Create(request *v.CreateRequest) (err error) {
 
 			modeParsed, err := strconv.ParseUint(modeStr, 8, 32)
 			if err != nil {
-				return errors.Wrapf(err, "cannot parse mode '%s' as positive 4-position octal", modeStr)
+				return errors.Wrapf(manager.ErrInvalid, "cannot parse mode '%s' as positive 4-position octal", modeStr)
 			}
 
 			if modeParsed <= 0 || modeParsed > 07777 {
-				return errors.Errorf("mode value '%s' does not fall between 0 and 7777 in octal encoding", modeStr)
+				return errors.Wrapf(manager.ErrInvalid,
+					"mode value '%s' does not fall between 0 and 7777 in octal encoding", modeStr)
 			}
 
 			mode = uint32(modeParsed)
 		}
 	}
 
+	// Validation: 'secure-delete' option if present
+	var secureDelete string
+	{
+		secureDeleteStr, secureDeletePresent := request.Options["secure-delete"]
+		ctx.
+			Level(context.Trace).
+			Field("secure-delete", secureDeleteStr).
+			Message("validating 'secure-delete' option")
+		if secureDeletePresent && len(secureDeleteStr) > 0 {
+			secureDelete = strings.ToLower(strings.TrimSpace(secureDeleteStr))
+
+			// boolean values are accepted as a shortcut to either pick a method automatically or to disable erasure
+			enabled, errBool := strconv.ParseBool(secureDelete)
+			if errBool == nil {
+				if enabled {
+					secureDelete = manager.SecureDeleteAuto
+				} else {
+					secureDelete = manager.SecureDeleteNone
+				}
+			}
+
+			if !manager.IsValidSecureDeleteMethod(secureDelete) {
+				return errors.Wrapf(manager.ErrInvalid,
+					"'secure-delete' option value '%s' is not among supported ones: true, false, %s",
+					secureDeleteStr, strings.Join(manager.SecureDeleteMethods, ", "))
+			}
+
+			ctx.
+				Level(context.Debug).
+				Field("secure-delete", secureDelete).
+				Message("will securely erase volume data upon removal")
+		}
+	}
+
+	// Validation: 'protected' option if present
+	protected := false
+	{
+		protectedStr, protectedPresent := request.Options["protected"]
+		ctx.
+			Level(context.Trace).
+			Field("protected", protectedStr).
+			Message("validating 'protected' option")
+		if protectedPresent && len(protectedStr) > 0 {
+			protected, err = strconv.ParseBool(protectedStr)
+			if err != nil {
+				return errors.Wrapf(manager.ErrInvalid,
+					"cannot parse 'protected' option value '%s' as bool", protectedStr)
+			}
+		}
+	}
+
+	// Validation: 'ttl' option if present
+	var ttl time.Duration
+	{
+		ttlStr, ttlPresent := request.Options["ttl"]
+		ctx.
+			Level(context.Trace).
+			Field("ttl", ttlStr).
+			Message("validating 'ttl' option")
+		if ttlPresent && len(ttlStr) > 0 {
+			ttl, err = time.ParseDuration(ttlStr)
+			if err != nil {
+				return errors.Wrapf(manager.ErrInvalid, "cannot parse 'ttl' option value '%s' as duration", ttlStr)
+			}
+			if ttl <= 0 {
+				return errors.Wrapf(manager.ErrInvalid, "'ttl' option should be positive but received '%s'", ttlStr)
+			}
+
+			ctx.
+				Level(context.Debug).
+				Field("ttl", ttl.String()).
+				Message("volume will expire once unused for longer than ttl")
+		}
+	}
+
+	// Validation: 'reserve' option if present
+	reserve := manager.ReserveNone
+	{
+		reserveStr, reservePresent := request.Options["reserve"]
+		ctx.
+			Level(context.Trace).
+			Field("reserve", reserveStr).
+			Message("validating 'reserve' option")
+		if reservePresent && len(reserveStr) > 0 {
+			reserve = strings.ToLower(strings.TrimSpace(reserveStr))
+			if reserve != manager.ReserveNone && reserve != manager.ReserveStrict {
+				return errors.Wrapf(manager.ErrInvalid,
+					"'reserve' option value '%s' is not among supported ones: %s, %s",
+					reserveStr, manager.ReserveNone, manager.ReserveStrict)
+			}
+			if reserve == manager.ReserveStrict && sparse {
+				return errors.Wrapf(manager.ErrInvalid,
+					"'reserve' option value '%s' cannot be used with sparse volumes", reserveStr)
+			}
+		}
+	}
+
+	// Validation: 'tenant' option if present, it cannot take a volume away from the owner of its name prefix
+	{
+		tenantStr, tenantPresent := request.Options["tenant"]
+		ctx.
+			Level(context.Trace).
+			Field("tenant", tenantStr).
+			Message("validating 'tenant' option")
+		if tenantPresent && len(tenantStr) > 0 {
+			owner := d.prefixOwner(request.Name)
+			if owner != "" && owner != tenantStr {
+				return errors.Wrapf(manager.ErrInvalid,
+					"'tenant' option value '%s' does not match tenant '%s' that owns the name prefix of volume '%s'",
+					tenantStr, owner, request.Name)
+			}
+		}
+	}
+
 	// Locking
 	ctx.
 		Level(context.Trace).
@@ -285,17 +665,69 @@ func (d Driver) Create(request *v.CreateRequest) (err error) {
 	d.Lock()
 	defer d.Unlock()
 
+	// Validation: policies - total size of matching volumes is only stable while holding the lock
+	{
+		ctx.
+			Level(context.Trace).
+			Message("enforcing policies")
+		spec := volumeSpec{name: request.Name, size: sizeInBytes, fs: fs, sparse: sparse, uid: uid, gid: gid, mode: mode}
+		err = d.enforcePolicies(ctx.Derived(), &spec, request.Options, ep.Policies)
+		if err != nil {
+			return
+		}
+		uid, gid, mode = spec.uid, spec.gid, spec.mode
+	}
+
+	// Validation: tenant quota
+	tenantName := d.tenantOf(request.Name, manager.Metadata{Tenant: request.Options["tenant"]})
+	{
+		ctx.
+			Level(context.Trace).
+			Field("tenant", tenantName).
+			Message("enforcing tenant quota")
+		allocated := sizeInBytes
+		if sparse {
+			allocated = 0 // sparse volumes do not claim disk space upfront
+		}
+		err = d.enforceQuota(ctx.Derived(), tenantName, 1, sizeInBytes, allocated)
+		if err != nil {
+			return
+		}
+	}
+
 	ctx.
 		Level(context.Trace).
 		Message("starting processing")
 
 	// Processing
-	err = d.manager.Create(ctx.Derived(), request.Name, sizeInBytes, sparse, fs, uid, gid, mode)
+	err = d.manager.Create(ctx.Derived(), request.Name, sizeInBytes, manager.Metadata{
+		Sparse:       sparse,
+		Fs:           fs,
+		Uid:          uid,
+		Gid:          gid,
+		Mode:         mode,
+		SecureDelete: secureDelete,
+		Protected:    protected,
+		TTL:          ttl,
+		Reserve:      reserve,
+		Profile:      request.Options["profile"],
+		Tenant:       request.Options["tenant"],
+		Endpoint:     ep.Name,
+	}, pool.Name)
 
 	return
 }
 
-func (d Driver) List() (response *v.ListResponse, err error) {
+func (d *Driver) List() (*v.ListResponse, error) {
+	return d.list(EndpointConfig{})
+}
+
+// ListAll lists volumes of every endpoint unlike List that only lists ones created through the plugin socket
+func (d *Driver) ListAll() (*v.ListResponse, error) {
+	return d.list(allEndpoints)
+}
+
+func (d *Driver) list(ep EndpointConfig) (response *v.ListResponse, err error) {
 	// Context definition
 	ctx := context.New().
 		Field(":func", "driver/List")
@@ -304,15 +736,17 @@ func (d Driver) List() (response *v.ListResponse, err error) {
 
 		initial.
 			Level(context.Debug).
+			Field(":param/endpoint", ep.Name).
 			Message("invoked")
 
 		defer func() {
+			initial.Finish(err)
 			if err != nil {
 				initial.
 					Level(context.Error).
 					Field(":return/err", err).
 					Message("failed with an error")
-				err = errors.Wrapf(err, initial.Trace)
+				err = errors.Wrap(err, initial.Trace)
 				return
 			} else {
 				initial.
@@ -352,17 +786,65 @@ func (d Driver) List() (response *v.ListResponse, err error) {
 
 	// Response handling
 	response = new(v.ListResponse)
-	response.Volumes = make([]*v.Volume, len(volumes))
-	for idx, vol := range volumes {
-		response.Volumes[idx] = &v.Volume{
-			Name: vol,
+	response.Volumes = make([]*v.Volume, 0, len(volumes))
+	for _, name := range volumes {
+		volume := &v.Volume{
+			Name: name,
+		}
+
+		// volumes have to be retrieved to tell which endpoint they belong to
+		if !d.listStatus && (len(d.endpoints) == 0 || ep.Name == allEndpoints.Name) {
+			response.Volumes = append(response.Volumes, volume)
+			continue
+		}
+
+		ctx := ctx.Copy().
+			Field("volume", name)
+
+		vol, err := d.manager.Get(ctx.Derived(), name)
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("cannot retrieve volume - listing it without status")
+			response.Volumes = append(response.Volumes, volume)
+			continue
+		}
+		if checkEndpoint(ep, vol) != nil {
+			continue
+		}
+		response.Volumes = append(response.Volumes, volume)
+
+		if !d.listStatus {
+			continue
+		}
+
+		status, err := d.status(ctx.Derived(), vol)
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("cannot describe volume - listing it without status")
+			continue
 		}
+
+		volume.Mountpoint = vol.MountPointPath
+		volume.Status = status
 	}
 
 	return
 }
 
-func (d Driver) Get(request *v.GetRequest) (response *v.GetResponse, err error) {
+func (d *Driver) Get(request *v.GetRequest) (*v.GetResponse, error) {
+	return d.get(EndpointConfig{}, request)
+}
+
+// Inspect describes a volume regardless of the endpoint it was created through unlike Get
+func (d *Driver) Inspect(name string) (*v.GetResponse, error) {
+	return d.get(allEndpoints, &v.GetRequest{Name: name})
+}
+
+func (d *Driver) get(ep EndpointConfig, request *v.GetRequest) (response *v.GetResponse, err error) {
 	// Context definition
 	ctx := context.New().
 		Field(":func", "driver/Get")
@@ -372,15 +854,17 @@ func (d Driver) Get(request *v.GetRequest) (response *v.GetResponse, err error)
 		initial.
 			Level(context.Debug).
 			Field(":param/request", request).
+			Field(":param/endpoint", ep.Name).
 			Message("invoked")
 
 		defer func() {
+			initial.Finish(err)
 			if err != nil {
 				initial.
 					Level(context.Error).
 					Field(":return/err", err).
 					Message("failed with an error")
-				err = errors.Wrapf(err, initial.Trace)
+				err = errors.Wrap(err, initial.Trace)
 				return
 			} else {
 				initial.
@@ -412,7 +896,14 @@ func (d Driver) Get(request *v.GetRequest) (response *v.GetResponse, err error)
 	if err != nil {
 		return
 	}
-	fs, err := vol.Fs(ctx.Derived())
+	err = checkEndpoint(ep, vol)
+	if err != nil {
+		return
+	}
+	status, err := d.status(ctx.Derived(), vol)
+	if err != nil {
+		return
+	}
 
 	ctx.
 		Level(context.Trace).
@@ -422,19 +913,95 @@ func (d Driver) Get(request *v.GetRequest) (response *v.GetResponse, err error)
 	response = new(v.GetResponse)
 	response.Volume = &v.Volume{
 		Name:       request.Name,
-		CreatedAt:  fmt.Sprintf(vol.CreatedAt.Format(time.RFC3339)),
+		CreatedAt:  vol.CreatedAt.Format(time.RFC3339),
 		Mountpoint: vol.MountPointPath,
-		Status: map[string]interface{}{
-			"fs":             fs,
-			"size-max":       strconv.FormatUint(vol.MaxSizeInBytes, 10),
-			"size-allocated": strconv.FormatUint(vol.AllocatedSizeInBytes, 10),
-		},
+		Status:     status,
 	}
 
 	return
 }
 
-func (d Driver) Remove(request *v.RemoveRequest) (err error) {
+// status describes volume for 'Status' field of API responses
+func (d *Driver) status(ctx *context.Context, vol manager.Volume) (status map[string]interface{}, err error) {
+	ctx = ctx.
+		Field(":func", "driver/status").
+		Field("volume", vol.Name)
+
+	fs, _ := vol.Fs(ctx.Derived())
+
+	leases, err := vol.Leases(ctx.Derived())
+	if err != nil {
+		return
+	}
+
+	status = map[string]interface{}{
+		"pool":           vol.Pool,
+		"fs":             fs,
+		"sparse":         strconv.FormatBool(vol.Metadata.Sparse),
+		"size-max":       strconv.FormatUint(vol.MaxSizeInBytes, 10),
+		"size-allocated": strconv.FormatUint(vol.AllocatedSizeInBytes, 10),
+		"protected":      strconv.FormatBool(vol.Metadata.Protected),
+		"leases":         strconv.Itoa(len(leases)),
+		"lease-ids":      strings.Join(leases, ","),
+	}
+	if tenantName := d.tenantOf(vol.Name, vol.Metadata); tenantName != "" {
+		status["tenant"] = tenantName
+	}
+	if vol.Metadata.Profile != "" {
+		status["profile"] = vol.Metadata.Profile
+	}
+	if vol.Metadata.Endpoint != "" {
+		status["endpoint"] = vol.Metadata.Endpoint
+	}
+	if vol.Metadata.PendingMove != "" {
+		status["pending-move"] = vol.Metadata.PendingMove
+	}
+	status["archived"] = strconv.FormatBool(vol.IsArchived())
+	if vol.IsArchived() {
+		status["archived-at"] = vol.Metadata.ArchivedAt.Format(time.RFC3339)
+	}
+	if expiresAt, expires := vol.ExpiresAt(); expires {
+		status["ttl"] = vol.Metadata.TTL.String()
+		status["expires-at"] = expiresAt.Format(time.RFC3339)
+	}
+	if d.space.enabled() {
+		status["data-dir-space"] = d.space.poolState(vol.Pool).state
+		_, remounted := d.space.remounted[vol.Name]
+		status["read-only"] = strconv.FormatBool(remounted)
+	}
+
+	if len(leases) == 0 {
+		return
+	}
+
+	ctx.
+		Level(context.Trace).
+		Message("volume is mounted - collecting usage statistics")
+
+	device, err := vol.LoopDevice(ctx.Derived())
+	if err != nil {
+		return
+	}
+	status["loop-device"] = device
+
+	usage, err := vol.Usage(ctx.Derived())
+	if err != nil {
+		return
+	}
+	status["fs-bytes-used"] = strconv.FormatUint(usage.BytesUsed, 10)
+	status["fs-bytes-free"] = strconv.FormatUint(usage.BytesFree, 10)
+	status["fs-inodes-used"] = strconv.FormatUint(usage.InodesUsed, 10)
+	status["fs-inodes-free"] = strconv.FormatUint(usage.InodesFree, 10)
+	status["fs-used-percent"] = strconv.FormatFloat(usage.PercentUsed, 'f', 1, 64)
+
+	return
+}
+
+func (d *Driver) Remove(request *v.RemoveRequest) error {
+	return d.remove(EndpointConfig{}, request)
+}
+
+func (d *Driver) remove(ep EndpointConfig, request *v.RemoveRequest) (err error) {
 	// Context definition
 	ctx := context.New().
 		Field(":func", "driver/Remove")
@@ -444,15 +1011,17 @@ func (d Driver) Remove(request *v.RemoveRequest) (err error) {
 		initial.
 			Level(context.Debug).
 			Field(":param/request", request).
+			Field(":param/endpoint", ep.Name).
 			Message("invoked")
 
 		defer func() {
+			initial.Finish(err)
 			if err != nil {
 				initial.
 					Level(context.Error).
 					Field(":return/err", err).
 					Message("failed with an error")
-				err = errors.Wrapf(err, initial.Trace)
+				err = errors.Wrap(err, initial.Trace)
 				return
 			} else {
 				initial.
@@ -479,12 +1048,24 @@ func (d Driver) Remove(request *v.RemoveRequest) (err error) {
 		Message("starting processing")
 
 	// Processing
-	err = d.manager.Delete(ctx.Derived(), request.Name)
+	vol, err := d.manager.Get(ctx.Derived(), request.Name)
+	if err != nil {
+		return
+	}
+	err = checkEndpoint(ep, vol)
+	if err != nil {
+		return
+	}
+	err = d.manager.Delete(ctx.Derived(), request.Name, d)
 
 	return
 }
 
-func (d Driver) Path(request *v.PathRequest) (response *v.PathResponse, err error) {
+func (d *Driver) Path(request *v.PathRequest) (*v.PathResponse, error) {
+	return d.path(EndpointConfig{}, request)
+}
+
+func (d *Driver) path(ep EndpointConfig, request *v.PathRequest) (response *v.PathResponse, err error) {
 	// Context definition
 	ctx := context.New().
 		Field(":func", "driver/Path")
@@ -494,15 +1075,17 @@ func (d Driver) Path(request *v.PathRequest) (response *v.PathResponse, err erro
 		initial.
 			Level(context.Debug).
 			Field(":param/request", request).
+			Field(":param/endpoint", ep.Name).
 			Message("invoked")
 
 		defer func() {
+			initial.Finish(err)
 			if err != nil {
 				initial.
 					Level(context.Error).
 					Field(":return/err", err).
 					Message("failed with an error")
-				err = errors.Wrapf(err, initial.Trace)
+				err = errors.Wrap(err, initial.Trace)
 				return
 			} else {
 				initial.
@@ -536,6 +1119,10 @@ func (d Driver) Path(request *v.PathRequest) (response *v.PathResponse, err erro
 	if err != nil {
 		return
 	}
+	err = checkEndpoint(ep, volume)
+	if err != nil {
+		return
+	}
 
 	ctx.
 		Level(context.Trace).
@@ -547,7 +1134,11 @@ func (d Driver) Path(request *v.PathRequest) (response *v.PathResponse, err erro
 	return
 }
 
-func (d Driver) Mount(request *v.MountRequest) (response *v.MountResponse, err error) {
+func (d *Driver) Mount(request *v.MountRequest) (*v.MountResponse, error) {
+	return d.mount(EndpointConfig{}, request)
+}
+
+func (d *Driver) mount(ep EndpointConfig, request *v.MountRequest) (response *v.MountResponse, err error) {
 	// Context definition
 	ctx := context.New().
 		Field(":func", "driver/Mount")
@@ -557,15 +1148,17 @@ func (d Driver) Mount(request *v.MountRequest) (response *v.MountResponse, err e
 		initial.
 			Level(context.Debug).
 			Field(":param/request", request).
+			Field(":param/endpoint", ep.Name).
 			Message("invoked")
 
 		defer func() {
+			initial.Finish(err)
 			if err != nil {
 				initial.
 					Level(context.Error).
 					Field(":return/err", err).
 					Message("failed with an error")
-				err = errors.Wrapf(err, initial.Trace)
+				err = errors.Wrap(err, initial.Trace)
 				return
 			} else {
 				initial.
@@ -594,7 +1187,29 @@ func (d Driver) Mount(request *v.MountRequest) (response *v.MountResponse, err e
 		Level(context.Trace).
 		Message("starting processing")
 
-	entrypoint, err := d.manager.Mount(ctx.Derived(), request.Name, request.ID)
+	vol, err := d.manager.Get(ctx.Derived(), request.Name)
+	if err != nil {
+		return
+	}
+	err = checkEndpoint(ep, vol)
+	if err != nil {
+		return
+	}
+
+	if d.space.anyCritical() {
+		ctx.
+			Level(context.Trace).
+			Message("data dir free space is critical - checking whether volume is sparse and in that data dir")
+		space := d.space.poolState(vol.Pool)
+		if vol.Metadata.Sparse && space.state == SpaceCritical {
+			err = errors.Wrapf(manager.ErrCapacity,
+				"cannot mount sparse volume '%s' while data dir of pool '%s' is critically low on free space (%d bytes available)",
+				request.Name, vol.Pool, space.available)
+			return
+		}
+	}
+
+	entrypoint, err := d.manager.Mount(ctx.Derived(), request.Name, request.ID, d)
 	if err != nil {
 		return
 	}
@@ -610,7 +1225,11 @@ func (d Driver) Mount(request *v.MountRequest) (response *v.MountResponse, err e
 	return
 }
 
-func (d Driver) Unmount(request *v.UnmountRequest) (err error) {
+func (d *Driver) Unmount(request *v.UnmountRequest) error {
+	return d.unmount(EndpointConfig{}, request)
+}
+
+func (d *Driver) unmount(ep EndpointConfig, request *v.UnmountRequest) (err error) {
 	// Context definition
 	ctx := context.New().
 		Field(":func", "driver/Unmount")
@@ -620,15 +1239,17 @@ func (d Driver) Unmount(request *v.UnmountRequest) (err error) {
 		initial.
 			Level(context.Debug).
 			Field(":param/request", request).
+			Field(":param/endpoint", ep.Name).
 			Message("invoked")
 
 		defer func() {
+			initial.Finish(err)
 			if err != nil {
 				initial.
 					Level(context.Error).
 					Field(":return/err", err).
 					Message("failed with an error")
-				err = errors.Wrapf(err, initial.Trace)
+				err = errors.Wrap(err, initial.Trace)
 				return
 			} else {
 				initial.
@@ -656,7 +1277,15 @@ func (d Driver) Unmount(request *v.UnmountRequest) (err error) {
 		Message("starting processing")
 
 	// Processing
-	err = d.manager.UnMount(ctx.Derived(), request.Name, request.ID)
+	vol, err := d.manager.Get(ctx.Derived(), request.Name)
+	if err != nil {
+		return
+	}
+	err = checkEndpoint(ep, vol)
+	if err != nil {
+		return
+	}
+	err = d.manager.UnMount(ctx.Derived(), request.Name, request.ID, d)
 	if err != nil {
 		return
 	}
@@ -664,7 +1293,7 @@ func (d Driver) Unmount(request *v.UnmountRequest) (err error) {
 	return
 }
 
-func (d Driver) Capabilities() *v.CapabilitiesResponse {
+func (d *Driver) Capabilities() *v.CapabilitiesResponse {
 	return &v.CapabilitiesResponse{
 		Capabilities: v.Capability{
 			Scope: "local",
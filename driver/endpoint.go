@@ -0,0 +1,140 @@
+package driver
+
+import (
+	"strings"
+
+	"github.com/ashald/docker-volume-loopback/manager"
+	v "github.com/docker/go-plugins-helpers/volume"
+	"github.com/pkg/errors"
+)
+
+// EndpointConfig describes an additional plugin socket served by the same driver under another driver name. Volumes
+// created through an endpoint get its defaults and are only visible through it.
+type EndpointConfig struct {
+	Name        string   // volumes created through the endpoint are tagged with it
+	DefaultSize string   // empty to use the driver-wide default
+	Fs          string   // empty to use the default of volume's pool
+	Pool        string   // empty to place volumes automatically
+	Policies    []string // names of the only policies that apply to volumes of the endpoint, empty for all of them
+}
+
+// Endpoint serves Docker volume plugin protocol for volumes of an endpoint sharing the manager and the lock of a driver
+type Endpoint struct {
+	driver *Driver
+	config EndpointConfig
+}
+
+func validateEndpoints(configs []EndpointConfig, mgr *manager.Manager, policies []policy) (
+	endpoints map[string]EndpointConfig, err error) {
+	endpoints = make(map[string]EndpointConfig)
+	for _, cfg := range configs {
+		if !manager.NameRegex.MatchString(cfg.Name) {
+			err = errors.Errorf("endpoint name '%s' must match '%s'", cfg.Name, manager.NamePattern)
+			return
+		}
+		if _, duplicate := endpoints[cfg.Name]; duplicate {
+			err = errors.Errorf("endpoint '%s' is defined more than once", cfg.Name)
+			return
+		}
+
+		if cfg.DefaultSize != "" {
+			_, err = FromHumanSize(cfg.DefaultSize)
+			if err != nil {
+				err = errors.Wrapf(err,
+					"cannot convert 'default-size' value '%s' of endpoint '%s' into bytes", cfg.DefaultSize, cfg.Name)
+				return
+			}
+		}
+
+		cfg.Fs = strings.ToLower(strings.TrimSpace(cfg.Fs))
+		if _, ok := manager.MkFsOptions[cfg.Fs]; cfg.Fs != "" && !ok {
+			err = errors.Errorf("'fs' of endpoint '%s' must be either xfs or ext4, '%s' given", cfg.Name, cfg.Fs)
+			return
+		}
+
+		if cfg.Pool != "" {
+			_, err = mgr.Pool(cfg.Pool)
+			if err != nil {
+				err = errors.Wrapf(err, "cannot use 'pool' of endpoint '%s'", cfg.Name)
+				return
+			}
+		}
+
+		err = checkEndpointPolicies(cfg, policies)
+		if err != nil {
+			return
+		}
+
+		endpoints[cfg.Name] = cfg
+	}
+	return
+}
+
+// checkEndpointPolicies makes sure that policies referred to by an endpoint exist
+func checkEndpointPolicies(cfg EndpointConfig, policies []policy) error {
+	for _, name := range cfg.Policies {
+		exists := false
+		for _, p := range policies {
+			exists = exists || p.Name == name
+		}
+		if !exists {
+			return errors.Errorf("policy '%s' of endpoint '%s' does not exist", name, cfg.Name)
+		}
+	}
+	return nil
+}
+
+// allEndpoints stands for every endpoint when volumes are looked up from outside of Docker, e.g. by the admin API, its
+// name never matches an endpoint as it's not a valid volume name
+var allEndpoints = EndpointConfig{Name: "*"}
+
+// checkEndpoint hides volumes created through other endpoints
+func checkEndpoint(cfg EndpointConfig, vol manager.Volume) error {
+	if cfg.Name != allEndpoints.Name && vol.Metadata.Endpoint != cfg.Name {
+		return errors.Wrapf(manager.ErrNotFound, "volume '%s' does not exist", vol.Name)
+	}
+	return nil
+}
+
+// Endpoint returns an endpoint defined in driver config by its name
+func (d *Driver) Endpoint(name string) (endpoint *Endpoint, err error) {
+	cfg, exists := d.endpoints[name]
+	if !exists {
+		err = errors.Errorf("endpoint '%s' does not exist", name)
+		return
+	}
+	endpoint = &Endpoint{driver: d, config: cfg}
+	return
+}
+
+func (e *Endpoint) Create(request *v.CreateRequest) error {
+	return e.driver.create(e.config, request)
+}
+
+func (e *Endpoint) List() (*v.ListResponse, error) {
+	return e.driver.list(e.config)
+}
+
+func (e *Endpoint) Get(request *v.GetRequest) (*v.GetResponse, error) {
+	return e.driver.get(e.config, request)
+}
+
+func (e *Endpoint) Remove(request *v.RemoveRequest) error {
+	return e.driver.remove(e.config, request)
+}
+
+func (e *Endpoint) Path(request *v.PathRequest) (*v.PathResponse, error) {
+	return e.driver.path(e.config, request)
+}
+
+func (e *Endpoint) Mount(request *v.MountRequest) (*v.MountResponse, error) {
+	return e.driver.mount(e.config, request)
+}
+
+func (e *Endpoint) Unmount(request *v.UnmountRequest) error {
+	return e.driver.unmount(e.config, request)
+}
+
+func (e *Endpoint) Capabilities() *v.CapabilitiesResponse {
+	return e.driver.Capabilities()
+}
@@ -0,0 +1,78 @@
+package driver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+)
+
+// Health checks that volumes of every pool can be listed and summarizes their state in a line of text. Volumes are
+// only inspected if the lock can be acquired within the timeout so that a long running operation does not fail
+// the check.
+func (d *Driver) Health(timeout time.Duration) (summary string, err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Health")
+
+	// Processing
+	names, err := d.manager.List(ctx.Derived())
+	if err != nil {
+		err = errors.Wrap(err, "cannot list volumes")
+		return
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	if !d.lockWithin(timeout) {
+		summary = fmt.Sprintf("%d volumes, busy", len(names))
+		return
+	}
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("counting mounted volumes")
+
+	mounted := 0
+	for _, name := range names {
+		vol, errGet := d.manager.Get(ctx.Derived(), name)
+		if errGet != nil {
+			continue
+		}
+		leases, errLeases := vol.Leases(ctx.Derived())
+		if errLeases == nil && len(leases) > 0 {
+			mounted++
+		}
+	}
+
+	summary = fmt.Sprintf("%d volumes, %d mounted", len(names), mounted)
+	if d.space.anyCritical() {
+		summary += ", data dir free space is critical"
+	}
+	return
+}
+
+// lockWithin acquires the lock unless it takes longer than the timeout, in which case the lock is released as soon as
+// it's eventually acquired
+func (d *Driver) lockWithin(timeout time.Duration) bool {
+	locked := make(chan struct{})
+	go func() {
+		d.Lock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return true
+	case <-time.After(timeout):
+		go func() {
+			<-locked
+			d.Unlock()
+		}()
+		return false
+	}
+}
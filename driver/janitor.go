@@ -0,0 +1,193 @@
+package driver
+
+import (
+	"time"
+
+	"github.com/ashald/docker-volume-loopback/context"
+)
+
+func (d *Driver) runJanitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.removeExpired()
+			if d.archiveAfter > 0 {
+				d.archiveIdle()
+			}
+		}
+	}
+}
+
+// removeExpired deletes volumes whose TTL has run out and that have no leases
+func (d *Driver) removeExpired() {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/removeExpired")
+
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("looking for expired volumes")
+
+	names, err := d.manager.List(ctx.Derived())
+	if err != nil {
+		ctx.
+			Level(context.Error).
+			Field("err", err).
+			Message("cannot list volumes")
+		return
+	}
+
+	now := time.Now()
+	expiredProtected := make(map[string]struct{})
+	defer func() {
+		d.expiredProtected = expiredProtected
+	}()
+	for _, name := range names {
+		ctx := ctx.Copy().
+			Field("volume", name)
+
+		vol, err := d.manager.Get(ctx.Derived(), name)
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("cannot retrieve volume to check its expiry")
+			continue
+		}
+
+		expiresAt, expires := vol.ExpiresAt()
+		if !expires || now.Before(expiresAt) {
+			continue
+		}
+
+		if vol.Metadata.Protected {
+			if _, logged := d.expiredProtected[name]; !logged {
+				ctx.
+					Level(context.Debug).
+					Message("expired volume is protected - skipping it until it's unprotected")
+			}
+			expiredProtected[name] = struct{}{}
+			continue
+		}
+
+		mounted, err := vol.IsMounted(ctx.Derived())
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("cannot check whether expired volume is in use")
+			continue
+		}
+		if mounted {
+			ctx.
+				Level(context.Debug).
+				Message("expired volume still has leases - skipping")
+			continue
+		}
+
+		// every deletion gets its own trace so that it can be looked up in logs
+		deletion := context.New().
+			Field(":func", "driver/removeExpired").
+			Field("volume", name).
+			Field("expires-at", expiresAt.Format(time.RFC3339))
+
+		err = d.manager.Delete(deletion.Derived(), name, d)
+		if err != nil {
+			deletion.
+				Level(context.Error).
+				Field("err", err).
+				Message("failed to delete expired volume")
+			continue
+		}
+
+		deletion.
+			Level(context.Info).
+			Message("deleted expired volume")
+	}
+}
+
+// archiveIdle compresses volumes that have not been mounted for longer than the configured period
+func (d *Driver) archiveIdle() {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/archiveIdle")
+
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("looking for idle volumes")
+
+	names, err := d.manager.List(ctx.Derived())
+	if err != nil {
+		ctx.
+			Level(context.Error).
+			Field("err", err).
+			Message("cannot list volumes")
+		return
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		ctx := ctx.Copy().
+			Field("volume", name)
+
+		vol, err := d.manager.Get(ctx.Derived(), name)
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("cannot retrieve volume to check whether it's idle")
+			continue
+		}
+
+		idleSince := vol.IdleSince()
+		if vol.IsArchived() || now.Sub(idleSince) < d.archiveAfter {
+			continue
+		}
+
+		mounted, err := vol.IsMounted(ctx.Derived())
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("cannot check whether idle volume is in use")
+			continue
+		}
+		if mounted {
+			continue
+		}
+
+		// every archiving gets its own trace so that it can be looked up in logs
+		archiving := context.New().
+			Field(":func", "driver/archiveIdle").
+			Field("volume", name).
+			Field("idle-since", idleSince.Format(time.RFC3339))
+
+		err = d.manager.Archive(archiving.Derived(), name)
+		if err != nil {
+			archiving.
+				Level(context.Error).
+				Field("err", err).
+				Message("failed to archive idle volume")
+			continue
+		}
+	}
+}
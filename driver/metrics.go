@@ -0,0 +1,102 @@
+package driver
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/ashald/docker-volume-loopback/metrics"
+)
+
+// Metrics describes volumes and data dir for the metrics endpoint, it matches metrics.Collector signature
+func (d *Driver) Metrics() (families []metrics.Family) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Metrics")
+
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("collecting metrics")
+
+	gauge := func(name, help string) *metrics.Family {
+		return &metrics.Family{Name: metrics.Namespace + "_" + name, Help: help, Type: metrics.Gauge}
+	}
+
+	var (
+		volumes   = gauge("volumes", "Number of volumes.")
+		mounted   = gauge("volumes_mounted", "Number of volumes mounted for at least one lease.")
+		total     = gauge("data_dir_size_bytes", "Capacity of the filesystem data dir of a pool resides on.")
+		available = gauge("data_dir_available_bytes", "Free space available in data dir of a pool.")
+		size      = gauge("volume_size_bytes", "Max size of a volume.")
+		allocated = gauge("volume_allocated_bytes", "Disk space allocated for a volume data file.")
+		used      = gauge("volume_used_bytes", "Space used by filesystem inside a mounted volume.")
+		free      = gauge("volume_free_bytes", "Space available to filesystem inside a mounted volume.")
+		leases    = gauge("volume_leases", "Number of leases held on a volume.")
+	)
+
+	for _, pool := range d.manager.Pools() {
+		dataDirTotal, dataDirAvailable, err := d.manager.DiskSpace(ctx.Derived(), pool.Name)
+		if err != nil {
+			continue
+		}
+		labels := metrics.Labels{"pool": pool.Name}
+		total.Samples = append(total.Samples, metrics.Sample{Labels: labels, Value: float64(dataDirTotal)})
+		available.Samples = append(available.Samples, metrics.Sample{Labels: labels, Value: float64(dataDirAvailable)})
+	}
+
+	names, err := d.manager.List(ctx.Derived())
+	if err != nil {
+		ctx.
+			Level(context.Error).
+			Field("err", err).
+			Message("cannot list volumes")
+	}
+
+	mountedCount := 0
+	for _, name := range names {
+		ctx := ctx.Copy().
+			Field("volume", name)
+
+		vol, err := d.manager.Get(ctx.Derived(), name)
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("cannot retrieve volume - skipping it")
+			continue
+		}
+
+		labels := metrics.Labels{"volume": name}
+		size.Samples = append(size.Samples, metrics.Sample{Labels: labels, Value: float64(vol.MaxSizeInBytes)})
+		allocated.Samples = append(allocated.Samples,
+			metrics.Sample{Labels: labels, Value: float64(vol.AllocatedSizeInBytes)})
+
+		volumeLeases, err := vol.Leases(ctx.Derived())
+		if err != nil {
+			continue
+		}
+		leases.Samples = append(leases.Samples, metrics.Sample{Labels: labels, Value: float64(len(volumeLeases))})
+		if len(volumeLeases) == 0 {
+			continue
+		}
+		mountedCount++
+
+		usage, err := vol.Usage(ctx.Derived())
+		if err != nil {
+			continue
+		}
+		used.Samples = append(used.Samples, metrics.Sample{Labels: labels, Value: float64(usage.BytesUsed)})
+		free.Samples = append(free.Samples, metrics.Sample{Labels: labels, Value: float64(usage.BytesFree)})
+	}
+	volumes.Samples = append(volumes.Samples, metrics.Sample{Value: float64(len(names))})
+	mounted.Samples = append(mounted.Samples, metrics.Sample{Value: float64(mountedCount)})
+
+	for _, family := range []*metrics.Family{volumes, mounted, total, available, size, allocated, used, free, leases} {
+		families = append(families, *family)
+	}
+	return
+}
@@ -0,0 +1,221 @@
+package driver
+
+import (
+	"time"
+
+	"github.com/ashald/docker-volume-loopback/context"
+)
+
+// Data dir free space states
+const (
+	SpaceOk       = "ok"
+	SpaceWarning  = "warning"
+	SpaceCritical = "critical"
+)
+
+// spaceMonitor keeps track of data dirs free space so that sparse volumes are not written to once it runs out
+type spaceMonitor struct {
+	warning   int64 // bytes available at or below which state becomes 'warning', 0 to disable
+	critical  int64 // bytes available at or below which state becomes 'critical', 0 to disable
+	readOnly  bool  // whether sparse volumes should be re-mounted read-only in 'critical' state
+	pools     map[string]*poolSpace
+	remounted map[string]struct{} // volumes re-mounted read-only by the monitor
+}
+
+// poolSpace is the last known free space state of a pool's data dir
+type poolSpace struct {
+	state     string
+	available int64
+}
+
+func (s spaceMonitor) enabled() bool {
+	return s.warning > 0 || s.critical > 0
+}
+
+// poolState reports state of a pool that was not checked yet as 'ok'
+func (s spaceMonitor) poolState(pool string) poolSpace {
+	if space, known := s.pools[pool]; known {
+		return *space
+	}
+	return poolSpace{state: SpaceOk}
+}
+
+func (s spaceMonitor) anyCritical() bool {
+	for _, space := range s.pools {
+		if space.state == SpaceCritical {
+			return true
+		}
+	}
+	return false
+}
+
+func (s spaceMonitor) stateFor(available int64) string {
+	switch {
+	case s.critical > 0 && available <= s.critical:
+		return SpaceCritical
+	case s.warning > 0 && available <= s.warning:
+		return SpaceWarning
+	default:
+		return SpaceOk
+	}
+}
+
+func (d *Driver) runSpaceMonitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	d.checkSpace()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.checkSpace()
+		}
+	}
+}
+
+// checkSpace re-evaluates data dir free space state and (un)protects sparse volumes upon transitions
+func (d *Driver) checkSpace() {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/checkSpace")
+
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	for _, pool := range d.manager.Pools() {
+		ctx := ctx.Copy().
+			Field("pool", pool.Name)
+
+		ctx.
+			Level(context.Trace).
+			Message("checking data dir free space")
+
+		_, available, err := d.manager.DiskSpace(ctx.Derived(), pool.Name)
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", err).
+				Message("cannot check data dir free space")
+			continue
+		}
+
+		previous := d.space.poolState(pool.Name).state
+		current := d.space.stateFor(available)
+		d.space.pools[pool.Name] = &poolSpace{state: current, available: available}
+
+		if current != previous {
+			level := context.Info
+			switch current {
+			case SpaceWarning:
+				level = context.Warning
+			case SpaceCritical:
+				level = context.Error
+			}
+			ctx.
+				Level(level).
+				Field("from", previous).
+				Field("to", current).
+				Field("available", available).
+				Message("data dir free space state changed")
+		}
+	}
+
+	if !d.space.readOnly {
+		return
+	}
+
+	if d.space.anyCritical() || len(d.space.remounted) > 0 {
+		d.remountSparse(ctx.Derived())
+	}
+}
+
+// remountSparse switches mounted sparse volumes in pools with critical free space to read-only mode and restores the
+// ones that were switched before once their pools recover
+func (d *Driver) remountSparse(ctx *context.Context) {
+	ctx = ctx.
+		Field(":func", "driver/remountSparse")
+
+	names, err := d.manager.List(ctx.Derived())
+	if err != nil {
+		ctx.
+			Level(context.Error).
+			Field("err", err).
+			Message("cannot list volumes")
+		return
+	}
+
+	for _, name := range names {
+		ctx := ctx.Copy().
+			Field("volume", name)
+
+		vol, err := d.manager.Get(ctx.Derived(), name)
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("cannot retrieve volume")
+			continue
+		}
+		if !vol.Metadata.Sparse {
+			continue
+		}
+
+		readOnly := d.space.poolState(vol.Pool).state == SpaceCritical
+		_, remounted := d.space.remounted[name]
+		if remounted == readOnly {
+			continue
+		}
+
+		mounted, err := vol.IsMounted(ctx.Derived())
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("cannot check whether volume is mounted")
+			continue
+		}
+		if !mounted {
+			delete(d.space.remounted, name)
+			continue
+		}
+
+		err = d.manager.Remount(ctx.Derived(), name, readOnly)
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", err).
+				Field("read-only", readOnly).
+				Message("cannot re-mount sparse volume")
+			continue
+		}
+
+		if readOnly {
+			d.space.remounted[name] = struct{}{}
+			ctx.
+				Level(context.Warning).
+				Message("re-mounted sparse volume read-only")
+		} else {
+			delete(d.space.remounted, name)
+			ctx.
+				Level(context.Info).
+				Message("re-mounted sparse volume read-write")
+		}
+	}
+
+	// forget volumes that no longer exist
+	existing := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		existing[name] = struct{}{}
+	}
+	for name := range d.space.remounted {
+		if _, ok := existing[name]; !ok {
+			delete(d.space.remounted, name)
+		}
+	}
+}
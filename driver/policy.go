@@ -0,0 +1,242 @@
+package driver
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/ashald/docker-volume-loopback/manager"
+	"github.com/pkg/errors"
+)
+
+// PolicyConfig restricts options of volumes whose names match a glob pattern, every matching policy applies
+type PolicyConfig struct {
+	Name         string
+	Match        string   // glob pattern for volume names, e.g. 'team-a-*'
+	MinSize      string   // empty for no limit
+	MaxSize      string   // empty for no limit
+	Fs           []string // allowed filesystems, empty for any
+	DenySparse   bool
+	Uid          *int   // forced owner of volume root, nil to leave it up to the request
+	Gid          *int   // forced group of volume root, nil to leave it up to the request
+	Mode         string // forced mode of volume root, empty to leave it up to the request
+	MaxTotalSize string // limit on total size of all matching volumes, empty for no limit
+}
+
+type policy struct {
+	PolicyConfig
+	minSize, maxSize, maxTotalSize int64
+	mode                           uint32
+}
+
+// volumeSpec describes a volume that is about to be created or changed so that it can be checked against policies
+type volumeSpec struct {
+	name     string
+	size     int64
+	fs       string
+	sparse   bool
+	uid      int
+	gid      int
+	mode     uint32
+	replaces string // existing volume the spec stands for, it's left out of total size of matching volumes
+	sizeOnly bool   // only size limits apply, e.g. to a volume being resized
+}
+
+// existingVolumeSpec describes an existing volume under a given name along with options that make sure its credentials
+// are checked against forced ones as they cannot be changed, and policies of the endpoint it was created through
+func (d *Driver) existingVolumeSpec(name string, vol manager.Volume) (spec volumeSpec, options map[string]string,
+	only []string) {
+	spec = volumeSpec{
+		name:   name,
+		size:   int64(vol.MaxSizeInBytes),
+		fs:     vol.Metadata.Fs,
+		sparse: vol.Metadata.Sparse,
+		uid:    vol.Metadata.Uid,
+		gid:    vol.Metadata.Gid,
+		mode:   vol.Metadata.Mode,
+	}
+	options = map[string]string{"uid": "", "gid": "", "mode": ""}
+	only = d.endpoints[vol.Metadata.Endpoint].Policies
+	return
+}
+
+func validatePolicies(configs []PolicyConfig) (policies []policy, err error) {
+	names := make(map[string]struct{})
+	for _, cfg := range configs {
+		p := policy{PolicyConfig: cfg}
+		p.Fs = append([]string(nil), cfg.Fs...)
+
+		if !manager.NameRegex.MatchString(cfg.Name) {
+			err = errors.Errorf("policy name '%s' must match '%s'", cfg.Name, manager.NamePattern)
+			return
+		}
+		if _, duplicate := names[cfg.Name]; duplicate {
+			err = errors.Errorf("policy '%s' is defined more than once", cfg.Name)
+			return
+		}
+		names[cfg.Name] = struct{}{}
+
+		if _, err = path.Match(cfg.Match, ""); err != nil || cfg.Match == "" {
+			err = errors.Errorf("'match' pattern '%s' of policy '%s' is not a valid glob", cfg.Match, cfg.Name)
+			return
+		}
+
+		for _, size := range []struct {
+			key   string
+			value string
+			bytes *int64
+		}{
+			{"min-size", cfg.MinSize, &p.minSize},
+			{"max-size", cfg.MaxSize, &p.maxSize},
+			{"max-total-size", cfg.MaxTotalSize, &p.maxTotalSize},
+		} {
+			if size.value == "" {
+				continue
+			}
+			*size.bytes, err = FromHumanSize(size.value)
+			if err != nil {
+				err = errors.Wrapf(err, "cannot convert '%s' value '%s' of policy '%s' into bytes", size.key, size.value, cfg.Name)
+				return
+			}
+		}
+		if p.maxSize > 0 && p.minSize > p.maxSize {
+			err = errors.Errorf("'min-size' of policy '%s' is greater than its 'max-size'", cfg.Name)
+			return
+		}
+
+		for idx, fs := range cfg.Fs {
+			fs = strings.ToLower(strings.TrimSpace(fs))
+			if _, ok := manager.MkFsOptions[fs]; !ok {
+				err = errors.Errorf("'fs' of policy '%s' must be either xfs or ext4, '%s' given", cfg.Name, fs)
+				return
+			}
+			p.Fs[idx] = fs
+		}
+
+		if (cfg.Uid != nil && *cfg.Uid < 0) || (cfg.Gid != nil && *cfg.Gid < 0) {
+			err = errors.Errorf("'uid' and 'gid' of policy '%s' must not be negative", cfg.Name)
+			return
+		}
+		if cfg.Mode != "" {
+			var mode uint64
+			mode, err = strconv.ParseUint(cfg.Mode, 8, 32)
+			if err != nil || mode <= 0 || mode > 07777 {
+				err = errors.Errorf("'mode' of policy '%s' does not fall between 0 and 7777 in octal encoding", cfg.Name)
+				return
+			}
+			p.mode = uint32(mode)
+		}
+
+		policies = append(policies, p)
+	}
+	return
+}
+
+// enforcePolicies rejects a volume that breaks any of the policies matching its name and applies forced credentials.
+// Only policies named in 'only' apply unless it's empty. It has to be called with the main lock held so that total
+// size of matching volumes cannot change meanwhile.
+func (d *Driver) enforcePolicies(
+	ctx *context.Context, spec *volumeSpec, options map[string]string, only []string) (err error) {
+	d.settingsLock.RLock()
+	policies := d.policies
+	d.settingsLock.RUnlock()
+
+	for _, p := range policies {
+		if len(only) > 0 && !contains(only, p.Name) {
+			continue
+		}
+		if matched, _ := path.Match(p.Match, spec.name); !matched {
+			continue
+		}
+
+		ctx := ctx.Copy().
+			Field("policy", p.Name)
+		ctx.
+			Level(context.Debug).
+			Message("volume matches policy")
+
+		broken := func(format string, args ...interface{}) error {
+			return errors.Wrapf(manager.ErrInvalid,
+				"volume '%s' breaks policy '%s': %s", spec.name, p.Name, fmt.Sprintf(format, args...))
+		}
+
+		if p.minSize > 0 && spec.size < p.minSize {
+			return broken("size of %d bytes is less than min size of %d bytes", spec.size, p.minSize)
+		}
+		if p.maxSize > 0 && spec.size > p.maxSize {
+			return broken("size of %d bytes exceeds max size of %d bytes", spec.size, p.maxSize)
+		}
+
+		if !spec.sizeOnly {
+			if len(p.Fs) > 0 && !contains(p.Fs, spec.fs) {
+				return broken("fs '%s' is not among allowed ones: %s", spec.fs, strings.Join(p.Fs, ", "))
+			}
+			if p.DenySparse && spec.sparse {
+				return broken("sparse volumes are not allowed")
+			}
+
+			if p.Uid != nil {
+				if _, present := options["uid"]; present && spec.uid != *p.Uid {
+					return broken("uid is forced to be %d", *p.Uid)
+				}
+				spec.uid = *p.Uid
+			}
+			if p.Gid != nil {
+				if _, present := options["gid"]; present && spec.gid != *p.Gid {
+					return broken("gid is forced to be %d", *p.Gid)
+				}
+				spec.gid = *p.Gid
+			}
+			if p.Mode != "" {
+				if _, present := options["mode"]; present && spec.mode != p.mode {
+					return broken("mode is forced to be %s", p.Mode)
+				}
+				spec.mode = p.mode
+			}
+		}
+
+		if p.maxTotalSize > 0 {
+			var total int64
+			total, err = d.totalSize(ctx.Derived(), p.Match, spec.replaces)
+			if err != nil {
+				return errors.Wrapf(err, "cannot check total size of volumes matching policy '%s'", p.Name)
+			}
+			if total+spec.size > p.maxTotalSize {
+				return broken("volumes would add up to %d bytes while max total size is %d bytes", total+spec.size, p.maxTotalSize)
+			}
+		}
+	}
+
+	return
+}
+
+// totalSize adds up sizes of existing volumes whose names match a glob pattern but the excluded one
+func (d *Driver) totalSize(ctx *context.Context, pattern string, exclude string) (total int64, err error) {
+	names, err := d.manager.List(ctx.Derived())
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		if matched, _ := path.Match(pattern, name); !matched || name == exclude {
+			continue
+		}
+		var vol manager.Volume
+		vol, err = d.manager.Get(ctx.Derived(), name)
+		if err != nil {
+			return
+		}
+		total += int64(vol.MaxSizeInBytes)
+	}
+	return
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package driver
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/ashald/docker-volume-loopback/manager"
+	"github.com/pkg/errors"
+)
+
+// ProfileConfig bundles create options under a name that can be selected with 'profile' option
+type ProfileConfig struct {
+	Name     string
+	Defaults map[string]string // options applied unless given explicitly
+	Enforced map[string]string // options that cannot be given explicitly with a different value
+}
+
+// validateProfiles checks that profiles have unique names and only bundle options that are allowed on creation
+func validateProfiles(profiles []ProfileConfig) (byName map[string]ProfileConfig, err error) {
+	allowedOptionsSet := make(map[string]struct{})
+	for _, option := range AllowedOptions {
+		if option != "profile" {
+			allowedOptionsSet[option] = struct{}{}
+		}
+	}
+
+	byName = make(map[string]ProfileConfig)
+	for _, profile := range profiles {
+		if !manager.NameRegex.MatchString(profile.Name) {
+			err = errors.Errorf("profile name '%s' must match '%s'", profile.Name, manager.NamePattern)
+			return
+		}
+		if _, duplicate := byName[profile.Name]; duplicate {
+			err = errors.Errorf("profile '%s' is defined more than once", profile.Name)
+			return
+		}
+
+		var wrongOptions []string
+		for option := range profile.Defaults {
+			if _, allowed := allowedOptionsSet[option]; !allowed {
+				wrongOptions = append(wrongOptions, option)
+			}
+		}
+		for option := range profile.Enforced {
+			if _, allowed := allowedOptionsSet[option]; !allowed {
+				wrongOptions = append(wrongOptions, option)
+			} else if _, both := profile.Defaults[option]; both {
+				err = errors.Errorf("option '%s' of profile '%s' is both a default and enforced", option, profile.Name)
+				return
+			}
+		}
+		if len(wrongOptions) > 0 {
+			sort.Strings(wrongOptions)
+			err = errors.Errorf(
+				"options '%s' of profile '%s' are not among supported ones: %s",
+				strings.Join(wrongOptions, ", "), profile.Name, strings.Join(AllowedOptions, ", "))
+			return
+		}
+
+		byName[profile.Name] = profile
+	}
+	return
+}
+
+// applyProfile resolves create options against the profile they select, options are returned as is without a profile
+func (d *Driver) applyProfile(ctx *context.Context, options map[string]string) (resolved map[string]string, err error) {
+	name := options["profile"]
+	if name == "" {
+		resolved = options
+		return
+	}
+
+	d.settingsLock.RLock()
+	profile, exists := d.profiles[name]
+	d.settingsLock.RUnlock()
+	if !exists {
+		err = errors.Wrapf(manager.ErrInvalid, "profile '%s' does not exist", name)
+		return
+	}
+
+	resolved = make(map[string]string, len(options)+len(profile.Defaults)+len(profile.Enforced))
+	for option, value := range options {
+		resolved[option] = value
+	}
+
+	for option, value := range profile.Enforced {
+		if given, present := options[option]; present && given != value {
+			err = errors.Wrapf(manager.ErrInvalid,
+				"option '%s' is enforced to be '%s' by profile '%s' but '%s' given", option, value, name, given)
+			return
+		}
+		resolved[option] = value
+	}
+
+	for option, value := range profile.Defaults {
+		if _, present := options[option]; !present {
+			ctx.
+				Level(context.Debug).
+				Field("option", option).
+				Field("value", value).
+				Message("using profile default")
+			resolved[option] = value
+		}
+	}
+
+	return
+}
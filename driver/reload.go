@@ -0,0 +1,154 @@
+package driver
+
+import (
+	"reflect"
+
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+)
+
+// Reload applies config fields that can be changed while the plugin is running, other fields are ignored.
+// Nothing is applied unless all of the fields are valid.
+func (d *Driver) Reload(cfg Config) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Reload")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/cfg", cfg).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Validation
+	{
+		ctx.
+			Level(context.Trace).
+			Field("DefaultSize", cfg.DefaultSize).
+			Message("validating 'DefaultSize' config field")
+		if cfg.DefaultSize == "" {
+			err = errors.Errorf("DefaultSize must be specified")
+			return
+		}
+		_, err = FromHumanSize(cfg.DefaultSize)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot convert 'DefaultSize' value '%s' into bytes", cfg.DefaultSize)
+			return
+		}
+	}
+	var profiles map[string]ProfileConfig
+	{
+		ctx.
+			Level(context.Trace).
+			Field("Profiles", cfg.Profiles).
+			Message("validating 'Profiles' config field")
+		profiles, err = validateProfiles(cfg.Profiles)
+		if err != nil {
+			return
+		}
+	}
+	var policies []policy
+	{
+		ctx.
+			Level(context.Trace).
+			Field("Policies", cfg.Policies).
+			Message("validating 'Policies' config field")
+		policies, err = validatePolicies(cfg.Policies)
+		if err != nil {
+			return
+		}
+		for _, endpoint := range d.endpoints {
+			err = checkEndpointPolicies(endpoint, policies)
+			if err != nil {
+				return
+			}
+		}
+	}
+	var tenants []tenant
+	{
+		ctx.
+			Level(context.Trace).
+			Field("Tenants", cfg.Tenants).
+			Message("validating 'Tenants' config field")
+		tenants, err = validateTenants(cfg.Tenants)
+		if err != nil {
+			return
+		}
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+	d.settingsLock.Lock()
+	defer d.settingsLock.Unlock()
+
+	// Processing
+	if cfg.DefaultSize != d.defaultSize {
+		ctx.
+			Level(context.Debug).
+			Field("old", d.defaultSize).
+			Field("new", cfg.DefaultSize).
+			Message("changed 'DefaultSize'")
+		d.defaultSize = cfg.DefaultSize
+	}
+
+	if cfg.ListStatus != d.listStatus {
+		ctx.
+			Level(context.Debug).
+			Field("old", d.listStatus).
+			Field("new", cfg.ListStatus).
+			Message("changed 'ListStatus'")
+		d.listStatus = cfg.ListStatus
+	}
+
+	if !reflect.DeepEqual(profiles, d.profiles) {
+		ctx.
+			Level(context.Debug).
+			Field("old", d.profiles).
+			Field("new", profiles).
+			Message("changed 'Profiles'")
+		d.profiles = profiles
+	}
+
+	if !reflect.DeepEqual(policies, d.policies) {
+		ctx.
+			Level(context.Debug).
+			Field("old", d.policies).
+			Field("new", policies).
+			Message("changed 'Policies'")
+		d.policies = policies
+	}
+
+	if !reflect.DeepEqual(tenants, d.tenants) {
+		ctx.
+			Level(context.Debug).
+			Field("old", d.tenants).
+			Field("new", tenants).
+			Message("changed 'Tenants'")
+		d.tenants = tenants
+	}
+
+	return
+}
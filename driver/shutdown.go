@@ -0,0 +1,97 @@
+package driver
+
+import (
+	"time"
+
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+)
+
+// Shutdown stops janitor and free space monitor, waits for operations in progress to finish and keeps new ones from
+// starting as the lock is never released. Secure erasures are cancelled right away so that volumes being deleted are
+// left in place. Creations, mounts, renames, fs conversions and moves that are still running by the deadline are
+// journaled and get rolled back on next start, other operations are left to 'gc'.
+func (d *Driver) Shutdown(timeout time.Duration, unmountIdle bool) (err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Shutdown")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/timeout", timeout.String()).
+			Field(":param/unmountIdle", unmountIdle).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Stopping background loops
+	{
+		ctx.
+			Level(context.Trace).
+			Message("stopping janitor and free space monitor")
+		d.stopOnce.Do(func() { close(d.stop) })
+	}
+
+	// Cancelling erasures
+	{
+		ctx.
+			Level(context.Trace).
+			Message("cancelling secure erasures in progress")
+		cancelled := d.manager.CancelErasures(ctx.Derived())
+		if len(cancelled) > 0 {
+			ctx.
+				Level(context.Warning).
+				Field("volumes", cancelled).
+				Message("volumes being erased are left in place")
+		}
+	}
+
+	// Handling locking
+	{
+		ctx.
+			Level(context.Trace).
+			Message("waiting for operations in progress")
+		if !d.lockWithin(timeout) {
+			err = errors.Errorf(
+				"operations are still in progress after %s - journaled ones will be rolled back on next start", timeout)
+			return
+		}
+	}
+
+	// Processing
+	if unmountIdle {
+		ctx.
+			Level(context.Trace).
+			Message("un-mounting volumes without leases")
+		var unmounted []string
+		unmounted, err = d.manager.UnmountIdle(ctx.Derived())
+		if err != nil {
+			return
+		}
+		if len(unmounted) > 0 {
+			ctx.
+				Level(context.Info).
+				Field("volumes", unmounted).
+				Message("un-mounted volumes without leases")
+		}
+	}
+
+	return
+}
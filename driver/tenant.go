@@ -0,0 +1,233 @@
+package driver
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/ashald/docker-volume-loopback/manager"
+	"github.com/pkg/errors"
+)
+
+// TenantConfig limits total capacity and number of volumes that belong to a tenant. A volume belongs to the tenant given
+// with 'tenant' option or, if there is none, to the one with the longest prefix of volume's name.
+type TenantConfig struct {
+	Name         string
+	Prefix       string // empty to only account volumes created with 'tenant' option
+	MaxSize      string // limit on total size of volumes, empty for no limit
+	MaxAllocated string // limit on total disk space allocated by volumes, empty for no limit
+	MaxVolumes   int    // limit on number of volumes, 0 for no limit
+}
+
+type tenant struct {
+	TenantConfig
+	maxSize, maxAllocated int64
+}
+
+// TenantUsage describes how much of its quota a tenant uses, limits of 0 mean there is no limit
+type TenantUsage struct {
+	Name         string
+	Volumes      int
+	Size         int64
+	Allocated    int64
+	MaxVolumes   int
+	MaxSize      int64
+	MaxAllocated int64
+}
+
+func validateTenants(configs []TenantConfig) (tenants []tenant, err error) {
+	names := make(map[string]struct{})
+	for _, cfg := range configs {
+		t := tenant{TenantConfig: cfg}
+
+		if !manager.NameRegex.MatchString(cfg.Name) {
+			err = errors.Errorf("tenant name '%s' must match '%s'", cfg.Name, manager.NamePattern)
+			return
+		}
+		if _, duplicate := names[cfg.Name]; duplicate {
+			err = errors.Errorf("tenant '%s' is defined more than once", cfg.Name)
+			return
+		}
+		names[cfg.Name] = struct{}{}
+
+		if cfg.MaxSize != "" {
+			t.maxSize, err = FromHumanSize(cfg.MaxSize)
+			if err != nil {
+				err = errors.Wrapf(err, "cannot convert 'max-size' value '%s' of tenant '%s' into bytes", cfg.MaxSize, cfg.Name)
+				return
+			}
+		}
+		if cfg.MaxAllocated != "" {
+			t.maxAllocated, err = FromHumanSize(cfg.MaxAllocated)
+			if err != nil {
+				err = errors.Wrapf(err,
+					"cannot convert 'max-allocated' value '%s' of tenant '%s' into bytes", cfg.MaxAllocated, cfg.Name)
+				return
+			}
+		}
+		if cfg.MaxVolumes < 0 {
+			err = errors.Errorf("'max-volumes' of tenant '%s' must not be negative", cfg.Name)
+			return
+		}
+
+		tenants = append(tenants, t)
+	}
+	return
+}
+
+// tenantOf resolves tenant of a volume, empty if the volume does not belong to any - a name prefix takes precedence
+// over the tenant the volume was created for so that renaming a volume into a prefix moves it to the prefix owner
+func (d *Driver) tenantOf(name string, metadata manager.Metadata) string {
+	if owner := d.prefixOwner(name); owner != "" {
+		return owner
+	}
+	return metadata.Tenant
+}
+
+// prefixOwner resolves the tenant with the longest prefix of a volume name, empty if no prefix matches
+func (d *Driver) prefixOwner(name string) string {
+	d.settingsLock.RLock()
+	defer d.settingsLock.RUnlock()
+
+	var owner tenant
+	for _, t := range d.tenants {
+		if t.Prefix != "" && strings.HasPrefix(name, t.Prefix) && len(t.Prefix) > len(owner.Prefix) {
+			owner = t
+		}
+	}
+	return owner.Name
+}
+
+// tenantUsage accounts every volume to its tenant, has to be called with the main lock held to get consistent results
+func (d *Driver) tenantUsage(ctx *context.Context) (usage map[string]*TenantUsage, err error) {
+	d.settingsLock.RLock()
+	usage = make(map[string]*TenantUsage, len(d.tenants))
+	for _, t := range d.tenants {
+		usage[t.Name] = &TenantUsage{
+			Name:         t.Name,
+			MaxVolumes:   t.MaxVolumes,
+			MaxSize:      t.maxSize,
+			MaxAllocated: t.maxAllocated,
+		}
+	}
+	d.settingsLock.RUnlock()
+
+	if len(usage) == 0 {
+		return
+	}
+
+	names, err := d.manager.List(ctx.Derived())
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		var vol manager.Volume
+		vol, err = d.manager.Get(ctx.Derived(), name)
+		if err != nil {
+			return
+		}
+		tenantUsage, ok := usage[d.tenantOf(name, vol.Metadata)]
+		if !ok {
+			continue
+		}
+		tenantUsage.Volumes++
+		tenantUsage.Size += int64(vol.MaxSizeInBytes)
+		tenantUsage.Allocated += int64(vol.AllocatedSizeInBytes)
+	}
+	return
+}
+
+// enforceQuota rejects a change that would take a tenant over its limits, has to be called with the main lock held so
+// that no other change can slip in between the check and the change itself
+func (d *Driver) enforceQuota(ctx *context.Context, tenantName string, volumes int, size, allocated int64) (err error) {
+	if tenantName == "" {
+		return
+	}
+
+	usage, err := d.tenantUsage(ctx.Derived())
+	if err != nil {
+		return errors.Wrapf(err, "cannot check usage of tenant '%s'", tenantName)
+	}
+	current, ok := usage[tenantName]
+	if !ok {
+		return errors.Wrapf(manager.ErrInvalid, "tenant '%s' does not exist", tenantName)
+	}
+
+	ctx.
+		Level(context.Debug).
+		Field("tenant", tenantName).
+		Field("usage", *current).
+		Message("checking tenant quota")
+
+	switch {
+	case current.MaxVolumes > 0 && current.Volumes+volumes > current.MaxVolumes:
+		err = errors.Wrapf(manager.ErrCapacity,
+			"tenant '%s' would have %d volumes while it may only have %d",
+			tenantName, current.Volumes+volumes, current.MaxVolumes)
+	case current.MaxSize > 0 && current.Size+size > current.MaxSize:
+		err = errors.Wrapf(manager.ErrCapacity,
+			"volumes of tenant '%s' would add up to %d bytes while they may only add up to %d bytes",
+			tenantName, current.Size+size, current.MaxSize)
+	case current.MaxAllocated > 0 && allocated > 0 && current.Allocated+allocated > current.MaxAllocated:
+		err = errors.Wrapf(manager.ErrCapacity,
+			"volumes of tenant '%s' would allocate %d bytes while they may only allocate %d bytes",
+			tenantName, current.Allocated+allocated, current.MaxAllocated)
+	}
+	return
+}
+
+// Tenants reports usage of every tenant sorted by name
+func (d *Driver) Tenants() (tenants []TenantUsage, err error) {
+	// Context definition
+	ctx := context.New().
+		Field(":func", "driver/Tenants")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Message("invoked")
+
+		defer func() {
+			initial.Finish(err)
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				err = errors.Wrap(err, initial.Trace)
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Field(":return/tenants", tenants).
+					Message("finished processing")
+			}
+		}()
+	}
+
+	// Handling locking
+	ctx.
+		Level(context.Trace).
+		Message("waiting for a lock")
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx.
+		Level(context.Trace).
+		Message("starting processing")
+
+	// Processing
+	usage, err := d.tenantUsage(ctx.Derived())
+	if err != nil {
+		return
+	}
+	tenants = make([]TenantUsage, 0, len(usage))
+	for _, tenantUsage := range usage {
+		tenants = append(tenants, *tenantUsage)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+
+	return
+}
@@ -1,14 +1,32 @@
 module github.com/ashald/docker-volume-loopback
 
+go 1.27.1
+
 require (
-	github.com/Microsoft/go-winio v0.4.11 // indirect
 	github.com/alexflint/go-arg v1.0.0
-	github.com/coreos/go-systemd v0.0.0-20190204112023-081494f7ee4f // indirect
-	github.com/docker/go-connections v0.4.0 // indirect
+	github.com/coreos/go-systemd v0.0.0-20190204112023-081494f7ee4f
+	github.com/docker/go-connections v0.4.0
 	github.com/docker/go-plugins-helpers v0.0.0-20181025120712-1e6269c305b8
 	github.com/docker/go-units v0.3.3
 	github.com/oklog/ulid v1.3.1
 	github.com/pkg/errors v0.8.1
 	github.com/sirupsen/logrus v1.3.0
+	gopkg.in/yaml.v2 v2.2.2
+)
+
+require (
+	github.com/Microsoft/go-winio v0.4.11 // indirect
+	github.com/alexflint/go-scalar v1.0.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
+	github.com/kr/pretty v0.1.0 // indirect
+	github.com/kr/pty v1.1.1 // indirect
+	github.com/kr/text v0.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/objx v0.1.1 // indirect
+	github.com/stretchr/testify v1.2.2 // indirect
+	golang.org/x/crypto v0.0.0-20180904163835-0709b304e793 // indirect
 	golang.org/x/net v0.0.0-20190206173232-65e2d4e15006 // indirect
+	golang.org/x/sys v0.0.0-20180905080454-ebe1bf3edb33 // indirect
+	gopkg.in/check.v1 v0.0.0-20161208181325-20d25e280405 // indirect
 )
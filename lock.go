@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Lock file guards data dir from being modified by the plugin and CLI commands at the same time
+const lockFileName = ".lock"
+
+func lockFilePath(stateDir string) string {
+	return filepath.Join(stateDir, lockFileName)
+}
+
+// acquireLock takes an exclusive lock that is held until the returned file is closed or the process exits
+func acquireLock(path string, wait bool) (file *os.File, err error) {
+	var lockDirMode os.FileMode = 0755
+	err = os.MkdirAll(filepath.Dir(path), lockDirMode)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot create lock file dir '%s'", filepath.Dir(path))
+		return
+	}
+
+	file, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot open lock file '%s'", path)
+		return
+	}
+
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	err = syscall.Flock(int(file.Fd()), how)
+	if err != nil {
+		_ = file.Close()
+		file = nil
+		if err == syscall.EWOULDBLOCK {
+			err = errors.Errorf("lock file '%s' is held by the plugin or another command", path)
+		} else {
+			err = errors.Wrapf(err, "cannot lock '%s'", path)
+		}
+	}
+
+	return
+}
@@ -1,42 +1,293 @@
 package main
 
 import (
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/alexflint/go-arg"
+	"github.com/ashald/docker-volume-loopback/access"
+	"github.com/ashald/docker-volume-loopback/admin"
 	"github.com/ashald/docker-volume-loopback/context"
 	"github.com/ashald/docker-volume-loopback/driver"
+	"github.com/ashald/docker-volume-loopback/metrics"
+	"github.com/ashald/docker-volume-loopback/systemd"
+	"github.com/ashald/docker-volume-loopback/volumeapi"
 
 	v "github.com/docker/go-plugins-helpers/volume"
+	"github.com/pkg/errors"
 )
 
 type config struct {
-	Socket      string `arg:"--socket,env:SOCKET,help:path to the plugin UNIX socket under /run/docker/plugins/"`
-	LogLevel    int    `arg:"--log-level,env:LOG_LEVEL,help:set log level - from 0 to 4 for Error/Warning/Info/Debug/Trace"`
-	LogFormat   string `arg:"--log-format,env:LOG_FORMAT,help:set log format - json/text/nice"`
-	StateDir    string `arg:"--state-dir,env:STATE_DIR,help:dir used to keep track of currently mounted volumes"`
-	DataDir     string `arg:"--data-dir,env:DATA_DIR,help:dir used to store actual volume data"`
-	MountDir    string `arg:"--mount-dir,env:MOUNT_DIR,help:dir used to create mount-points"`
-	DefaultSize string `arg:"--default-size,env:DEFAULT_SIZE,help:default size for volumes created"`
+	Config              string           `arg:"--config,env:CONFIG_FILE,help:path to a YAML or JSON config file - flags and env vars take precedence over it" yaml:"-"`
+	Socket              string           `arg:"--socket,env:SOCKET,help:path to the plugin UNIX socket under /run/docker/plugins/" yaml:"socket"`
+	AdminSocket         string           `arg:"--admin-socket,env:ADMIN_SOCKET,help:path to the admin API UNIX socket - defaults to plugin socket path with '-admin' suffix" yaml:"admin-socket"`
+	AdminSocketGroup    string           `arg:"--admin-socket-group,env:ADMIN_SOCKET_GROUP,help:group name or gid to own the admin API UNIX socket" yaml:"admin-socket-group"`
+	AdminSocketMode     string           `arg:"--admin-socket-mode,env:ADMIN_SOCKET_MODE,help:octal permissions of the admin API UNIX socket" yaml:"admin-socket-mode"`
+	LogLevel            int              `arg:"--log-level,env:LOG_LEVEL,help:set log level - from 0 to 4 for Error/Warning/Info/Debug/Trace" yaml:"log-level"`
+	LogFormat           string           `arg:"--log-format,env:LOG_FORMAT,help:set log format - json/text/nice" yaml:"log-format"`
+	LogOutput           string           `arg:"--log-output,env:LOG_OUTPUT,help:where to send logs - stdout/journald/syslog[:<socket>] or an absolute path to a log file" yaml:"log-output"`
+	LogMaxSize          string           `arg:"--log-max-size,env:LOG_MAX_SIZE,help:size at which log file is rotated - 0 to disable rotation" yaml:"log-max-size"`
+	LogMaxFiles         int              `arg:"--log-max-files,env:LOG_MAX_FILES,help:how many rotated log files to keep" yaml:"log-max-files"`
+	StateDir            string           `arg:"--state-dir,env:STATE_DIR,help:dir used to keep track of currently mounted volumes" yaml:"state-dir"`
+	DataDir             string           `arg:"--data-dir,env:DATA_DIR,help:dir used to store actual volume data" yaml:"data-dir"`
+	MountDir            string           `arg:"--mount-dir,env:MOUNT_DIR,help:dir used to create mount-points" yaml:"mount-dir"`
+	DefaultSize         string           `arg:"--default-size,env:DEFAULT_SIZE,help:default size for volumes created" yaml:"default-size"`
+	SecureDelete        string           `arg:"--secure-delete,env:SECURE_DELETE,help:erase volume data upon removal - none/auto/discard/zero/random" yaml:"secure-delete"`
+	JanitorInterval     time.Duration    `arg:"--janitor-interval,env:JANITOR_INTERVAL,help:how often to look for expired volumes - 0 to disable" yaml:"janitor-interval"`
+	ArchiveAfter        time.Duration    `arg:"--archive-after,env:ARCHIVE_AFTER,help:compress volumes that have not been mounted for that long - 0 to disable" yaml:"archive-after"`
+	MinFreeSpace        string           `arg:"--min-free-space,env:MIN_FREE_SPACE,help:free space to keep in data dir when creating volumes" yaml:"min-free-space"`
+	MaxOversubscription float64          `arg:"--max-oversubscription,env:MAX_OVERSUBSCRIPTION,help:max ratio of total volume size to data dir capacity - 0 to disable" yaml:"max-oversubscription"`
+	SpaceWarning        string           `arg:"--space-warning,env:SPACE_WARNING,help:data dir free space at which to start warning - 0 to disable" yaml:"space-warning"`
+	SpaceCritical       string           `arg:"--space-critical,env:SPACE_CRITICAL,help:data dir free space at which to stop mounting sparse volumes - 0 to disable" yaml:"space-critical"`
+	SpaceCheckInterval  time.Duration    `arg:"--space-check-interval,env:SPACE_CHECK_INTERVAL,help:how often to check data dir free space" yaml:"space-check-interval"`
+	ReadOnlyOnCritical  bool             `arg:"--read-only-on-critical,env:READ_ONLY_ON_CRITICAL,help:re-mount sparse volumes read-only when data dir free space is critical" yaml:"read-only-on-critical"`
+	ListStatus          bool             `arg:"--list-status,env:LIST_STATUS,help:include mount-point and status of every volume when listing volumes" yaml:"list-status"`
+	MetricsAddress      string           `arg:"--metrics-address,env:METRICS_ADDRESS,help:TCP address or absolute path to a UNIX socket to expose Prometheus metrics on" yaml:"metrics-address"`
+	Placement           string           `arg:"--placement,env:PLACEMENT,help:how to pick a pool for volumes created without 'pool' option - most-free/round-robin" yaml:"placement"`
+	ShutdownTimeout     time.Duration    `arg:"--shutdown-timeout,env:SHUTDOWN_TIMEOUT,help:how long to wait for operations in progress on SIGTERM or SIGINT" yaml:"shutdown-timeout"`
+	UnmountOnShutdown   bool             `arg:"--unmount-on-shutdown,env:UNMOUNT_ON_SHUTDOWN,help:un-mount volumes that have no leases left on shutdown" yaml:"unmount-on-shutdown"`
+	Pools               []poolConfig     `arg:"-" yaml:"pools"`
+	Profiles            []profileConfig  `arg:"-" yaml:"profiles"`
+	Policies            []policyConfig   `arg:"-" yaml:"policies"`
+	Tenants             []tenantConfig   `arg:"-" yaml:"tenants"`
+	Endpoints           []endpointConfig `arg:"-" yaml:"endpoints"`
+	Access              accessConfig     `arg:"-" yaml:"access"`
 }
 
-var (
-	args = &config{
-		Socket:      "/run/docker/plugins/docker-volume-loopback.sock",
-		StateDir:    "/run/docker-volume-loopback",
-		DataDir:     "/var/lib/docker-volume-loopback",
-		MountDir:    "/mnt",
-		DefaultSize: "1GiB",
-		LogLevel:    2,
-		LogFormat:   context.FormatNice,
+// poolConfig describes a pool in addition to the default one in data dir, pools can only be defined in config file
+type poolConfig struct {
+	Name                string  `yaml:"name"`
+	DataDir             string  `yaml:"data-dir"`
+	Fs                  string  `yaml:"fs"`
+	Sparse              bool    `yaml:"sparse"`
+	MinFreeSpace        string  `yaml:"min-free-space"`
+	MaxOversubscription float64 `yaml:"max-oversubscription"`
+}
+
+// profileConfig bundles create options under a name, profiles can only be defined in config file
+type profileConfig struct {
+	Name     string            `yaml:"name"`
+	Defaults map[string]string `yaml:"defaults"`
+	Enforced map[string]string `yaml:"enforced"`
+}
+
+// policyConfig restricts options of volumes matching a name pattern, policies can only be defined in config file
+type policyConfig struct {
+	Name         string   `yaml:"name"`
+	Match        string   `yaml:"match"`
+	MinSize      string   `yaml:"min-size"`
+	MaxSize      string   `yaml:"max-size"`
+	Fs           []string `yaml:"fs"`
+	DenySparse   bool     `yaml:"deny-sparse"`
+	Uid          *int     `yaml:"uid"`
+	Gid          *int     `yaml:"gid"`
+	Mode         string   `yaml:"mode"`
+	MaxTotalSize string   `yaml:"max-total-size"`
+}
+
+// tenantConfig limits capacity of volumes that belong to a tenant, tenants can only be defined in config file
+type tenantConfig struct {
+	Name         string `yaml:"name"`
+	Prefix       string `yaml:"prefix"`
+	MaxSize      string `yaml:"max-size"`
+	MaxAllocated string `yaml:"max-allocated"`
+	MaxVolumes   int    `yaml:"max-volumes"`
+}
+
+// endpointConfig describes an additional plugin socket with its own defaults, endpoints can only be defined in config file
+type endpointConfig struct {
+	Name        string   `yaml:"name"`
+	Socket      string   `yaml:"socket"`
+	DefaultSize string   `yaml:"default-size"`
+	Fs          string   `yaml:"fs"`
+	Pool        string   `yaml:"pool"`
+	Policies    []string `yaml:"policies"`
+}
+
+// accessConfig lists callers allowed to call each API, rules can only be defined in config file
+type accessConfig struct {
+	Plugin []accessRule `yaml:"plugin"`
+	Admin  []accessRule `yaml:"admin"`
+}
+
+type accessRule struct {
+	Uids        []uint32 `yaml:"uids"`
+	Gids        []uint32 `yaml:"gids"`
+	Executables []string `yaml:"executables"`
+	AllowAll    bool     `yaml:"allow-all"`
+	Paths       []string `yaml:"paths"`
+}
+
+var args = defaultConfig()
+
+func defaultConfig() *config {
+	return &config{
+		Socket:             "/run/docker/plugins/docker-volume-loopback.sock",
+		AdminSocketGroup:   "0",
+		AdminSocketMode:    "0660",
+		StateDir:           "/run/docker-volume-loopback",
+		DataDir:            "/var/lib/docker-volume-loopback",
+		MountDir:           "/mnt",
+		DefaultSize:        "1GiB",
+		SecureDelete:       "none",
+		LogLevel:           2,
+		LogFormat:          context.FormatNice,
+		LogOutput:          context.OutputStdout,
+		LogMaxSize:         "100MiB",
+		LogMaxFiles:        5,
+		JanitorInterval:    time.Minute,
+		MinFreeSpace:       "0",
+		SpaceWarning:       "0",
+		SpaceCritical:      "0",
+		SpaceCheckInterval: 10 * time.Second,
+		Placement:          "most-free",
+		ShutdownTimeout:    30 * time.Second,
 	}
-)
+}
+
+func driverConfig(cfg *config) driver.Config {
+	var pools []driver.PoolConfig
+	for _, pool := range cfg.Pools {
+		pools = append(pools, driver.PoolConfig(pool))
+	}
+	var policies []driver.PolicyConfig
+	for _, policy := range cfg.Policies {
+		policies = append(policies, driver.PolicyConfig(policy))
+	}
+	var tenants []driver.TenantConfig
+	for _, tenant := range cfg.Tenants {
+		tenants = append(tenants, driver.TenantConfig(tenant))
+	}
+	var endpoints []driver.EndpointConfig
+	for _, endpoint := range cfg.Endpoints {
+		endpoints = append(endpoints, driver.EndpointConfig{
+			Name:        endpoint.Name,
+			DefaultSize: endpoint.DefaultSize,
+			Fs:          endpoint.Fs,
+			Pool:        endpoint.Pool,
+			Policies:    endpoint.Policies,
+		})
+	}
+	var profiles []driver.ProfileConfig
+	for _, profile := range cfg.Profiles {
+		profiles = append(profiles, driver.ProfileConfig(profile))
+	}
+
+	return driver.Config{
+		StateDir:            cfg.StateDir,
+		DataDir:             cfg.DataDir,
+		MountDir:            cfg.MountDir,
+		DefaultSize:         cfg.DefaultSize,
+		SecureDelete:        cfg.SecureDelete,
+		JanitorInterval:     cfg.JanitorInterval,
+		ArchiveAfter:        cfg.ArchiveAfter,
+		MinFreeSpace:        cfg.MinFreeSpace,
+		MaxOversubscription: cfg.MaxOversubscription,
+		SpaceWarning:        cfg.SpaceWarning,
+		SpaceCritical:       cfg.SpaceCritical,
+		SpaceCheckInterval:  cfg.SpaceCheckInterval,
+		ReadOnlyOnCritical:  cfg.ReadOnlyOnCritical,
+		ListStatus:          cfg.ListStatus,
+		Pools:               pools,
+		Placement:           cfg.Placement,
+		Profiles:            profiles,
+		Policies:            policies,
+		Tenants:             tenants,
+		Endpoints:           endpoints,
+	}
+}
+
+// endpointSocket defaults to a socket named after the endpoint next to plugin's socket
+func endpointSocket(cfg *config, endpoint endpointConfig) string {
+	if endpoint.Socket != "" {
+		return endpoint.Socket
+	}
+	return filepath.Join(filepath.Dir(cfg.Socket), endpoint.Name+".sock")
+}
+
+// servePlugin serves Docker volume plugin protocol on a UNIX socket until listener fails or server is shut down
+func servePlugin(server *http.Server, listener net.Listener, d v.Driver, rules []access.Rule) error {
+	server.Handler = access.Guard(listener.Addr().String(), rules, volumeapi.Forbidden, volumeapi.NewHandler(d))
+	return server.Serve(access.Listener{Listener: listener})
+}
+
+// adminSocketPermissions resolves group and mode of the admin socket
+func adminSocketPermissions(cfg *config) (gid int, mode os.FileMode, err error) {
+	gid, err = strconv.Atoi(cfg.AdminSocketGroup)
+	if err != nil {
+		var group *user.Group
+		group, err = user.LookupGroup(cfg.AdminSocketGroup)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot resolve admin socket group '%s'", cfg.AdminSocketGroup)
+			return
+		}
+		gid, err = strconv.Atoi(group.Gid)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot use gid '%s' of admin socket group '%s'", group.Gid, cfg.AdminSocketGroup)
+			return
+		}
+	}
+
+	bits, err := strconv.ParseUint(cfg.AdminSocketMode, 8, 32)
+	if err != nil || bits > 0777 {
+		err = errors.Errorf("admin socket mode '%s' is not an octal permission mode", cfg.AdminSocketMode)
+		return
+	}
+	mode = os.FileMode(bits)
+	return
+}
+
+func accessRules(rules []accessRule) (converted []access.Rule) {
+	for _, rule := range rules {
+		converted = append(converted, access.Rule(rule))
+	}
+	return
+}
 
 func main() {
+	if len(os.Args) > 1 {
+		commands := commands()
+		if cmd, isCommand := commands[os.Args[1]]; isCommand {
+			os.Exit(runCommand(os.Args[1], cmd, os.Args[2:]))
+		}
+		if os.Args[1] == "-h" || os.Args[1] == "--help" {
+			parser, err := arg.NewParser(arg.Config{}, args)
+			if err == nil {
+				parser.WriteHelp(os.Stdout)
+			}
+			fmt.Println("\n" + usage(commands))
+			os.Exit(0)
+		}
+	}
+
+	if path := configFilePath(os.Args[1:]); path != "" {
+		err := readConfigFile(path, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+	}
 	arg.MustParse(args)
 
 	context.Init(args.LogLevel, args.LogFormat, os.Stdout)
+	logMaxSize, err := driver.FromHumanSize(args.LogMaxSize)
+	if err == nil {
+		err = context.SetOutput(args.LogOutput, logMaxSize, args.LogMaxFiles)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: cannot set log output:", err)
+		os.Exit(1)
+	}
 
 	ctx := context.New()
 
@@ -67,14 +318,46 @@ func main() {
 		os.Exit(1)
 	}
 
-	driverInstance, err := driver.New(
-		ctx.Derived(),
-		driver.Config{
-			StateDir:    args.StateDir,
-			DataDir:     args.DataDir,
-			MountDir:    args.MountDir,
-			DefaultSize: args.DefaultSize,
-		})
+	pluginRules := accessRules(args.Access.Plugin)
+	adminRules := accessRules(args.Access.Admin)
+	for api, rules := range map[string][]access.Rule{"plugin": pluginRules, "admin": adminRules} {
+		err := access.Validate(rules)
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", err).
+				Field("api", api).
+				Message("invalid access rules")
+			os.Exit(1)
+		}
+	}
+	adminSocketGid, adminSocketMode, err := adminSocketPermissions(args)
+	if err != nil {
+		ctx.
+			Level(context.Error).
+			Field("err", err).
+			Message("invalid admin socket permissions")
+		os.Exit(1)
+	}
+
+	ctx.
+		Level(context.Debug).
+		Message("waiting for lock file to be released by CLI commands")
+	lock, err := acquireLock(lockFilePath(args.StateDir), true)
+	if err != nil {
+		ctx.
+			Level(context.Error).
+			Field("err", err).
+			Message("failed to acquire lock file")
+		os.Exit(1)
+	}
+	defer lock.Close()
+
+	// signals received while initializing are handled once requests are served
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	driverInstance, err := driver.New(ctx.Derived(), driverConfig(args))
 	if err != nil {
 		ctx.
 			Level(context.Error).
@@ -83,15 +366,153 @@ func main() {
 		os.Exit(1)
 	}
 
-	handler := v.NewHandler(driverInstance)
-	err = handler.ServeUnix(args.Socket, 0)
+	if args.Config != "" {
+		go watchConfig(ctx, driverInstance)
+	}
+
+	if args.MetricsAddress != "" {
+		operations := metrics.NewOperations()
+		context.SetObserver(operations.Observe)
+
+		listener, err := metrics.Listen(args.MetricsAddress)
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", err).
+				Message("failed to open metrics listener")
+			os.Exit(1)
+		}
+
+		ctx.
+			Level(context.Info).
+			Field("address", args.MetricsAddress).
+			Message("serving metrics")
+		go func() {
+			errMetrics := http.Serve(listener, metrics.Handler(driverInstance.Metrics, operations.Collect))
+			ctx.
+				Level(context.Error).
+				Field("err", errMetrics).
+				Message("stopped serving metrics")
+		}()
+	}
+
+	activated, err := systemd.Listeners()
 	if err != nil {
 		ctx.
 			Level(context.Error).
+			Field("err", err).
+			Message("failed to use sockets passed by systemd")
+		os.Exit(1)
+	}
+	var servers []*http.Server
+	var sockets []string // sockets passed by systemd are left in place on shutdown
+	listen := func(socket string, listenUnix func(string) (net.Listener, error)) net.Listener {
+		if listener, isActivated := activated[socket]; isActivated {
+			delete(activated, socket)
+			ctx.
+				Level(context.Info).
+				Field("socket", socket).
+				Message("using socket passed by systemd")
+			return listener
+		}
+		listener, err := listenUnix(socket)
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", err).
+				Field("socket", socket).
+				Message("failed to listen on unix socket")
+			os.Exit(1)
+		}
+		sockets = append(sockets, socket)
+		return listener
+	}
+
+	adminSocket := args.AdminSocket
+	if adminSocket == "" {
+		adminSocket = strings.TrimSuffix(args.Socket, ".sock") + "-admin.sock"
+	}
+	adminListener := listen(adminSocket, func(socket string) (net.Listener, error) {
+		return admin.ListenUnix(socket, adminSocketGid, adminSocketMode)
+	})
+	ctx.
+		Level(context.Info).
+		Field("socket", adminSocket).
+		Message("serving admin api")
+	adminServer := &http.Server{}
+	servers = append(servers, adminServer)
+	go func() {
+		errAdmin := admin.New(driverInstance, adminRules).Serve(adminServer, adminListener)
+		if errAdmin == http.ErrServerClosed {
+			return
+		}
+		ctx.
+			Level(context.Error).
+			Field("err", errAdmin).
+			Field("socket", adminSocket).
+			Message("stopped serving admin api")
+	}()
+
+	for _, endpointCfg := range args.Endpoints {
+		endpoint, err := driverInstance.Endpoint(endpointCfg.Name)
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", err).
+				Message("failed to initialize endpoint")
+			os.Exit(1)
+		}
+		socket := endpointSocket(args, endpointCfg)
+		listener := listen(socket, volumeapi.ListenUnix)
+		ctx.
+			Level(context.Info).
+			Field("endpoint", endpointCfg.Name).
+			Field("socket", socket).
+			Message("serving volume plugin api for endpoint")
+		server := &http.Server{}
+		servers = append(servers, server)
+		go func() {
+			errEndpoint := servePlugin(server, listener, endpoint, pluginRules)
+			if errEndpoint == http.ErrServerClosed {
+				return
+			}
+			ctx.
+				Level(context.Error).
+				Field("err", errEndpoint).
+				Field("socket", socket).
+				Message("failed to serve volume plugin api over unix socket")
+			os.Exit(1)
+		}()
+	}
+
+	pluginListener := listen(args.Socket, volumeapi.ListenUnix)
+
+	for socket, listener := range activated {
+		ctx.
+			Level(context.Warning).
+			Field("socket", socket).
+			Message("socket passed by systemd does not match any of configured ones - closing it")
+		_ = listener.Close()
+	}
+
+	if systemd.Notifying() {
+		go notifySystemd(ctx.Derived(), driverInstance)
+	}
+
+	pluginServer := &http.Server{}
+	servers = append(servers, pluginServer)
+	go func() {
+		errPlugin := servePlugin(pluginServer, pluginListener, driverInstance, pluginRules)
+		if errPlugin == http.ErrServerClosed {
+			return
+		}
+		ctx.
+			Level(context.Error).
+			Field("err", errPlugin).
 			Field("socket", args.Socket).
 			Message("failed to serve volume plugin api over unix socket")
 		os.Exit(1)
-	}
+	}()
 
-	return
+	os.Exit(awaitShutdown(ctx.Derived(), signals, driverInstance, servers, sockets))
 }
@@ -0,0 +1,356 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Archives of idle volumes are kept in a hidden sub-directory of data dir so that they never clash with data files
+const (
+	archiveDirName    = ".archive"
+	archiveFileSuffix = ".zst"
+)
+
+func archiveFilePath(dataDir, name string) string {
+	return filepath.Join(dataDir, archiveDirName, name+archiveFileSuffix)
+}
+
+// IsArchived tells whether volume's data file is compressed and has to be restored before volume can be used
+func (v Volume) IsArchived() bool {
+	return v.ArchiveFilePath != ""
+}
+
+// checkRestored refuses operations that need data file of an archived volume
+func checkRestored(volume Volume) error {
+	if volume.IsArchived() {
+		return errors.Errorf("volume '%s' is archived - it's restored once mounted", volume.Name)
+	}
+	return nil
+}
+
+// Archive compresses data file of a volume that is not in use into the archive dir of its pool. The volume keeps being
+// listed and is restored transparently when it's mounted next time.
+func (m Manager) Archive(ctx *context.Context, name string) (err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/Archive")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// get metadata
+	var volume Volume
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.getUnusedVolume(ctx.Derived(), name)
+		if err != nil {
+			return
+		}
+	}
+
+	// resolve fs as it cannot be detected while data file is compressed
+	{
+		ctx.
+			Level(context.Trace).
+			Message("resolving volume fs")
+		volume.Metadata.Fs, err = volume.Fs(ctx.Derived())
+		if err != nil {
+			err = errors.Wrap(err, "cannot resolve volume fs")
+			return
+		}
+	}
+
+	// compress data file
+	dataDir := filepath.Dir(volume.DataFilePath)
+	tmpArchiveFilePath := filepath.Join(dataDir, tmpDirName, name+archiveFileSuffix)
+	{
+		ctx := ctx.
+			Field("data-file", volume.DataFilePath).
+			Field("tmp-archive-file", tmpArchiveFilePath)
+
+		err = os.MkdirAll(filepath.Dir(tmpArchiveFilePath), 0755)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot create dir '%s'", filepath.Dir(tmpArchiveFilePath))
+			return
+		}
+
+		ctx.
+			Level(context.Trace).
+			Message("compressing data-file")
+		var errStr string
+		errStr, err = runCommand(ctx.Derived(), "zstd", "-q", "-f", volume.DataFilePath, "-o", tmpArchiveFilePath)
+		if err != nil {
+			_ = os.Remove(tmpArchiveFilePath)
+			err = errors.Wrapf(err, "cannot compress data file '%s': %s", volume.DataFilePath, errStr)
+			return
+		}
+	}
+
+	// move archive into place - it's considered to be a leftover until data file is gone
+	archivePath := archiveFilePath(dataDir, name)
+	{
+		ctx := ctx.
+			Field("archive-file", archivePath)
+
+		ctx.
+			Level(context.Trace).
+			Message("moving archive into place")
+		err = os.MkdirAll(filepath.Dir(archivePath), 0755)
+		if err == nil {
+			err = os.Rename(tmpArchiveFilePath, archivePath)
+		}
+		if err != nil {
+			_ = os.Remove(tmpArchiveFilePath)
+			err = errors.Wrapf(err, "cannot move archive '%s' into place", tmpArchiveFilePath)
+			return
+		}
+		defer func() {
+			if err != nil {
+				ctx.
+					Level(context.Trace).
+					Message("attempting to cleanup archive")
+				_ = os.Remove(archivePath)
+			}
+		}()
+	}
+
+	// update metadata
+	{
+		ctx.
+			Level(context.Trace).
+			Message("updating metadata-file")
+		archivedAt := time.Now()
+		volume.Metadata.ArchivedAt = &archivedAt
+		volume.Metadata.ArchivedSize = volume.MaxSizeInBytes
+		err = writeMetadata(ctx.Derived(), volume.MetadataFilePath, volume.Metadata)
+		if err != nil {
+			err = errors.Wrap(err, "cannot persist volume metadata")
+			return
+		}
+	}
+
+	// remove data file
+	{
+		ctx.
+			Level(context.Trace).
+			Field("data-file", volume.DataFilePath).
+			Message("removing data-file")
+		err = os.Remove(volume.DataFilePath)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot delete '%s'", volume.DataFilePath)
+			return
+		}
+	}
+
+	var archiveSize int64
+	if info, errStat := os.Stat(archivePath); errStat == nil {
+		archiveSize = info.Size()
+	}
+	ctx.
+		Level(context.Info).
+		Field("volume", name).
+		Field("allocated", volume.AllocatedSizeInBytes).
+		Field("archived", archiveSize).
+		Message("archived volume")
+
+	return
+}
+
+// restore decompresses data file of an archived volume back into place and returns the restored volume
+func (m Manager) restore(ctx *context.Context, volume Volume) (restored Volume, err error) {
+	ctx = ctx.
+		Field(":func", "manager/restore").
+		Field("volume", volume.Name)
+
+	// check capacity
+	{
+		ctx.
+			Level(context.Trace).
+			Message("checking whether data dir can fit restored volume")
+		var pool Pool
+		pool, err = m.Pool(volume.Pool)
+		if err != nil {
+			return
+		}
+		pool.MaxOversubscription = 0 // archived volume is already counted towards over-subscription
+		err = m.admit(ctx.Derived(), pool, int64(volume.MaxSizeInBytes), volume.Metadata.Sparse)
+		if err != nil {
+			return
+		}
+	}
+
+	// decompress data file
+	tmpDataFilePath := filepath.Join(filepath.Dir(volume.DataFilePath), tmpDirName, volume.Name)
+	{
+		ctx := ctx.
+			Field("archive-file", volume.ArchiveFilePath).
+			Field("tmp-data-file", tmpDataFilePath)
+
+		err = os.MkdirAll(filepath.Dir(tmpDataFilePath), 0755)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot create dir '%s'", filepath.Dir(tmpDataFilePath))
+			return
+		}
+
+		sparse := "--no-sparse"
+		if volume.Metadata.Sparse {
+			sparse = "--sparse"
+		}
+
+		ctx.
+			Level(context.Trace).
+			Field("sparse", sparse).
+			Message("decompressing archive")
+		var errStr string
+		errStr, err = runCommand(ctx.Derived(),
+			"zstd", "-q", "-d", "-f", sparse, volume.ArchiveFilePath, "-o", tmpDataFilePath)
+		if err != nil {
+			_ = os.Remove(tmpDataFilePath)
+			err = errors.Wrapf(err, "cannot decompress archive '%s': %s", volume.ArchiveFilePath, errStr)
+			return
+		}
+
+		ctx.
+			Level(context.Trace).
+			Message("moving data-file into place")
+		err = os.Rename(tmpDataFilePath, volume.DataFilePath)
+		if err != nil {
+			_ = os.Remove(tmpDataFilePath)
+			err = errors.Wrapf(err, "cannot move data file '%s' into place", tmpDataFilePath)
+			return
+		}
+	}
+
+	// the volume is restored at this point, archive is a leftover
+	{
+		ctx.
+			Level(context.Trace).
+			Message("updating metadata-file")
+		volume.Metadata.ArchivedAt = nil
+		volume.Metadata.ArchivedSize = 0
+		errWrite := writeMetadata(ctx.Derived(), volume.MetadataFilePath, volume.Metadata)
+		if errWrite != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", errWrite).
+				Message("cannot clear archive details from metadata-file")
+		}
+
+		errRemove := os.Remove(volume.ArchiveFilePath)
+		if errRemove != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", errRemove).
+				Message("cannot remove archive - it will be removed by 'gc'")
+		}
+	}
+
+	ctx.
+		Level(context.Info).
+		Message("restored archived volume")
+
+	restored, err = m.getVolume(ctx.Derived(), volume.Name)
+	return
+}
+
+// listArchives returns names of volumes archived in a pool
+func listArchives(pool Pool) (names []string, err error) {
+	entries, err := readDirIfExists(filepath.Join(pool.DataDir, archiveDirName))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() && strings.HasSuffix(entry.Name(), archiveFileSuffix) {
+			names = append(names, strings.TrimSuffix(entry.Name(), archiveFileSuffix))
+		}
+	}
+	return
+}
+
+// getArchivedVolume looks a volume up among archives, its size is known from metadata as there is no data file
+func (m Manager) getArchivedVolume(ctx *context.Context, name string) (volume Volume, err error) {
+	var pool Pool
+	var archivePath string
+	var archiveInfo os.FileInfo
+	for _, pool = range m.pools {
+		archivePath = archiveFilePath(pool.DataDir, name)
+		archiveInfo, err = os.Stat(archivePath)
+		if err == nil || !os.IsNotExist(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = errors.Wrapf(ErrNotFound, "volume '%s' does not exist", name)
+		}
+		return
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("archive-file", archivePath).
+		Message("found archived volume")
+
+	volumeMetadataFilePath := metadataFilePath(pool.DataDir, name)
+	metadata, err := readMetadata(ctx.Derived(), volumeMetadataFilePath)
+	if err != nil {
+		return
+	}
+	if metadata.ArchivedAt == nil {
+		err = errors.Errorf("metadata of archived volume '%s' is missing from '%s'", name, volumeMetadataFilePath)
+		return
+	}
+
+	createdAt := metadata.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = *metadata.ArchivedAt
+	}
+
+	var allocated uint64
+	if details, ok := archiveInfo.Sys().(*syscall.Stat_t); ok {
+		allocated = uint64(details.Blocks * 512)
+	}
+
+	volume = Volume{
+		Name:                 name,
+		AllocatedSizeInBytes: allocated,
+		MaxSizeInBytes:       metadata.ArchivedSize,
+		StateDir:             filepath.Join(m.stateDir, name),
+		DataFilePath:         filepath.Join(pool.DataDir, name),
+		MetadataFilePath:     volumeMetadataFilePath,
+		ArchiveFilePath:      archivePath,
+		Pool:                 pool.Name,
+		MountPointPath:       filepath.Join(m.mountDir, name),
+		CreatedAt:            createdAt,
+		Metadata:             metadata,
+		fs:                   metadata.Fs,
+	}
+	return
+}
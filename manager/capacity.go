@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+)
+
+// admit checks whether a volume of a given size fits into data dir of a pool without breaking its capacity limits
+func (m Manager) admit(ctx *context.Context, pool Pool, sizeInBytes int64, sparse bool) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/admit")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/pool", pool.Name).
+			Field(":param/sizeInBytes", sizeInBytes).
+			Field(":param/sparse", sparse).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	total, available, err := diskSpace(pool.DataDir)
+	if err != nil {
+		return
+	}
+
+	// free space headroom
+	{
+		required := sizeInBytes
+		if sparse {
+			required = 0 // sparse volumes do not claim disk space upfront
+		}
+
+		ctx.
+			Level(context.Trace).
+			Field("available", available).
+			Field("required", required).
+			Field("min-free-space", pool.MinFreeSpace).
+			Message("checking free space headroom")
+		if available-required < pool.MinFreeSpace {
+			err = errors.Wrapf(ErrCapacity,
+				"volume of %d bytes would leave %d out of %d bytes available in data dir of pool '%s' while %d must be kept free",
+				sizeInBytes, available-required, available, pool.Name, pool.MinFreeSpace)
+			return
+		}
+	}
+
+	// over-subscription
+	if pool.MaxOversubscription > 0 {
+		var names []string
+		names, err = m.listPool(ctx.Derived(), pool)
+		if err != nil {
+			return
+		}
+
+		subscribed := sizeInBytes
+		for _, name := range names {
+			var volume Volume
+			volume, err = m.getVolume(ctx.Derived(), name)
+			if err != nil {
+				return
+			}
+			subscribed += int64(volume.MaxSizeInBytes)
+		}
+
+		limit := int64(float64(total) * pool.MaxOversubscription)
+		ctx.
+			Level(context.Trace).
+			Field("subscribed", subscribed).
+			Field("limit", limit).
+			Message("checking over-subscription ratio")
+		if subscribed > limit {
+			err = errors.Wrapf(ErrCapacity,
+				"volumes in pool '%s' would add up to %d bytes while its data dir of %d bytes may only be over-subscribed up to %d bytes (ratio %g)",
+				pool.Name, subscribed, total, limit, pool.MaxOversubscription)
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,538 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ConvertSparse turns a sparse volume into a fully allocated one or the other way around.
+func (m Manager) ConvertSparse(ctx *context.Context, name string, sparse bool) (err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/ConvertSparse")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/sparse", sparse).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// get metadata
+	var volume Volume
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.getUnusedVolume(ctx.Derived(), name)
+		if err != nil {
+			return
+		}
+	}
+
+	if sparse {
+		// trim free blocks - loop device passes discards down to data file as punched holes
+		{
+			lease := internalLease
+			ctx := ctx.Field("lease", lease)
+
+			ctx.
+				Level(context.Trace).
+				Message("mounting volume to trim free blocks using fake lease")
+			var mountPath string
+			mountPath, err = m.Mount(ctx.Derived(), name, lease, nil)
+			if err != nil {
+				err = errors.Wrap(err, "cannot mount volume to trim its free blocks")
+				return
+			}
+
+			ctx.
+				Level(context.Trace).
+				Message("trimming free blocks with 'fstrim' exec")
+			errStr, errTrim := runCommand(ctx.Derived(), "fstrim", mountPath)
+			if errTrim != nil {
+				ctx.
+					Level(context.Warning).
+					Field("err", errTrim).
+					Field("output", errStr).
+					Message("cannot trim free blocks - only zeroed blocks will be reclaimed")
+			}
+
+			ctx.
+				Level(context.Trace).
+				Message("un-mounting volume to clean-up")
+			err = m.UnMount(ctx.Derived(), name, lease, nil)
+			if err != nil {
+				return
+			}
+		}
+
+		// punch zeroed blocks
+		{
+			ctx.
+				Level(context.Trace).
+				Field("data-file", volume.DataFilePath).
+				Message("punching holes in place of zeroed blocks with 'fallocate' exec")
+			var errStr string
+			errStr, err = runCommand(ctx.Derived(), "fallocate", "--dig-holes", volume.DataFilePath)
+			if err != nil {
+				err = errors.Wrapf(err, "cannot punch holes in data file '%s': %s", volume.DataFilePath, errStr)
+				return
+			}
+		}
+	} else {
+		ctx.
+			Level(context.Trace).
+			Field("data-file", volume.DataFilePath).
+			Message("allocating entire data-file")
+		err = allocateDataFile(ctx.Derived(), volume.DataFilePath, int64(volume.MaxSizeInBytes))
+		if err != nil {
+			return
+		}
+	}
+
+	// update metadata
+	{
+		ctx.
+			Level(context.Trace).
+			Message("updating metadata-file")
+		volume.Metadata.Sparse = sparse
+		if sparse {
+			volume.Metadata.Reserve = ReserveNone // sparse volumes do not reserve disk space
+		}
+		err = writeMetadata(ctx.Derived(), volume.MetadataFilePath, volume.Metadata)
+		if err != nil {
+			err = errors.Wrap(err, "cannot persist volume metadata")
+		}
+	}
+
+	return
+}
+
+// ConvertFs copies volume contents into a data file formatted with another filesystem and swaps it in.
+func (m Manager) ConvertFs(ctx *context.Context, name string, fs string) (err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/ConvertFs")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/fs", fs).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// validation
+	{
+		ctx.
+			Level(context.Trace).
+			Field("fs", fs).
+			Message("validating fs type to be ext4 or xfs")
+		_, ok := MkFsOptions[fs]
+		if !ok {
+			err = errors.Wrapf(ErrInvalid, "only xfs and ext4 filesystems are supported, '%s' requested", fs)
+			return
+		}
+	}
+
+	// get metadata
+	var volume Volume
+	var currentFs string
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.getUnusedVolume(ctx.Derived(), name)
+		if err != nil {
+			return
+		}
+
+		currentFs, err = volume.Fs(ctx.Derived())
+		if err != nil {
+			err = errors.Wrap(err, "cannot resolve volume fs")
+			return
+		}
+		if currentFs == fs {
+			err = errors.Wrapf(ErrInvalid, "volume '%s' is already formatted as '%s'", name, fs)
+			return
+		}
+	}
+
+	// journal
+	tmpDir := filepath.Join(filepath.Dir(volume.DataFilePath), tmpDirName)
+	newDataFilePath := filepath.Join(tmpDir, name)
+	{
+		var finish func()
+		finish, err = m.journal(ctx.Derived(), journalEntry{
+			Operation:   journalConvert,
+			Volume:      name,
+			DataFile:    volume.DataFilePath,
+			NewDataFile: newDataFilePath,
+		})
+		if err != nil {
+			return
+		}
+		defer finish()
+	}
+
+	// prepare new data file
+	{
+		ctx := ctx.
+			Field("new-data-file", newDataFilePath)
+
+		var tmpDirMode os.FileMode = 0755
+		ctx.
+			Level(context.Trace).
+			Message("ensuring tmp dir exists")
+		err = os.MkdirAll(tmpDir, tmpDirMode)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot create tmp dir '%s'", tmpDir)
+			return
+		}
+		_ = os.Remove(newDataFilePath) // leftover from an interrupted conversion
+
+		ctx.
+			Level(context.Trace).
+			Message("creating new data-file")
+		err = createDataFile(ctx.Derived(), newDataFilePath, int64(volume.MaxSizeInBytes), volume.Metadata.Sparse)
+		if err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				ctx.
+					Level(context.Trace).
+					Message("attempting to cleanup new data-file")
+				_ = os.Remove(newDataFilePath)
+			}
+		}()
+
+		ctx.
+			Level(context.Trace).
+			Message("formatting new data-file")
+		err = formatDataFile(ctx.Derived(), newDataFilePath, fs, int64(volume.MaxSizeInBytes), volume.Metadata.Reserve)
+		if err != nil {
+			return
+		}
+	}
+
+	// copy contents
+	{
+		sourcePath := newDataFilePath + ".source"
+		targetPath := newDataFilePath + ".target"
+
+		ctx.
+			Level(context.Trace).
+			Field("mount-point", sourcePath).
+			Message("mounting current data-file")
+		err = mountDataFile(ctx.Derived(), volume.DataFilePath, sourcePath, currentFs)
+		if err != nil {
+			return
+		}
+		defer func() {
+			ctx.
+				Level(context.Trace).
+				Message("un-mounting current data-file")
+			errUnMount := unmountDataFile(ctx.Derived(), volume.DataFilePath, sourcePath)
+			if err == nil {
+				err = errUnMount
+			}
+		}()
+
+		ctx.
+			Level(context.Trace).
+			Field("mount-point", targetPath).
+			Message("mounting new data-file")
+		err = mountDataFile(ctx.Derived(), newDataFilePath, targetPath, fs)
+		if err != nil {
+			return
+		}
+
+		ctx.
+			Level(context.Trace).
+			Message("copying volume contents")
+		err = copyContents(ctx.Derived(), sourcePath, targetPath, currentFs == "ext4")
+
+		// new data file must be un-mounted before it can be swapped in
+		ctx.
+			Level(context.Trace).
+			Message("un-mounting new data-file")
+		errUnMount := unmountDataFile(ctx.Derived(), newDataFilePath, targetPath)
+		if err == nil {
+			err = errUnMount
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	// update metadata - it's written before the swap so that a failure to persist it leaves the volume as it was,
+	// should the plugin be killed in between the metadata is reconciled with the data file on next start
+	currentMetadata := volume.Metadata
+	{
+		ctx.
+			Level(context.Trace).
+			Message("updating metadata-file")
+		volume.Metadata.Fs = fs
+		err = writeMetadata(ctx.Derived(), volume.MetadataFilePath, volume.Metadata)
+		if err != nil {
+			err = errors.Wrap(err, "cannot persist volume metadata")
+			return
+		}
+	}
+
+	// swap data files
+	{
+		ctx.
+			Level(context.Trace).
+			Field("data-file", volume.DataFilePath).
+			Field("new-data-file", newDataFilePath).
+			Message("replacing data-file with the new one")
+		err = os.Rename(newDataFilePath, volume.DataFilePath)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot replace data file '%s'", volume.DataFilePath)
+
+			ctx.
+				Level(context.Trace).
+				Message("attempting to restore metadata-file")
+			errRestore := writeMetadata(ctx.Derived(), volume.MetadataFilePath, currentMetadata)
+			if errRestore != nil {
+				ctx.
+					Level(context.Error).
+					Field("err", errRestore).
+					Message("cannot restore metadata-file")
+			}
+			return
+		}
+	}
+
+	return
+}
+
+// getUnusedVolume retrieves a volume making sure that it has no leases
+func (m Manager) getUnusedVolume(ctx *context.Context, name string) (volume Volume, err error) {
+	ctx = ctx.
+		Field(":func", "manager/getUnusedVolume")
+
+	ctx.
+		Level(context.Debug).
+		Field(":param/name", name).
+		Message("invoked")
+
+	defer func() {
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field(":return/err", err).
+				Message("failed with an error")
+			return
+		} else {
+			ctx.
+				Level(context.Debug).
+				Field(":return/volume", volume).
+				Message("finished")
+		}
+	}()
+
+	volume, err = m.Get(ctx.Derived(), name)
+	if err != nil {
+		err = errors.Wrap(err, "cannot get volume metadata")
+		return
+	}
+	err = checkRestored(volume)
+	if err != nil {
+		return
+	}
+	err = m.checkNotDeleting(volume)
+	if err != nil {
+		return
+	}
+
+	ctx.
+		Level(context.Trace).
+		Message("checking if volume is still mounted")
+	isMounted, err := volume.IsMounted(ctx.Derived())
+	if err != nil {
+		err = errors.Wrap(err, "cannot get volume mount status")
+		return
+	}
+	if isMounted {
+		err = errors.Wrapf(ErrInUse, "volume '%s' must be un-mounted first", name)
+	}
+
+	return
+}
+
+// allocateDataFile allocates all holes in a data file and releases what was allocated if it runs out of space
+func allocateDataFile(ctx *context.Context, dataFilePath string, sizeInBytes int64) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/allocateDataFile")
+
+	ctx.
+		Level(context.Debug).
+		Field(":param/dataFilePath", dataFilePath).
+		Field(":param/sizeInBytes", sizeInBytes).
+		Message("invoked")
+
+	defer func() {
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field(":return/err", err).
+				Message("failed with an error")
+			return
+		} else {
+			ctx.
+				Level(context.Debug).
+				Message("finished")
+		}
+	}()
+
+	file, err := os.OpenFile(dataFilePath, os.O_RDWR, 0)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot open data file '%s'", dataFilePath)
+		return
+	}
+	defer file.Close()
+
+	// remember holes so that we can punch them back if allocation fails half-way
+	extents, err := allocatedExtents(file, sizeInBytes)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot look up allocated extents of '%s'", dataFilePath)
+		return
+	}
+	var holes []extent
+	offset := int64(0)
+	for _, e := range extents {
+		if e.offset > offset {
+			holes = append(holes, extent{offset: offset, length: e.offset - offset})
+		}
+		offset = e.offset + e.length
+	}
+	if offset < sizeInBytes {
+		holes = append(holes, extent{offset: offset, length: sizeInBytes - offset})
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("holes", len(holes)).
+		Message("allocating holes with 'fallocate' syscall")
+	err = syscall.Fallocate(int(file.Fd()), 0, 0, sizeInBytes)
+	if err != nil {
+		ctx.
+			Level(context.Trace).
+			Message("attempting to release partially allocated space")
+		for _, hole := range holes {
+			_ = syscall.Fallocate(int(file.Fd()), fallocPunchHole|fallocKeepSize, hole.offset, hole.length)
+		}
+
+		if err == syscall.ENOSPC {
+			err = errors.Wrapf(err, "not enough disk space to allocate data file '%s'", dataFilePath)
+		} else {
+			err = errors.Wrapf(err, "cannot allocate data file '%s'", dataFilePath)
+		}
+	}
+
+	return
+}
+
+// copyContents copies everything from one volume root into another preserving ownership and permissions
+func copyContents(ctx *context.Context, sourcePath, targetPath string, skipLostFound bool) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/copyContents")
+
+	ctx.
+		Level(context.Debug).
+		Field(":param/sourcePath", sourcePath).
+		Field(":param/targetPath", targetPath).
+		Message("invoked")
+
+	defer func() {
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field(":return/err", err).
+				Message("failed with an error")
+			return
+		} else {
+			ctx.
+				Level(context.Debug).
+				Message("finished")
+		}
+	}()
+
+	entries, err := ioutil.ReadDir(sourcePath)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot list '%s'", sourcePath)
+		return
+	}
+
+	for _, entry := range entries {
+		if skipLostFound && entry.Name() == "lost+found" {
+			continue
+		}
+
+		var errStr string
+		errStr, err = runCommand(ctx.Derived(), "cp", "-a", filepath.Join(sourcePath, entry.Name()), targetPath)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot copy '%s': %s", entry.Name(), errStr)
+			return
+		}
+	}
+
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot stat '%s'", sourcePath)
+		return
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+
+	err = os.Chown(targetPath, int(stat.Uid), int(stat.Gid))
+	if err != nil {
+		err = errors.Wrapf(err, "cannot adjust owner of '%s'", targetPath)
+		return
+	}
+
+	err = syscall.Chmod(targetPath, stat.Mode&07777)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot adjust mode of '%s'", targetPath)
+	}
+
+	return
+}
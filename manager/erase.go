@@ -0,0 +1,330 @@
+package manager
+
+import (
+	"crypto/rand"
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// Secure delete methods
+const (
+	SecureDeleteNone    = "none"
+	SecureDeleteAuto    = "auto" // discard for sparse volumes and zero for regular ones
+	SecureDeleteDiscard = "discard"
+	SecureDeleteZero    = "zero"
+	SecureDeleteRandom  = "random"
+)
+
+var SecureDeleteMethods = []string{
+	SecureDeleteNone, SecureDeleteAuto, SecureDeleteDiscard, SecureDeleteZero, SecureDeleteRandom,
+}
+
+// lseek(2) and fallocate(2) constants that are not exposed by 'syscall' package
+const (
+	seekData = 3
+	seekHole = 4
+
+	fallocKeepSize  = 0x01
+	fallocPunchHole = 0x02
+)
+
+const eraseChunkSize = 1 << 20
+
+// erasures keeps track of erasures in progress so that they can be cancelled and of volumes being deleted so that other
+// operations leave them alone while the main lock is released for their erasure
+type erasures struct {
+	sync.Mutex
+	cancels  map[string]chan struct{}
+	deleting map[string]struct{}
+}
+
+type extent struct {
+	offset int64
+	length int64
+}
+
+func IsValidSecureDeleteMethod(method string) bool {
+	for _, known := range SecureDeleteMethods {
+		if method == known {
+			return true
+		}
+	}
+	return false
+}
+
+// secureDeleteMethod resolves erase method of a volume, volumes without a method of their own use the plugin-wide one
+func (m Manager) secureDeleteMethod(volume Volume) string {
+	if volume.Metadata.SecureDelete == "" {
+		return m.secureDelete
+	}
+	return volume.Metadata.SecureDelete
+}
+
+// setDeleting marks a volume as being deleted or clears the mark
+func (m Manager) setDeleting(name string, deleting bool) {
+	m.erasures.Lock()
+	defer m.erasures.Unlock()
+
+	if deleting {
+		m.erasures.deleting[name] = struct{}{}
+	} else {
+		delete(m.erasures.deleting, name)
+	}
+}
+
+// checkNotDeleting refuses operations on a volume that is being deleted
+func (m Manager) checkNotDeleting(volume Volume) error {
+	m.erasures.Lock()
+	defer m.erasures.Unlock()
+
+	if _, deleting := m.erasures.deleting[volume.Name]; deleting {
+		return errors.Wrapf(ErrInUse, "volume '%s' is being deleted", volume.Name)
+	}
+	return nil
+}
+
+// CancelErase interrupts secure erasure of a volume that is being deleted, the volume is left in place.
+func (m Manager) CancelErase(ctx *context.Context, name string) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/CancelErase")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	m.erasures.Lock()
+	defer m.erasures.Unlock()
+
+	cancel, ok := m.erasures.cancels[name]
+	if !ok {
+		err = errors.Errorf("volume '%s' is not being erased", name)
+		return
+	}
+
+	ctx.
+		Level(context.Info).
+		Field("volume", name).
+		Message("cancelling erasure")
+	close(cancel)
+	delete(m.erasures.cancels, name)
+
+	return
+}
+
+// CancelErasures interrupts all secure erasures in progress, volumes being deleted are left in place. Names of volumes
+// whose erasure was cancelled are returned.
+func (m Manager) CancelErasures(ctx *context.Context) (cancelled []string) {
+	m.erasures.Lock()
+	defer m.erasures.Unlock()
+
+	for name, cancel := range m.erasures.cancels {
+		ctx.
+			Level(context.Info).
+			Field("volume", name).
+			Message("cancelling erasure")
+		close(cancel)
+		delete(m.erasures.cancels, name)
+		cancelled = append(cancelled, name)
+	}
+	return
+}
+
+func (m Manager) eraseDataFile(ctx *context.Context, volume Volume, method string) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/eraseDataFile")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/volume", volume).
+			Field(":param/method", method).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	if method == SecureDeleteAuto {
+		if volume.Metadata.Sparse {
+			method = SecureDeleteDiscard
+		} else {
+			method = SecureDeleteZero
+		}
+		ctx.
+			Level(context.Debug).
+			Field("method", method).
+			Message("resolved erase method")
+	}
+
+	// register erasure so that it can be cancelled
+	cancel := make(chan struct{})
+	{
+		m.erasures.Lock()
+		m.erasures.cancels[volume.Name] = cancel
+		m.erasures.Unlock()
+
+		defer func() {
+			m.erasures.Lock()
+			if m.erasures.cancels[volume.Name] == cancel {
+				delete(m.erasures.cancels, volume.Name)
+			}
+			m.erasures.Unlock()
+		}()
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("data-file", volume.DataFilePath).
+		Message("opening data-file")
+	file, err := os.OpenFile(volume.DataFilePath, os.O_RDWR, 0)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot open data file '%s'", volume.DataFilePath)
+		return
+	}
+	defer file.Close()
+
+	ctx.
+		Level(context.Trace).
+		Message("looking up allocated extents")
+	extents, err := allocatedExtents(file, int64(volume.MaxSizeInBytes))
+	if err != nil {
+		err = errors.Wrapf(err, "cannot look up allocated extents of '%s'", volume.DataFilePath)
+		return
+	}
+
+	var total, done int64
+	for _, e := range extents {
+		total += e.length
+	}
+
+	ctx.
+		Level(context.Info).
+		Field("volume", volume.Name).
+		Field("method", method).
+		Field("total-bytes", total).
+		Message("erasing volume data")
+
+	buffer := make([]byte, eraseChunkSize)
+	lastReported := int64(0)
+	for _, e := range extents {
+		for offset := e.offset; offset < e.offset+e.length; {
+			select {
+			case <-cancel:
+				err = errors.Errorf("erasure of volume '%s' was cancelled after %d of %d bytes", volume.Name, done, total)
+				return
+			default:
+			}
+
+			length := e.offset + e.length - offset
+			if length > eraseChunkSize {
+				length = eraseChunkSize
+			}
+
+			switch method {
+			case SecureDeleteDiscard:
+				err = syscall.Fallocate(int(file.Fd()), fallocPunchHole|fallocKeepSize, offset, length)
+			case SecureDeleteZero:
+				_, err = file.WriteAt(buffer[:length], offset)
+			case SecureDeleteRandom:
+				_, err = rand.Read(buffer[:length])
+				if err == nil {
+					_, err = file.WriteAt(buffer[:length], offset)
+				}
+			default:
+				err = errors.Errorf("unknown erase method '%s'", method)
+			}
+			if err != nil {
+				err = errors.Wrapf(err, "cannot erase %d bytes at offset %d of '%s'", length, offset, volume.DataFilePath)
+				return
+			}
+
+			offset += length
+			done += length
+
+			progress := done * 100 / total
+			if progress >= lastReported+10 || done == total {
+				lastReported = progress
+				ctx.
+					Level(context.Info).
+					Field("volume", volume.Name).
+					Field("progress", progress).
+					Field("erased-bytes", done).
+					Message("erasing volume data")
+			}
+		}
+	}
+
+	ctx.
+		Level(context.Trace).
+		Message("flushing data-file")
+	err = file.Sync()
+	if err != nil {
+		err = errors.Wrapf(err, "cannot flush data file '%s'", volume.DataFilePath)
+	}
+
+	return
+}
+
+// allocatedExtents returns data regions of a file; falls back to the whole file if the backing fs cannot tell
+func allocatedExtents(file *os.File, size int64) (extents []extent, err error) {
+	fd := int(file.Fd())
+
+	for offset := int64(0); offset < size; {
+		var data, hole int64
+		data, err = syscall.Seek(fd, offset, seekData)
+		if err != nil {
+			if err == syscall.ENXIO { // no more data past offset
+				err = nil
+				return
+			}
+			if err == syscall.EINVAL && offset == 0 { // SEEK_DATA is not supported
+				err = nil
+				extents = []extent{{offset: 0, length: size}}
+			}
+			return
+		}
+
+		hole, err = syscall.Seek(fd, data, seekHole)
+		if err != nil {
+			return
+		}
+
+		extents = append(extents, extent{offset: data, length: hole - data})
+		offset = hole
+	}
+
+	return
+}
@@ -0,0 +1,13 @@
+package manager
+
+import "github.com/pkg/errors"
+
+// Errors that callers may need to tell apart, use errors.Cause to unwrap
+var (
+	ErrNotFound  = errors.New("volume not found")
+	ErrProtected = errors.New("volume is protected")
+	ErrInUse     = errors.New("volume is in use")
+	ErrExists    = errors.New("volume already exists")
+	ErrCapacity  = errors.New("insufficient capacity")
+	ErrInvalid   = errors.New("invalid request")
+)
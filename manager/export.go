@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"bytes"
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Export streams contents of a dir (e.g. a mounted volume) as a tar archive preserving numeric ownership.
+func Export(ctx *context.Context, path string, w io.Writer) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/Export")
+
+	ctx.
+		Level(context.Debug).
+		Field(":param/path", path).
+		Message("invoked")
+
+	defer func() {
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field(":return/err", err).
+				Message("failed with an error")
+			return
+		} else {
+			ctx.
+				Level(context.Debug).
+				Message("finished")
+		}
+	}()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("tar", "--create", "--numeric-owner", "--sparse", "--directory", path, ".")
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		err = errors.Wrapf(err, "cannot archive '%s': %s", path, strings.TrimSpace(stderr.String()))
+	}
+
+	return
+}
@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// Fsck checks filesystem of a volume that is not in use and optionally repairs it, output of the tool is returned.
+func (m Manager) Fsck(ctx *context.Context, name string, repair bool) (output string, err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/Fsck")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/repair", repair).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// get metadata
+	var volume Volume
+	var fs string
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.getUnusedVolume(ctx.Derived(), name)
+		if err != nil {
+			return
+		}
+
+		fs, err = volume.Fs(ctx.Derived())
+		if err != nil {
+			err = errors.Wrap(err, "cannot resolve volume fs")
+			return
+		}
+	}
+
+	// check
+	{
+		var command []string
+		// exit codes that report problems that were fixed or that do not prevent volume from being used
+		var tolerated []int
+		switch fs {
+		case "xfs":
+			command = []string{"xfs_repair"}
+			if !repair {
+				command = append(command, "-n")
+			}
+		case "ext4":
+			command = []string{"e2fsck", "-f"}
+			if repair {
+				command = append(command, "-y")
+				tolerated = []int{1}
+			} else {
+				command = append(command, "-n")
+			}
+		default:
+			err = errors.Errorf("checking '%s' fs is not supported", fs)
+			return
+		}
+		command = append(command, volume.DataFilePath)
+
+		ctx.
+			Level(context.Trace).
+			Field("command", command).
+			Message("checking fs")
+
+		var outBytes []byte
+		outBytes, err = exec.Command(command[0], command[1:]...).CombinedOutput()
+		output = strings.TrimSpace(string(outBytes))
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				for _, code := range tolerated {
+					if status.ExitStatus() == code {
+						err = nil
+					}
+				}
+			}
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "'%s' fs of volume '%s' has errors or cannot be checked", fs, name)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,234 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GC removes leftovers of interrupted operations and of leases that outlived their mounts (e.g. after a crash):
+//   - state dirs of volumes that do not exist or are not actually mounted
+//   - empty mount points of volumes that are not mounted
+//   - metadata files of volumes that do not exist in the same pool
+//   - archives of volumes whose data files are in place (e.g. after an interrupted restore)
+//   - temporary files of interrupted conversions and snapshots in every pool
+//
+// Paths that were (or in dry-run mode would be) removed are returned.
+func (m Manager) GC(ctx *context.Context, dryRun bool) (removed []string, err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/GC")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/dryRun", dryRun).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Field(":return/removed", removed).
+					Message("finished")
+			}
+		}()
+	}
+
+	remove := func(path string) error {
+		ctx.
+			Level(context.Info).
+			Field("path", path).
+			Field("dry-run", dryRun).
+			Message("removing leftover")
+		removed = append(removed, path)
+		if dryRun {
+			return nil
+		}
+		return errors.Wrapf(os.RemoveAll(path), "cannot remove '%s'", path)
+	}
+
+	mounts, err := readMounts()
+	if err != nil {
+		return
+	}
+
+	names, err := m.List(ctx.Derived())
+	if err != nil {
+		return
+	}
+	volumes := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		volumes[name] = struct{}{}
+	}
+
+	// state dirs
+	{
+		ctx.
+			Level(context.Trace).
+			Field("state-dir", m.stateDir).
+			Message("looking for stale leases")
+
+		var entries []os.FileInfo
+		entries, err = readDirIfExists(m.stateDir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() || strings.HasPrefix(name, ".") {
+				continue
+			}
+			_, exists := volumes[name]
+			_, mounted := mounts[filepath.Join(m.mountDir, name)]
+			if exists && mounted {
+				continue
+			}
+			err = remove(filepath.Join(m.stateDir, name))
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	// mount points - mount dir may be shared so only volumes' mount points are considered
+	{
+		ctx.
+			Level(context.Trace).
+			Field("mount-dir", m.mountDir).
+			Message("looking for stale mount points")
+
+		for _, name := range names {
+			mountPointPath := filepath.Join(m.mountDir, name)
+			if _, mounted := mounts[mountPointPath]; mounted {
+				continue
+			}
+			info, errStat := os.Lstat(mountPointPath)
+			if errStat != nil || !info.IsDir() {
+				continue
+			}
+			var entries []os.FileInfo
+			entries, err = readDirIfExists(mountPointPath)
+			if err != nil {
+				return
+			}
+			if len(entries) > 0 {
+				ctx.
+					Level(context.Warning).
+					Field("path", mountPointPath).
+					Message("mount point is not empty - keeping it")
+				continue
+			}
+			err = remove(mountPointPath)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	for _, pool := range m.pools {
+		// metadata files
+		{
+			metadataDir := filepath.Join(pool.DataDir, metadataDirName)
+			ctx.
+				Level(context.Trace).
+				Field("metadata-dir", metadataDir).
+				Message("looking for orphaned metadata files")
+
+			var entries []os.FileInfo
+			entries, err = readDirIfExists(metadataDir)
+			if err != nil {
+				return
+			}
+			for _, entry := range entries {
+				// metadata belongs to the data file or the archive within the same pool
+				if _, errStat := os.Lstat(filepath.Join(pool.DataDir, entry.Name())); errStat == nil {
+					continue
+				}
+				if _, errStat := os.Lstat(archiveFilePath(pool.DataDir, entry.Name())); errStat == nil {
+					continue
+				}
+				err = remove(filepath.Join(metadataDir, entry.Name()))
+				if err != nil {
+					return
+				}
+			}
+		}
+
+		// archives
+		{
+			ctx.
+				Level(context.Trace).
+				Field("archive-dir", filepath.Join(pool.DataDir, archiveDirName)).
+				Message("looking for redundant archives")
+
+			var archived []string
+			archived, err = listArchives(pool)
+			if err != nil {
+				return
+			}
+			for _, name := range archived {
+				if _, errStat := os.Lstat(filepath.Join(pool.DataDir, name)); errStat != nil {
+					continue
+				}
+				err = remove(archiveFilePath(pool.DataDir, name))
+				if err != nil {
+					return
+				}
+			}
+		}
+
+		// temporary files
+		{
+			tmpDir := filepath.Join(pool.DataDir, tmpDirName)
+			ctx.
+				Level(context.Trace).
+				Field("tmp-dir", tmpDir).
+				Message("looking for temporary files")
+
+			var entries []os.FileInfo
+			entries, err = readDirIfExists(tmpDir)
+			if err != nil {
+				return
+			}
+			for _, entry := range entries {
+				path := filepath.Join(tmpDir, entry.Name())
+				if _, mounted := mounts[path]; mounted {
+					ctx.
+						Level(context.Warning).
+						Field("path", path).
+						Message("temporary mount point is still mounted - keeping it")
+					continue
+				}
+				err = remove(path)
+				if err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	return
+}
+
+func readDirIfExists(path string) (entries []os.FileInfo, err error) {
+	entries, err = ioutil.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+		err = errors.Wrapf(err, "cannot read '%s'", path)
+	}
+	return
+}
@@ -0,0 +1,374 @@
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+)
+
+// Operations that leave a volume half-way through when interrupted are recorded in a hidden sub-directory of state
+// dir before they start so that they can be rolled back on next start
+const journalDirName = ".journal"
+
+// Journaled operations, mounts are rolled back before creations as creation mounts volume to adjust its root
+const (
+	journalMount   = "mount"
+	journalCreate  = "create"
+	journalRename  = "rename"
+	journalConvert = "convert"
+	journalMove    = "move"
+)
+
+type journalEntry struct {
+	Operation string `json:"operation"`
+	Volume    string `json:"volume"`
+	Lease     string `json:"lease,omitempty"`
+	DataFile  string `json:"data-file"`
+	// data file an operation produces in place of DataFile, e.g. the renamed one
+	NewDataFile string `json:"new-data-file,omitempty"`
+	// original data file that a move puts aside until it's erased
+	AsideFile string    `json:"aside-file,omitempty"`
+	Trace     string    `json:"trace"`
+	StartedAt time.Time `json:"started-at"`
+}
+
+func (m Manager) journalFilePath(operation, name string) string {
+	return filepath.Join(m.stateDir, journalDirName, operation+"-"+name+".json")
+}
+
+// journal records an operation that is about to start, the record is removed by the returned func once it finishes
+func (m Manager) journal(ctx *context.Context, entry journalEntry) (finish func(), err error) {
+	entry.Trace = ctx.Trace
+	entry.StartedAt = time.Now()
+	path := m.journalFilePath(entry.Operation, entry.Volume)
+
+	ctx.
+		Level(context.Trace).
+		Field("journal-file", path).
+		Message("journaling operation")
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot create journal dir '%s'", filepath.Dir(path))
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot serialize journal entry")
+		return
+	}
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot write journal file '%s'", path)
+		return
+	}
+
+	finish = func() {
+		errRemove := os.Remove(path)
+		if errRemove != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", errRemove).
+				Message("cannot remove journal file - the operation will be rolled back on next start")
+		}
+	}
+	return
+}
+
+// Recover rolls back operations that were interrupted, e.g. because the plugin was killed in the middle of them, as
+// requests that started them have never succeeded. Volumes they were rolled back for are returned.
+func (m Manager) Recover(ctx *context.Context) (recovered []string, err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/Recover")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Field(":return/recovered", recovered).
+					Message("finished")
+			}
+		}()
+	}
+
+	// read journal
+	var entries []journalEntry
+	{
+		journalDir := filepath.Join(m.stateDir, journalDirName)
+		ctx.
+			Level(context.Trace).
+			Field("journal-dir", journalDir).
+			Message("looking for interrupted operations")
+
+		var files []os.FileInfo
+		files, err = readDirIfExists(journalDir)
+		if err != nil {
+			return
+		}
+		for _, file := range files {
+			path := filepath.Join(journalDir, file.Name())
+			var entry journalEntry
+			data, errRead := ioutil.ReadFile(path)
+			if errRead == nil {
+				errRead = json.Unmarshal(data, &entry)
+			}
+			if errRead != nil {
+				ctx.
+					Level(context.Warning).
+					Field("journal-file", path).
+					Field("err", errRead).
+					Message("cannot read journal file - removing it")
+				_ = os.Remove(path)
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Operation == journalMount && entries[j].Operation != journalMount
+		})
+	}
+
+	mounts, err := readMounts()
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		ctx := ctx.Copy().
+			Field("operation", entry.Operation).
+			Field("volume", entry.Volume).
+			Field("interrupted-trace", entry.Trace)
+
+		ctx.
+			Level(context.Warning).
+			Field("started-at", entry.StartedAt.Format(time.RFC3339)).
+			Message("rolling back interrupted operation")
+
+		var errRollback error
+		switch entry.Operation {
+		case journalMount:
+			errRollback = m.rollbackMount(ctx.Derived(), entry, mounts)
+		case journalCreate:
+			errRollback = m.rollbackCreate(ctx.Derived(), entry)
+		case journalRename:
+			errRollback = m.rollbackRename(ctx.Derived(), entry)
+		case journalConvert:
+			errRollback = m.rollbackConvert(ctx.Derived(), entry, mounts)
+		case journalMove:
+			errRollback = m.rollbackMove(ctx.Derived(), entry)
+		default:
+			errRollback = errors.Errorf("unknown operation '%s'", entry.Operation)
+		}
+		if errRollback != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", errRollback).
+				Message("cannot roll back interrupted operation - 'gc' may clean up leftovers")
+		}
+
+		_ = os.Remove(m.journalFilePath(entry.Operation, entry.Volume))
+		recovered = append(recovered, entry.Volume)
+	}
+
+	return
+}
+
+// rollbackMount drops the lease of an interrupted mount and un-mounts the volume unless other leases remain
+func (m Manager) rollbackMount(ctx *context.Context, entry journalEntry, mounts map[string]string) (err error) {
+	stateDir := filepath.Join(m.stateDir, entry.Volume)
+	leaseFile := filepath.Join(stateDir, entry.Lease)
+
+	ctx.
+		Level(context.Trace).
+		Field("lease-file", leaseFile).
+		Message("removing lease-file")
+	err = os.Remove(leaseFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "cannot remove lease file '%s'", leaseFile)
+	}
+
+	leases, err := readDirIfExists(stateDir)
+	if err != nil || len(leases) > 0 {
+		return
+	}
+	_ = os.Remove(stateDir)
+
+	mountPointPath := filepath.Join(m.mountDir, entry.Volume)
+	if _, mounted := mounts[mountPointPath]; mounted {
+		ctx.
+			Level(context.Trace).
+			Field("mount-point", mountPointPath).
+			Message("un-mounting volume without leases")
+		err = unmountDataFile(ctx.Derived(), entry.DataFile, mountPointPath)
+	}
+	return
+}
+
+// rollbackCreate removes data file and metadata file of a volume whose creation was interrupted
+func (m Manager) rollbackCreate(ctx *context.Context, entry journalEntry) (err error) {
+	for _, path := range []string{metadataFilePath(filepath.Dir(entry.DataFile), entry.Volume), entry.DataFile} {
+		ctx.
+			Level(context.Trace).
+			Field("path", path).
+			Message("removing partially created file")
+		errRemove := os.Remove(path)
+		if errRemove != nil && !os.IsNotExist(errRemove) && err == nil {
+			err = errors.Wrapf(errRemove, "cannot remove '%s'", path)
+		}
+	}
+	return
+}
+
+// rollbackRename moves data file and metadata file of a volume whose rename was interrupted back under the old name
+func (m Manager) rollbackRename(ctx *context.Context, entry journalEntry) (err error) {
+	dataDir := filepath.Dir(entry.DataFile)
+	newName := filepath.Base(entry.NewDataFile)
+	for _, paths := range [][2]string{
+		{entry.NewDataFile, entry.DataFile},
+		{metadataFilePath(dataDir, newName), metadataFilePath(dataDir, entry.Volume)},
+	} {
+		newPath, path := paths[0], paths[1]
+		_, errNew := os.Lstat(newPath)
+		_, errOld := os.Lstat(path)
+		if errNew != nil || !os.IsNotExist(errOld) {
+			continue
+		}
+		ctx.
+			Level(context.Trace).
+			Field("path", newPath).
+			Field("old-path", path).
+			Message("restoring renamed file")
+		errRename := os.Rename(newPath, path)
+		if errRename != nil && err == nil {
+			err = errors.Wrapf(errRename, "cannot rename '%s' back to '%s'", newPath, path)
+		}
+	}
+	return
+}
+
+// rollbackConvert cleans up after an interrupted fs conversion and makes metadata match the fs of the data file that
+// ended up in place, no matter whether the conversion was interrupted before or after the data files were swapped
+func (m Manager) rollbackConvert(ctx *context.Context, entry journalEntry, mounts map[string]string) (err error) {
+	for _, mountPointPath := range []string{entry.NewDataFile + ".source", entry.NewDataFile + ".target"} {
+		if _, mounted := mounts[mountPointPath]; mounted {
+			ctx.
+				Level(context.Trace).
+				Field("mount-point", mountPointPath).
+				Message("un-mounting data-file left mounted by conversion")
+			err = unmountDataFile(ctx.Derived(), entry.DataFile, mountPointPath)
+			if err != nil {
+				return
+			}
+		}
+		_ = os.RemoveAll(mountPointPath)
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("new-data-file", entry.NewDataFile).
+		Message("removing new data-file that was not swapped in")
+	err = os.Remove(entry.NewDataFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "cannot remove '%s'", entry.NewDataFile)
+	}
+	err = nil
+
+	metadataFile := metadataFilePath(filepath.Dir(entry.DataFile), entry.Volume)
+	metadata, err := readMetadata(ctx.Derived(), metadataFile)
+	if err != nil {
+		return
+	}
+	fs, err := runCommand(ctx.Derived(), "blkid", "-o", "value", "-s", "TYPE", entry.DataFile)
+	if err != nil {
+		return errors.Wrapf(err, "cannot detect fs of data file '%s': %s", entry.DataFile, fs)
+	}
+	if metadata.Fs != "" && metadata.Fs != fs {
+		ctx.
+			Level(context.Trace).
+			Field("metadata-fs", metadata.Fs).
+			Field("fs", fs).
+			Message("updating metadata-file to match data-file")
+		metadata.Fs = fs
+		err = writeMetadata(ctx.Derived(), metadataFile, metadata)
+	}
+	return
+}
+
+// rollbackMove removes the copy of a volume whose move was interrupted before the original was moved aside, so that
+// the volume is not left in both pools, otherwise it completes the move by disposing of the original
+func (m Manager) rollbackMove(ctx *context.Context, entry journalEntry) (err error) {
+	dataDir := filepath.Dir(entry.DataFile)
+	newDataDir := filepath.Dir(entry.NewDataFile)
+
+	_, err = os.Lstat(entry.DataFile)
+	if err == nil {
+		for _, path := range []string{
+			filepath.Join(newDataDir, tmpDirName, entry.Volume),
+			entry.NewDataFile,
+			metadataFilePath(newDataDir, entry.Volume),
+		} {
+			ctx.
+				Level(context.Trace).
+				Field("path", path).
+				Message("removing copy left in target pool")
+			errRemove := os.Remove(path)
+			if errRemove != nil && !os.IsNotExist(errRemove) && err == nil {
+				err = errors.Wrapf(errRemove, "cannot remove '%s'", path)
+			}
+		}
+		return
+	}
+	if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "cannot access '%s'", entry.DataFile)
+	}
+	err = nil
+
+	path := metadataFilePath(dataDir, entry.Volume)
+	ctx.
+		Level(context.Trace).
+		Field("path", path).
+		Message("removing metadata-file left in source pool")
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "cannot remove '%s'", path)
+	}
+	err = nil
+
+	info, err := os.Stat(entry.AsideFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	metadata, err := readMetadata(ctx.Derived(), metadataFilePath(newDataDir, entry.Volume))
+	if err != nil {
+		return
+	}
+	err = m.disposeOfDataFile(ctx.Derived(), Volume{
+		Name:           entry.Volume,
+		DataFilePath:   entry.AsideFile,
+		MaxSizeInBytes: uint64(info.Size()),
+		Metadata:       metadata,
+	}, nil)
+	return
+}
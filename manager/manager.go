@@ -9,7 +9,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 var (
@@ -21,22 +23,46 @@ var (
 		"xfs":  {"-f"},
 	}
 
+	// Flags that prevent mkfs from discarding blocks so that data file stays fully allocated
+	MkFsKeepAllocatedOptions = map[string][]string{
+		"ext4": {"-E", "nodiscard"},
+		"xfs":  {"-K"},
+	}
+
 	MountOptions = map[string][]string{
 		"ext4": {},
 		"xfs":  {"-o", "nouuid"},
 	}
 )
 
+// Lease used by the plugin itself when it needs to access volume contents
+const internalLease = "driver"
+
+// Hidden sub-directory of data dir used to prepare data files before they are moved into place
+const tmpDirName = ".tmp"
+
 type Manager struct {
-	stateDir string
-	dataDir  string
-	mountDir string
+	stateDir     string
+	mountDir     string
+	secureDelete string
+	erasures     *erasures
+
+	pools      []Pool // default pool goes first
+	placement  string
+	placements *uint64 // number of volumes placed so far, used for round-robin placement
 }
 
 type Config struct {
-	StateDir string
-	DataDir  string
-	MountDir string
+	StateDir     string
+	DataDir      string // data dir of the default pool
+	MountDir     string
+	SecureDelete string
+
+	MinFreeSpace        int64   // bytes to be kept available in data dir of the default pool
+	MaxOversubscription float64 // max ratio of volumes' total size to data dir capacity, 0 for no limit
+
+	Pools     []Pool // pools in addition to the default one
+	Placement string // strategy to pick a pool when one is not requested explicitly
 }
 
 func New(ctx *context.Context, cfg Config) (manager Manager, err error) {
@@ -98,7 +124,6 @@ func New(ctx *context.Context, cfg Config) (manager Manager, err error) {
 		err = errors.Errorf("DataDir (%s) must be an absolute path", cfg.DataDir)
 		return
 	}
-	manager.dataDir = cfg.DataDir
 
 	// mount dir
 	ctx.
@@ -116,6 +141,83 @@ func New(ctx *context.Context, cfg Config) (manager Manager, err error) {
 	}
 	manager.mountDir = cfg.MountDir
 
+	// secure delete
+	ctx.
+		Level(context.Trace).
+		Field("SecureDelete", cfg.SecureDelete).
+		Message("validating 'SecureDelete' config field")
+	if cfg.SecureDelete == "" {
+		cfg.SecureDelete = SecureDeleteNone
+	}
+	if !IsValidSecureDeleteMethod(cfg.SecureDelete) {
+		err = errors.Errorf(
+			"SecureDelete (%s) must be one of: %s", cfg.SecureDelete, strings.Join(SecureDeleteMethods, ", "))
+		return
+	}
+	manager.secureDelete = cfg.SecureDelete
+	manager.erasures = &erasures{cancels: make(map[string]chan struct{}), deleting: make(map[string]struct{})}
+
+	// capacity limits
+	ctx.
+		Level(context.Trace).
+		Field("MinFreeSpace", cfg.MinFreeSpace).
+		Field("MaxOversubscription", cfg.MaxOversubscription).
+		Message("validating capacity limits config fields")
+	if cfg.MinFreeSpace < 0 {
+		err = errors.Errorf("MinFreeSpace (%d) must not be negative", cfg.MinFreeSpace)
+		return
+	}
+	if cfg.MaxOversubscription < 0 {
+		err = errors.Errorf("MaxOversubscription (%g) must not be negative", cfg.MaxOversubscription)
+		return
+	}
+
+	// pools
+	ctx.
+		Level(context.Trace).
+		Field("Pools", cfg.Pools).
+		Message("validating 'Pools' config field")
+	manager.pools = []Pool{{
+		Name:                DefaultPool,
+		DataDir:             cfg.DataDir,
+		Fs:                  "xfs",
+		MinFreeSpace:        cfg.MinFreeSpace,
+		MaxOversubscription: cfg.MaxOversubscription,
+	}}
+	for _, pool := range cfg.Pools {
+		err = validatePool(pool)
+		if err != nil {
+			return
+		}
+		for _, other := range manager.pools {
+			if pool.Name == other.Name {
+				err = errors.Errorf("pool '%s' is defined more than once", pool.Name)
+				return
+			}
+			if filepath.Clean(pool.DataDir) == filepath.Clean(other.DataDir) {
+				err = errors.Errorf("pools '%s' and '%s' share data dir '%s'", other.Name, pool.Name, pool.DataDir)
+				return
+			}
+		}
+		manager.pools = append(manager.pools, pool)
+	}
+
+	// placement
+	ctx.
+		Level(context.Trace).
+		Field("Placement", cfg.Placement).
+		Message("validating 'Placement' config field")
+	if cfg.Placement == "" {
+		cfg.Placement = PlacementMostFree
+	}
+	if cfg.Placement != PlacementMostFree && cfg.Placement != PlacementRoundRobin {
+		err = errors.Errorf(
+			"Placement (%s) must be one of: %s", cfg.Placement, strings.Join(PlacementStrategies, ", "))
+		return
+	}
+	manager.placement = cfg.Placement
+	manager.placements = new(uint64)
+
 	return
 }
 
@@ -146,15 +248,46 @@ func (m Manager) List(ctx *context.Context) (volumes []string, err error) {
 		}()
 	}
 
+	// volume names are unique across pools unless data files were moved around manually
+	seen := make(map[string]string)
+	for _, pool := range m.pools {
+		var names []string
+		names, err = m.listPool(ctx.Derived(), pool)
+		if err != nil {
+			return
+		}
+		for _, name := range names {
+			if other, duplicate := seen[name]; duplicate {
+				ctx.
+					Level(context.Warning).
+					Field("volume", name).
+					Field("pool", pool.Name).
+					Field("used-pool", other).
+					Message("volume exists in more than one pool - only the first one is used")
+				continue
+			}
+			seen[name] = pool.Name
+			volumes = append(volumes, name)
+		}
+	}
+
+	return
+}
+
+func (m Manager) listPool(ctx *context.Context, pool Pool) (volumes []string, err error) {
+	ctx = ctx.
+		Field(":func", "manager/listPool").
+		Field("pool", pool.Name)
+
 	// read data dir
 	var files []os.FileInfo
 	{
 		ctx.
 			Level(context.Trace).
-			Field("data-dir", m.dataDir).
+			Field("data-dir", pool.DataDir).
 			Message("checking if data-dir exists")
 
-		_, err = os.Stat(m.dataDir)
+		_, err = os.Stat(pool.DataDir)
 		if err != nil {
 			if os.IsNotExist(err) {
 				err = nil
@@ -163,16 +296,16 @@ func (m Manager) List(ctx *context.Context) (volumes []string, err error) {
 					Message("data-dir does not exist - no volumes to report")
 				return
 			}
-			err = errors.Wrapf(err, "couldn't access data dir '%s'", m.dataDir)
+			err = errors.Wrapf(err, "couldn't access data dir '%s'", pool.DataDir)
 			return
 		}
 
 		ctx.
 			Level(context.Trace).
 			Message("reading data-dir")
-		files, err = ioutil.ReadDir(m.dataDir)
+		files, err = ioutil.ReadDir(pool.DataDir)
 		if err != nil {
-			err = errors.Wrapf(err, "couldn't list files/directories from data dir '%s'", m.dataDir)
+			err = errors.Wrapf(err, "couldn't list files/directories from data dir '%s'", pool.DataDir)
 		}
 	}
 
@@ -197,6 +330,28 @@ func (m Manager) List(ctx *context.Context) (volumes []string, err error) {
 		}
 	}
 
+	// archived volumes have no data files
+	{
+		ctx.
+			Level(context.Trace).
+			Message("reading archive dir")
+		var archived []string
+		archived, err = listArchives(pool)
+		if err != nil {
+			return
+		}
+		for _, name := range archived {
+			if _, errStat := os.Lstat(filepath.Join(pool.DataDir, name)); errStat == nil {
+				continue // leftover of interrupted archiving or restore
+			}
+			ctx.
+				Level(context.Trace).
+				Field("entry", name).
+				Message("including archive as a volume")
+			volumes = append(volumes, name)
+		}
+	}
+
 	return
 }
 
@@ -250,7 +405,7 @@ func (m Manager) Get(ctx *context.Context, name string) (volume Volume, err erro
 	return
 }
 
-func (m Manager) Create(ctx *context.Context, name string, sizeInBytes int64, sparse bool, fs string, uid, gid int, mode uint32) (err error) {
+func (m Manager) Create(ctx *context.Context, name string, sizeInBytes int64, metadata Metadata, poolName string) (err error) {
 	// tracing
 	ctx = ctx.
 		Field(":func", "manager/Create")
@@ -261,11 +416,8 @@ func (m Manager) Create(ctx *context.Context, name string, sizeInBytes int64, sp
 			Level(context.Debug).
 			Field(":param/name", name).
 			Field(":param/sizeInBytes", sizeInBytes).
-			Field(":param/sparse", sparse).
-			Field(":param/fs", fs).
-			Field(":param/uid", uid).
-			Field(":param/gid", gid).
-			Field(":param/mode", fmt.Sprintf("%#o", mode)).
+			Field(":param/metadata", metadata).
+			Field(":param/poolName", poolName).
 			Message("invoked")
 
 		defer func() {
@@ -283,8 +435,9 @@ func (m Manager) Create(ctx *context.Context, name string, sizeInBytes int64, sp
 		}()
 	}
 
+	sparse, fs, uid, gid, mode := metadata.Sparse, metadata.Fs, metadata.Uid, metadata.Gid, metadata.Mode
+
 	// validation
-	var mkfsFlags []string
 	{
 		ctx.
 			Level(context.Trace).
@@ -302,7 +455,7 @@ func (m Manager) Create(ctx *context.Context, name string, sizeInBytes int64, sp
 			Field("min-size", minSize).
 			Message("validating size to be below min-size")
 		if sizeInBytes < minSize {
-			return errors.Errorf(
+			return errors.Wrapf(ErrInvalid,
 				"requested size '%d' is smaller than minimum allowed 20MB", sizeInBytes)
 		}
 
@@ -311,12 +464,65 @@ func (m Manager) Create(ctx *context.Context, name string, sizeInBytes int64, sp
 			Level(context.Trace).
 			Field("fs", fs).
 			Message("validating fs type to be ext4 or xfs")
-		var ok bool
-		mkfsFlags, ok = MkFsOptions[fs]
+		_, ok := MkFsOptions[fs]
 		if !ok {
-			err = errors.Errorf("only xfs and ext4 filesystems are supported, '%s' requested", fs)
+			err = errors.Wrapf(ErrInvalid, "only xfs and ext4 filesystems are supported, '%s' requested", fs)
+			return
+		}
+
+		ctx.
+			Level(context.Trace).
+			Field("reserve", metadata.Reserve).
+			Message("validating reservation mode")
+		if metadata.Reserve != "" && metadata.Reserve != ReserveNone && metadata.Reserve != ReserveStrict {
+			err = errors.Wrapf(ErrInvalid, "reservation mode must be either '%s' or '%s', '%s' requested",
+				ReserveNone, ReserveStrict, metadata.Reserve)
+			return
+		}
+		if metadata.Reserve == ReserveStrict && sparse {
+			err = errors.Wrapf(ErrInvalid, "'%s' reservation mode cannot be used with sparse volumes", ReserveStrict)
+			return
+		}
+
+		ctx.
+			Level(context.Trace).
+			Field("secure-delete", metadata.SecureDelete).
+			Message("validating secure delete method")
+		if metadata.SecureDelete != "" && !IsValidSecureDeleteMethod(metadata.SecureDelete) {
+			err = errors.Wrapf(ErrInvalid,
+				"secure delete method '%s' is not among supported ones: %s",
+				metadata.SecureDelete, strings.Join(SecureDeleteMethods, ", "))
+			return
+		}
+	}
+
+	// pool
+	var pool Pool
+	{
+		ctx.
+			Level(context.Trace).
+			Field("pool", poolName).
+			Message("resolving pool")
+		pool, err = m.Pool(poolName)
+		if err != nil {
 			return
 		}
+
+		ctx.
+			Level(context.Trace).
+			Message("checking if name is free in all pools")
+		for _, path := range m.namePaths(name) {
+			_, err = os.Lstat(path)
+			if err == nil {
+				err = errors.Wrapf(ErrExists, "cannot create volume '%s' - '%s' already exists", name, path)
+				return
+			}
+			if !os.IsNotExist(err) {
+				err = errors.Wrapf(err, "cannot access '%s'", path)
+				return
+			}
+			err = nil
+		}
 	}
 
 	// data dir
@@ -324,84 +530,53 @@ func (m Manager) Create(ctx *context.Context, name string, sizeInBytes int64, sp
 		var dataDirMode os.FileMode = 0755
 		ctx.
 			Level(context.Trace).
-			Field("datta-dir", m.dataDir).
+			Field("datta-dir", pool.DataDir).
 			Field("mode", fmt.Sprintf("%#o", dataDirMode)).
 			Message("ensuring data-dir exists and creating it with proper mode if not")
-		err = os.MkdirAll(m.dataDir, dataDirMode)
+		err = os.MkdirAll(pool.DataDir, dataDirMode)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot create data dir: '%s'", pool.DataDir)
+			return
+		}
+	}
+
+	// admission control
+	{
+		ctx.
+			Level(context.Trace).
+			Message("checking data dir capacity")
+		err = m.admit(ctx.Derived(), pool, sizeInBytes, sparse)
+		if err != nil {
+			return
+		}
+	}
+
+	// journal
+	var dataFilePath = filepath.Join(pool.DataDir, name)
+	{
+		ctx.
+			Level(context.Trace).
+			Message("journaling creation so that it's rolled back if interrupted")
+		var finish func()
+		finish, err = m.journal(ctx.Derived(), journalEntry{Operation: journalCreate, Volume: name, DataFile: dataFilePath})
 		if err != nil {
-			err = errors.Wrapf(err, "cannot create data dir: '%s'", m.dataDir)
 			return
 		}
+		defer finish()
 	}
 
 	// create data file
-	var dataFilePath = filepath.Join(m.dataDir, name)
 	{
 		ctx := ctx.
 			Field("data-file", dataFilePath).
 			Field("sparse", sparse)
 
-		if sparse {
-			ctx.
-				Level(context.Trace).
-				Message("attempting creation of a sparse data-file with 'truncate' exec")
-			var errStr string
-			errStr, err = runCommand(ctx.Derived(), "truncate", "-s", fmt.Sprint(sizeInBytes), dataFilePath)
-			if err != nil {
-				ctx.
-					Level(context.Trace).
-					Message("attempting to cleanup data-file")
-				_ = os.Remove(dataFilePath) // attempt to cleanup
-				err = errors.Wrapf(err, "error creating sparse data file: %s", errStr)
-				return
-			}
-		} else {
-			ctx.
-				Level(context.Trace).
-				Message("attempting creation of a regular data-file with 'fallocate' exec")
-			// Try using fallocate - super fast if data dir is on ext4 or xfs
-			var errStr string
-			errStr, err = runCommand(ctx.Derived(),
-				"fallocate", "-l", fmt.Sprint(sizeInBytes), dataFilePath)
-
-			// fallocate failed - either not enough space or unsupported FS
-			if err != nil {
-				// If there is not enough space then we just error out
-				if strings.Contains(errStr, "No space") {
-					ctx.
-						Level(context.Trace).
-						Message("attempting to cleanup data-file")
-					_ = os.Remove(dataFilePath) // Primitive attempt to cleanup
-					err = errors.Wrapf(err, "not enough disk space: '%s'", errStr)
-					return
-				}
-
-				ctx.
-					Level(context.Warning).
-					Message("it seems that 'fallocate' is not supported - falling back to 'dd' to create data-file")
-
-				// Here we assume that FS is unsupported and will fall back to 'dd' which is slow but should work everywhere
-				of := "of=" + dataFilePath
-				bs := int64(1e6)
-				count := sizeInBytes / bs // we lose some precision here but it's likely to be negligible
-				ctx.
-					Level(context.Trace).
-					Message("attempting creation of a regular data-file with 'dd' exec")
-				errStr, err = runCommand(ctx.Derived(),
-					"dd",
-					"if=/dev/zero", of, fmt.Sprintf("bs=%d", bs), fmt.Sprintf("count=%d", count),
-				)
-
-				// Something went wrong - likely no space on an fallocate-incompatible FS
-				if err != nil {
-					ctx.
-						Level(context.Trace).
-						Message("attempting to cleanup data-file")
-					_ = os.Remove(dataFilePath) // Primitive attempt to cleanup
-					err = errors.Wrapf(err, errStr)
-					return
-				}
-			}
+		ctx.
+			Level(context.Trace).
+			Message("attempting creation of data-file")
+		err = createDataFile(ctx.Derived(), dataFilePath, sizeInBytes, sparse)
+		if err != nil {
+			return
 		}
 		defer func() {
 			if err != nil {
@@ -421,80 +596,51 @@ func (m Manager) Create(ctx *context.Context, name string, sizeInBytes int64, sp
 			Field("data-file", dataFilePath).
 			Message("attempting to create fs within data-file")
 
-		var errStr string
-		errStr, err = runCommand(ctx.Derived(), "mkfs."+fs, append(mkfsFlags, dataFilePath)...)
+		err = formatDataFile(ctx.Derived(), dataFilePath, fs, sizeInBytes, metadata.Reserve)
 		if err != nil {
-			err = errors.Wrapf(err, "cannot format datafile as '%s' filesystem: %s", fs, errStr)
 			return
 		}
 	}
 
-	// At this point we're done - last step is to adjust ownership and mode if required.
-	ctx.
-		Level(context.Debug).
-		Message("initial volume creation complete")
-
-	if uid >= 0 || gid >= 0 || mode > 0 {
-		lease := "driver"
-		ctx := ctx.Field("lease", lease)
+	// persist metadata
+	{
+		metadata.CreatedAt = time.Now()
 
-		// mount volume to adjust its credentials
-		var mountPath string
-		{
-			ctx.
-				Level(context.Trace).
-				Message("mounting volume adjust credentials using fake lease")
+		metadataFilePath := metadataFilePath(pool.DataDir, name)
+		ctx := ctx.
+			Field("metadata-file", metadataFilePath)
 
-			mountPath, err = m.Mount(ctx.Derived(), name, lease)
+		ctx.
+			Level(context.Trace).
+			Message("writing metadata-file")
+		err = writeMetadata(ctx.Derived(), metadataFilePath, metadata)
+		if err != nil {
+			err = errors.Wrap(err, "cannot persist volume metadata")
+			return
+		}
+		defer func() {
 			if err != nil {
-				err = errors.Wrapf(err, "cannot mount volume to adjust its root owner/permissions")
-				return
-			}
-
-			defer func() {
 				ctx.
 					Level(context.Trace).
-					Message("un-mounting volume to clean-up")
-
-				err = m.UnMount(ctx.Derived(), name, lease)
-			}()
-		}
-
-		if mode > 0 {
-			ctx.
-				Level(context.Trace).
-				Field("mode", fmt.Sprintf("%#o", mode)).
-				Message("adjusting volume's root mode with 'chmod' exec")
-
-			var errStr string
-			errStr, err = runCommand(ctx.Derived(), "chmod", fmt.Sprintf("%#o", mode), mountPath)
-			if err != nil {
-
-				_ = m.UnMount(ctx.Derived(), name, lease)
-				err = errors.Wrapf(err, "cannot adjust volume root permissions: %s", errStr)
-				return
+					Message("attempting to cleanup metadata-file")
+				_ = os.Remove(metadataFilePath)
 			}
-		}
+		}()
+	}
 
-		if uid >= 0 || gid >= 0 {
-			ctx.
-				Level(context.Trace).
-				Field("uid", uid).
-				Field("gid", gid).
-				Message("adjusting volume's root uid/gid with 'chown' syscall")
+	// At this point we're done - last step is to adjust ownership and mode if required.
+	ctx.
+		Level(context.Debug).
+		Message("initial volume creation complete")
 
-			err = os.Chown(mountPath, uid, gid)
-			if err != nil {
-				err = errors.Wrapf(err, "cannot adjust volume root owner")
-				return
-			}
-		}
-	}
+	err = m.adjustRoot(ctx.Derived(), name, uid, gid, mode)
 
 	return
 }
 
-func (m Manager) Mount(ctx *context.Context, name string, lease string) (result string, err error) {
+// Mount gives out a lease on a volume mounting it unless it's mounted already. A pending move is completed first and the
+// lock that guards volumes, if given, is released once the volume is mounted while the original data file is erased.
+func (m Manager) Mount(ctx *context.Context, name string, lease string, lock sync.Locker) (result string, err error) {
 	// tracing
 	ctx = ctx.
 		Field(":func", "manager/Mount")
@@ -545,6 +691,10 @@ func (m Manager) Mount(ctx *context.Context, name string, lease string) (result
 			err = errors.Wrap(err, "cannot get volume metadata")
 			return
 		}
+		err = m.checkNotDeleting(volume)
+		if err != nil {
+			return
+		}
 	}
 
 	// check other usage
@@ -560,6 +710,44 @@ func (m Manager) Mount(ctx *context.Context, name string, lease string) (result
 		}
 	}
 
+	// pending move
+	if volume.Metadata.PendingMove != "" {
+		if isAlreadyMounted {
+			err = errors.Wrapf(ErrInUse,
+				"volume '%s' is frozen until it's un-mounted and moved to pool '%s'", name, volume.Metadata.PendingMove)
+			return
+		}
+
+		ctx.
+			Level(context.Trace).
+			Message("volume is not mounted - completing pending move before mounting it")
+		dispose, errMove := m.completePendingMove(ctx.Derived(), volume)
+		if errMove != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", errMove).
+				Message("cannot complete pending move - mounting volume where it is")
+		}
+		defer dispose(lock)
+		volume, err = m.getVolume(ctx.Derived(), name)
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume metadata")
+			return
+		}
+	}
+
+	// restore archived volume
+	if volume.IsArchived() {
+		ctx.
+			Level(context.Trace).
+			Message("volume is archived - restoring it before mounting")
+		volume, err = m.restore(ctx.Derived(), volume)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot restore archived volume '%s'", name)
+			return
+		}
+	}
+
 	// ensure state dir exists
 	{
 		ctx := ctx.
@@ -594,6 +782,20 @@ func (m Manager) Mount(ctx *context.Context, name string, lease string) (result
 		}
 	}
 
+	// journal
+	{
+		ctx.
+			Level(context.Trace).
+			Message("journaling mount so that it's rolled back if interrupted")
+		var finish func()
+		finish, err = m.journal(ctx.Derived(),
+			journalEntry{Operation: journalMount, Volume: name, Lease: lease, DataFile: volume.DataFilePath})
+		if err != nil {
+			return
+		}
+		defer finish()
+	}
+
 	// record lease
 	var leaseFile string
 	{
@@ -646,18 +848,6 @@ func (m Manager) Mount(ctx *context.Context, name string, lease string) (result
 				Level(context.Trace).
 				Message("volume already mounted at internal mount-point")
 		} else {
-			var mountPointMode os.FileMode = 0777
-			ctx.
-				Level(context.Trace).
-				Field("mode", fmt.Sprintf("%#o", mountPointMode)).
-				Message("creating mount-point")
-
-			err = os.Mkdir(volume.MountPointPath, mountPointMode)
-			if err != nil {
-				err = errors.Wrapf(err, "cannot create mount point dir '%s'", volume.MountPointPath)
-				return
-			}
-
 			ctx.
 				Level(context.Trace).
 				Message("resolving volume fs to determine mount options")
@@ -668,27 +858,11 @@ func (m Manager) Mount(ctx *context.Context, name string, lease string) (result
 				return
 			}
 
-			mountFlags := MountOptions[fs]
-
 			ctx.
 				Level(context.Trace).
-				Field("mount-flags", mountFlags).
 				Message("mounting volume to its internal mount-point")
-			var errStr string
-			errStr, err = runCommand(ctx.Derived(),
-				"mount",
-				append(mountFlags, volume.DataFilePath, volume.MountPointPath)...,
-			)
-
+			err = mountDataFile(ctx.Derived(), volume.DataFilePath, volume.MountPointPath, fs)
 			if err != nil {
-				ctx.
-					Level(context.Trace).
-					Message("attempting to cleanup internal mount-point")
-				_ = os.RemoveAll(volume.MountPointPath)
-
-				err = errors.Wrapf(err,
-					"cannot mount data file '%s' at '%s': %s",
-					volume.DataFilePath, volume.MountPointPath, errStr)
 				return
 			}
 		}
@@ -698,7 +872,9 @@ func (m Manager) Mount(ctx *context.Context, name string, lease string) (result
 	return
 }
 
-func (m Manager) UnMount(ctx *context.Context, name string, lease string) (err error) {
+// UnMount drops a lease on a volume un-mounting it once no leases are left. A pending move is completed then, the lock
+// that guards volumes, if given, is released while the original data file is erased.
+func (m Manager) UnMount(ctx *context.Context, name string, lease string, lock sync.Locker) (err error) {
 	// tracing
 	ctx = ctx.
 		Field(":func", "manager/UnMount")
@@ -772,7 +948,7 @@ func (m Manager) UnMount(ctx *context.Context, name string, lease string) (err e
 			Message("checking if volume is mounted anywhere else")
 		isMountedAnywhereElse, err = volume.IsMounted(ctx.Derived())
 		if err != nil {
-			err = errors.Wrapf(err, "cannot figure out if volume is used anywhere else", lease)
+			err = errors.Wrap(err, "cannot figure out if volume is used anywhere else")
 			return
 		}
 	}
@@ -786,38 +962,228 @@ func (m Manager) UnMount(ctx *context.Context, name string, lease string) (err e
 				Message("removing volume's state-dir because it is not mounted anywhere else")
 			err = os.RemoveAll(volume.StateDir)
 			if err != nil {
-				err = errors.Wrapf(err, "cannot remove its state dir", lease)
+				err = errors.Wrap(err, "cannot remove its state dir")
 				return
 			}
 
 			ctx.
 				Level(context.Trace).
 				Message("un-mounting volume from its internal mount-point")
-			var errStr string
-			errStr, err = runCommand(ctx.Derived(), "umount", "-ld", volume.MountPointPath)
-
+			err = unmountDataFile(ctx.Derived(), volume.DataFilePath, volume.MountPointPath)
 			if err != nil {
-				err = errors.Wrapf(err,
-					"cannot un-mount data file '%s' from '%s': %s",
-					volume.DataFilePath, volume.MountPointPath, errStr)
 				return
 			}
+
 			ctx.
 				Level(context.Trace).
-				Field("mount-point", volume.MountPointPath).
-				Message("removing internal mount-point dir")
-			err = os.RemoveAll(volume.MountPointPath)
+				Message("recording un-mount time in metadata-file")
+			unmountedAt := time.Now()
+			volume.Metadata.UnmountedAt = &unmountedAt
+			err = writeMetadata(ctx.Derived(), volume.MetadataFilePath, volume.Metadata)
+			if err != nil {
+				err = errors.Wrap(err, "cannot persist volume metadata")
+				return
+			}
+
+			// volume is un-mounted successfully even if the move fails, it will not be retried
+			dispose, errMove := m.completePendingMove(ctx.Derived(), volume)
+			if errMove != nil {
+				ctx.
+					Level(context.Error).
+					Field("err", errMove).
+					Message("cannot complete pending move - volume stays where it is")
+			}
+			dispose(lock)
+		}
+	}
+
+	return
+}
+
+// ForceUnmount drops all leases of a volume and lazily un-mounts it even if containers still use it.
+func (m Manager) ForceUnmount(ctx *context.Context, name string) (err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/ForceUnmount")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// get metadata
+	var volume Volume
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.Get(ctx.Derived(), name)
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume metadata")
+			return
+		}
+	}
+
+	// drop leases
+	{
+		var leases []string
+		leases, err = volume.Leases(ctx.Derived())
+		if err != nil {
+			return
+		}
+		if len(leases) == 0 {
+			err = errors.Errorf("volume '%s' is not mounted", name)
+			return
+		}
+
+		ctx.
+			Level(context.Warning).
+			Field("volume", name).
+			Field("leases", leases).
+			Message("dropping volume leases")
+		err = os.RemoveAll(volume.StateDir)
+		if err != nil {
+			err = errors.Wrap(err, "cannot remove its state dir")
+			return
+		}
+	}
+
+	// un-mount
+	{
+		ctx.
+			Level(context.Trace).
+			Message("un-mounting volume from its internal mount-point")
+		err = unmountDataFile(ctx.Derived(), volume.DataFilePath, volume.MountPointPath)
+		if err != nil {
+			return
+		}
+
+		ctx.
+			Level(context.Trace).
+			Message("recording un-mount time in metadata-file")
+		unmountedAt := time.Now()
+		volume.Metadata.UnmountedAt = &unmountedAt
+		err = writeMetadata(ctx.Derived(), volume.MetadataFilePath, volume.Metadata)
+		if err != nil {
+			err = errors.Wrap(err, "cannot persist volume metadata")
+		}
+	}
+
+	return
+}
+
+// UnmountIdle un-mounts volumes that remain mounted at their internal mount-points without any leases, e.g. after
+// leases were dropped or an un-mount failed. Names of un-mounted volumes are returned.
+func (m Manager) UnmountIdle(ctx *context.Context) (unmounted []string, err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/UnmountIdle")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Message("invoked")
+
+		defer func() {
 			if err != nil {
-				err = errors.Wrapf(err, "cannot remove mount point dir '%s'", volume.MountPointPath)
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
 				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Field(":return/unmounted", unmounted).
+					Message("finished")
 			}
+		}()
+	}
+
+	// find mounted volumes
+	var names []string
+	var mounts map[string]string
+	{
+		ctx.
+			Level(context.Trace).
+			Message("listing volumes and mounts")
+		names, err = m.List(ctx.Derived())
+		if err != nil {
+			return
+		}
+		mounts, err = readMounts()
+		if err != nil {
+			return
+		}
+	}
+
+	// un-mount
+	for _, name := range names {
+		ctx := ctx.
+			Field("volume", name)
+
+		if _, mounted := mounts[filepath.Join(m.mountDir, name)]; !mounted {
+			continue
+		}
+
+		volume, errGet := m.getVolume(ctx.Derived(), name)
+		if errGet != nil {
+			continue
+		}
+		leases, errLeases := volume.Leases(ctx.Derived())
+		if errLeases != nil || len(leases) > 0 {
+			continue
+		}
+
+		ctx.
+			Level(context.Info).
+			Message("un-mounting volume without leases")
+		errUnmount := unmountDataFile(ctx.Derived(), volume.DataFilePath, volume.MountPointPath)
+		if errUnmount != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", errUnmount).
+				Message("cannot un-mount volume")
+			continue
+		}
+		_ = os.Remove(volume.StateDir)
+
+		unmountedAt := time.Now()
+		volume.Metadata.UnmountedAt = &unmountedAt
+		errWrite := writeMetadata(ctx.Derived(), volume.MetadataFilePath, volume.Metadata)
+		if errWrite != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", errWrite).
+				Message("cannot record un-mount time in metadata-file")
 		}
+		unmounted = append(unmounted, name)
 	}
 
 	return
 }
 
-func (m Manager) Delete(ctx *context.Context, name string) (err error) {
+// Delete erases and removes a volume. Secure erasure may take long so the lock that guards volumes, if given, is released
+// meanwhile - the volume is marked as being deleted until then so that other operations refuse it.
+func (m Manager) Delete(ctx *context.Context, name string, lock sync.Locker) (err error) {
 	// tracing
 	ctx = ctx.
 		Field(":func", "manager/Delete")
@@ -866,6 +1232,23 @@ func (m Manager) Delete(ctx *context.Context, name string) (err error) {
 			err = errors.Wrap(err, "cannot get volume metadata")
 			return
 		}
+		err = m.checkNotDeleting(volume)
+		if err != nil {
+			return
+		}
+	}
+
+	// is it protected?
+	{
+		ctx.
+			Level(context.Trace).
+			Field("protected", volume.Metadata.Protected).
+			Message("checking if volume is protected")
+
+		if volume.Metadata.Protected {
+			err = errors.Wrapf(ErrProtected, "cannot delete volume '%s' until it is unprotected", name)
+			return
+		}
 	}
 
 	// is it still mounted?
@@ -882,9 +1265,47 @@ func (m Manager) Delete(ctx *context.Context, name string) (err error) {
 			return
 		}
 		if isMounted {
-			err = errors.Wrap(err, "volume still in use")
+			err = errors.Wrapf(ErrInUse, "cannot delete volume '%s'", name)
+			return
+		}
+	}
+
+	// archive takes place of data file of an archived volume
+	if volume.IsArchived() {
+		var info os.FileInfo
+		info, err = os.Stat(volume.ArchiveFilePath)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot stat archive '%s'", volume.ArchiveFilePath)
 			return
 		}
+		volume.DataFilePath = volume.ArchiveFilePath
+		volume.MaxSizeInBytes = uint64(info.Size())
+	}
+
+	// erase data file
+	{
+		method := m.secureDeleteMethod(volume)
+
+		if method != SecureDeleteNone {
+			ctx.
+				Level(context.Trace).
+				Field("method", method).
+				Message("securely erasing data-file")
+
+			m.setDeleting(name, true)
+			err = func() error {
+				if lock != nil {
+					lock.Unlock()
+					defer lock.Lock()
+				}
+				return m.eraseDataFile(ctx.Derived(), volume, method)
+			}()
+			m.setDeleting(name, false)
+			if err != nil {
+				err = errors.Wrap(err, "cannot securely erase volume data")
+				return
+			}
+		}
 	}
 
 	// delete data file
@@ -902,6 +1323,88 @@ func (m Manager) Delete(ctx *context.Context, name string) (err error) {
 		}
 	}
 
+	// delete metadata file
+	{
+		metadataFilePath := volume.MetadataFilePath
+		ctx.
+			Level(context.Trace).
+			Field("metadata-file", metadataFilePath).
+			Message("removing metadata-file")
+
+		err = os.Remove(metadataFilePath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				err = errors.Wrapf(err, "cannot delete '%s'", metadataFilePath)
+				return
+			}
+			err = nil
+		}
+	}
+
+	return
+}
+
+func (m Manager) SetProtected(ctx *context.Context, name string, protected bool) (err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/SetProtected")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/protected", protected).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// get metadata
+	var volume Volume
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.Get(ctx.Derived(), name)
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume metadata")
+			return
+		}
+		err = m.checkNotDeleting(volume)
+		if err != nil {
+			return
+		}
+	}
+
+	// update metadata
+	{
+		metadataFilePath := volume.MetadataFilePath
+		ctx.
+			Level(context.Trace).
+			Field("metadata-file", metadataFilePath).
+			Message("updating metadata-file")
+
+		volume.Metadata.Protected = protected
+		err = writeMetadata(ctx.Derived(), metadataFilePath, volume.Metadata)
+		if err != nil {
+			err = errors.Wrap(err, "cannot persist volume metadata")
+			return
+		}
+	}
+
 	return
 }
 
@@ -931,12 +1434,21 @@ func (m Manager) getVolume(ctx *context.Context, name string) (volume Volume, er
 		}()
 	}
 
-	volumeDataFilePath := filepath.Join(m.dataDir, name)
-	volumeDataFileInfo, err := os.Stat(volumeDataFilePath)
+	// pools are looked through in order so that the first one wins if data files were copied between them manually
+	var pool Pool
+	var volumeDataFilePath string
+	var volumeDataFileInfo os.FileInfo
+	for _, pool = range m.pools {
+		volumeDataFilePath = filepath.Join(pool.DataDir, name)
+		volumeDataFileInfo, err = os.Stat(volumeDataFilePath)
+		if err == nil || !os.IsNotExist(err) {
+			break
+		}
+	}
 
 	if err != nil {
 		if os.IsNotExist(err) {
-			err = errors.Errorf("volume '%s' does not exist", name)
+			volume, err = m.getArchivedVolume(ctx.Derived(), name)
 		}
 		return
 	}
@@ -957,14 +1469,408 @@ func (m Manager) getVolume(ctx *context.Context, name string) (volume Volume, er
 
 	mountPointPath := filepath.Join(m.mountDir, name)
 
+	volumeMetadataFilePath := metadataFilePath(pool.DataDir, name)
+	metadata, err := readMetadata(ctx.Derived(), volumeMetadataFilePath)
+	if err != nil {
+		return
+	}
+
+	createdAt := volumeDataFileInfo.ModTime()
+	if !metadata.CreatedAt.IsZero() {
+		createdAt = metadata.CreatedAt
+	}
+
 	volume = Volume{
 		Name:                 name,
 		AllocatedSizeInBytes: uint64(details.Blocks * 512),
 		MaxSizeInBytes:       uint64(details.Size),
 		StateDir:             filepath.Join(m.stateDir, name),
 		DataFilePath:         volumeDataFilePath,
+		MetadataFilePath:     volumeMetadataFilePath,
+		Pool:                 pool.Name,
 		MountPointPath:       mountPointPath,
-		CreatedAt:            volumeDataFileInfo.ModTime(),
+		CreatedAt:            createdAt,
+		Metadata:             metadata,
+		fs:                   metadata.Fs,
+	}
+
+	return
+}
+
+func formatDataFile(ctx *context.Context, dataFilePath string, fs string, sizeInBytes int64, reserve string) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/formatDataFile")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/dataFilePath", dataFilePath).
+			Field(":param/fs", fs).
+			Field(":param/sizeInBytes", sizeInBytes).
+			Field(":param/reserve", reserve).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	mkfsFlags, ok := MkFsOptions[fs]
+	if !ok {
+		err = errors.Errorf("only xfs and ext4 filesystems are supported, '%s' requested", fs)
+		return
+	}
+	if reserve == ReserveStrict {
+		mkfsFlags = append(append([]string{}, mkfsFlags...), MkFsKeepAllocatedOptions[fs]...)
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("mkfs-flags", mkfsFlags).
+		Message("creating fs within data-file")
+
+	errStr, err := runCommand(ctx.Derived(), "mkfs."+fs, append(mkfsFlags, dataFilePath)...)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot format datafile as '%s' filesystem: %s", fs, errStr)
+		return
+	}
+
+	if reserve == ReserveStrict {
+		// mkfs may still release some blocks (e.g., older versions ignoring flags above) so we allocate them again
+		ctx.
+			Level(context.Trace).
+			Message("re-allocating data-file to keep disk space reserved")
+		err = allocateDataFile(ctx.Derived(), dataFilePath, sizeInBytes)
+		if err != nil {
+			return
+		}
+
+		ctx.
+			Level(context.Trace).
+			Message("verifying that entire data-file is allocated")
+		var stat syscall.Stat_t
+		err = syscall.Stat(dataFilePath, &stat)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot stat data file '%s'", dataFilePath)
+			return
+		}
+		allocated := stat.Blocks * 512
+		if allocated < sizeInBytes {
+			err = errors.Errorf(
+				"cannot reserve disk space: only %d out of %d bytes are allocated for '%s'",
+				allocated, sizeInBytes, dataFilePath)
+			return
+		}
+	}
+
+	return
+}
+
+// adjustRoot sets ownership and mode of volume's root, negative uid/gid and zero mode are left intact
+func (m Manager) adjustRoot(ctx *context.Context, name string, uid, gid int, mode uint32) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/adjustRoot")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/uid", uid).
+			Field(":param/gid", gid).
+			Field(":param/mode", fmt.Sprintf("%#o", mode)).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	if uid >= 0 || gid >= 0 || mode > 0 {
+		lease := internalLease
+		ctx := ctx.Field("lease", lease)
+
+		// mount volume to adjust its credentials
+		var mountPath string
+		{
+			ctx.
+				Level(context.Trace).
+				Message("mounting volume adjust credentials using fake lease")
+
+			mountPath, err = m.Mount(ctx.Derived(), name, lease, nil)
+			if err != nil {
+				err = errors.Wrapf(err, "cannot mount volume to adjust its root owner/permissions")
+				return
+			}
+
+			defer func() {
+				ctx.
+					Level(context.Trace).
+					Message("un-mounting volume to clean-up")
+
+				errUnMount := m.UnMount(ctx.Derived(), name, lease, nil)
+				if err == nil {
+					err = errUnMount
+				}
+			}()
+		}
+
+		if mode > 0 {
+			ctx.
+				Level(context.Trace).
+				Field("mode", fmt.Sprintf("%#o", mode)).
+				Message("adjusting volume's root mode with 'chmod' exec")
+
+			var errStr string
+			errStr, err = runCommand(ctx.Derived(), "chmod", fmt.Sprintf("%#o", mode), mountPath)
+			if err != nil {
+				err = errors.Wrapf(err, "cannot adjust volume root permissions: %s", errStr)
+				return
+			}
+		}
+
+		if uid >= 0 || gid >= 0 {
+			ctx.
+				Level(context.Trace).
+				Field("uid", uid).
+				Field("gid", gid).
+				Message("adjusting volume's root uid/gid with 'chown' syscall")
+
+			err = os.Chown(mountPath, uid, gid)
+			if err != nil {
+				err = errors.Wrapf(err, "cannot adjust volume root owner")
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func createDataFile(ctx *context.Context, dataFilePath string, sizeInBytes int64, sparse bool) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/createDataFile")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/dataFilePath", dataFilePath).
+			Field(":param/sizeInBytes", sizeInBytes).
+			Field(":param/sparse", sparse).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	if sparse {
+		ctx.
+			Level(context.Trace).
+			Message("attempting creation of a sparse data-file with 'truncate' exec")
+		var errStr string
+		errStr, err = runCommand(ctx.Derived(), "truncate", "-s", fmt.Sprint(sizeInBytes), dataFilePath)
+		if err != nil {
+			ctx.
+				Level(context.Trace).
+				Message("attempting to cleanup data-file")
+			_ = os.Remove(dataFilePath) // attempt to cleanup
+			err = errors.Wrapf(err, "error creating sparse data file: %s", errStr)
+			return
+		}
+	} else {
+		ctx.
+			Level(context.Trace).
+			Message("attempting creation of a regular data-file with 'fallocate' exec")
+		// Try using fallocate - super fast if data dir is on ext4 or xfs
+		var errStr string
+		errStr, err = runCommand(ctx.Derived(),
+			"fallocate", "-l", fmt.Sprint(sizeInBytes), dataFilePath)
+
+		// fallocate failed - either not enough space or unsupported FS
+		if err != nil {
+			// If there is not enough space then we just error out
+			if strings.Contains(errStr, "No space") {
+				ctx.
+					Level(context.Trace).
+					Message("attempting to cleanup data-file")
+				_ = os.Remove(dataFilePath) // Primitive attempt to cleanup
+				err = errors.Wrapf(err, "not enough disk space: '%s'", errStr)
+				return
+			}
+
+			ctx.
+				Level(context.Warning).
+				Message("it seems that 'fallocate' is not supported - falling back to 'dd' to create data-file")
+
+			// Here we assume that FS is unsupported and will fall back to 'dd' which is slow but should work everywhere
+			of := "of=" + dataFilePath
+			bs := int64(1e6)
+			count := sizeInBytes / bs // we lose some precision here but it's likely to be negligible
+			ctx.
+				Level(context.Trace).
+				Message("attempting creation of a regular data-file with 'dd' exec")
+			errStr, err = runCommand(ctx.Derived(),
+				"dd",
+				"if=/dev/zero", of, fmt.Sprintf("bs=%d", bs), fmt.Sprintf("count=%d", count),
+			)
+
+			// Something went wrong - likely no space on an fallocate-incompatible FS
+			if err != nil {
+				ctx.
+					Level(context.Trace).
+					Message("attempting to cleanup data-file")
+				_ = os.Remove(dataFilePath) // Primitive attempt to cleanup
+				err = errors.Wrap(err, errStr)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func mountDataFile(ctx *context.Context, dataFilePath string, mountPointPath string, fs string) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/mountDataFile")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/dataFilePath", dataFilePath).
+			Field(":param/mountPointPath", mountPointPath).
+			Field(":param/fs", fs).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	var mountPointMode os.FileMode = 0777
+	ctx.
+		Level(context.Trace).
+		Field("mode", fmt.Sprintf("%#o", mountPointMode)).
+		Message("creating mount-point")
+
+	err = os.Mkdir(mountPointPath, mountPointMode)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot create mount point dir '%s'", mountPointPath)
+		return
+	}
+
+	mountFlags := MountOptions[fs]
+
+	ctx.
+		Level(context.Trace).
+		Field("mount-flags", mountFlags).
+		Message("mounting data-file")
+	errStr, err := runCommand(ctx.Derived(),
+		"mount",
+		append(mountFlags, dataFilePath, mountPointPath)...,
+	)
+
+	if err != nil {
+		ctx.
+			Level(context.Trace).
+			Message("attempting to cleanup mount-point")
+		_ = os.RemoveAll(mountPointPath)
+
+		err = errors.Wrapf(err,
+			"cannot mount data file '%s' at '%s': %s",
+			dataFilePath, mountPointPath, errStr)
+	}
+
+	return
+}
+
+func unmountDataFile(ctx *context.Context, dataFilePath string, mountPointPath string) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/unmountDataFile")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/dataFilePath", dataFilePath).
+			Field(":param/mountPointPath", mountPointPath).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	ctx.
+		Level(context.Trace).
+		Message("un-mounting data-file")
+	errStr, err := runCommand(ctx.Derived(), "umount", "-ld", mountPointPath)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"cannot un-mount data file '%s' from '%s': %s",
+			dataFilePath, mountPointPath, errStr)
+		return
+	}
+
+	ctx.
+		Level(context.Trace).
+		Message("removing mount-point dir")
+	err = os.RemoveAll(mountPointPath)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot remove mount point dir '%s'", mountPointPath)
 	}
 
 	return
@@ -0,0 +1,157 @@
+package manager
+
+import (
+	"encoding/json"
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Metadata files are kept in a hidden sub-directory of data dir - volume names cannot start with a dot and
+// directories are not considered to be volumes so they never clash with data files.
+const metadataDirName = ".metadata"
+
+// Reservation modes
+const (
+	ReserveNone   = "none"   // disk space is reserved at creation but may be released by mkfs
+	ReserveStrict = "strict" // disk space is reserved at creation and verified to stay allocated after mkfs
+)
+
+// Metadata holds volume properties that cannot be derived from its data file and therefore are persisted next to it.
+type Metadata struct {
+	Sparse       bool   `json:"sparse"`
+	Fs           string `json:"fs"`
+	Uid          int    `json:"uid"`
+	Gid          int    `json:"gid"`
+	Mode         uint32 `json:"mode"`
+	SecureDelete string `json:"secure-delete,omitempty"`
+	Protected    bool   `json:"protected"`
+	Reserve      string `json:"reserve,omitempty"`
+	Profile      string `json:"profile,omitempty"`      // profile volume was created with, for reference only
+	Tenant       string `json:"tenant,omitempty"`       // tenant given explicitly, otherwise it's resolved by name prefix
+	Endpoint     string `json:"endpoint,omitempty"`     // endpoint volume was created through, empty for the main socket
+	PendingMove  string `json:"pending-move,omitempty"` // pool to move volume to once it's un-mounted
+
+	TTL         time.Duration `json:"ttl,omitempty"`
+	CreatedAt   time.Time     `json:"created-at"`
+	UnmountedAt *time.Time    `json:"unmounted-at,omitempty"`
+
+	ArchivedAt   *time.Time `json:"archived-at,omitempty"`
+	ArchivedSize uint64     `json:"archived-size,omitempty"` // size of data file while it's compressed
+}
+
+// NewMetadata returns metadata with defaults that match behavior of volumes created before metadata was introduced.
+func NewMetadata() Metadata {
+	return Metadata{
+		Uid: -1,
+		Gid: -1,
+	}
+}
+
+func metadataFilePath(dataDir, name string) string {
+	return filepath.Join(dataDir, metadataDirName, name)
+}
+
+func readMetadata(ctx *context.Context, path string) (metadata Metadata, err error) {
+	ctx = ctx.
+		Field(":func", "manager/readMetadata")
+
+	ctx.
+		Level(context.Debug).
+		Field(":param/path", path).
+		Message("invoked")
+
+	defer func() {
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field(":return/err", err).
+				Message("failed with an error")
+			return
+		} else {
+			ctx.
+				Level(context.Debug).
+				Field(":return/metadata", metadata).
+				Message("finished")
+		}
+	}()
+
+	metadata = NewMetadata()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			ctx.
+				Level(context.Trace).
+				Message("metadata file does not exist - using defaults")
+			err = nil
+			return
+		}
+		err = errors.Wrapf(err, "cannot read metadata file '%s'", path)
+		return
+	}
+
+	err = json.Unmarshal(content, &metadata)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot parse metadata file '%s'", path)
+	}
+
+	return
+}
+
+func writeMetadata(ctx *context.Context, path string, metadata Metadata) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/writeMetadata")
+
+	ctx.
+		Level(context.Debug).
+		Field(":param/path", path).
+		Field(":param/metadata", metadata).
+		Message("invoked")
+
+	defer func() {
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field(":return/err", err).
+				Message("failed with an error")
+			return
+		} else {
+			ctx.
+				Level(context.Debug).
+				Message("finished")
+		}
+	}()
+
+	var metadataDirMode os.FileMode = 0755
+	err = os.MkdirAll(filepath.Dir(path), metadataDirMode)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot create metadata dir '%s'", filepath.Dir(path))
+		return
+	}
+
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		err = errors.Wrap(err, "cannot serialize metadata")
+		return
+	}
+
+	// write to a temporary file first and then rename it so that metadata is never observed half-written
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, content, 0644)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot write metadata file '%s'", tmpPath)
+		return
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		err = errors.Wrapf(err, "cannot move metadata file '%s' into place", tmpPath)
+	}
+
+	return
+}
@@ -0,0 +1,478 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Move relocates data file of a volume that is not in use into another pool keeping its name and metadata.
+// The copy is verified with a checksum before it replaces the original. The original is erased the same way as a
+// deleted volume, with the lock that guards volumes, if given, released meanwhile.
+func (m Manager) Move(ctx *context.Context, name string, poolName string, lock sync.Locker) (err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/Move")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/poolName", poolName).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// get metadata
+	var volume Volume
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.getUnusedVolume(ctx.Derived(), name)
+		if err != nil {
+			return
+		}
+	}
+
+	dispose, err := m.move(ctx.Derived(), volume, poolName)
+	if err != nil {
+		return
+	}
+	dispose(lock)
+	return
+}
+
+// MoveOnUnmount moves a volume right away if it's not in use, otherwise the move is recorded in metadata and completed
+// once the volume is un-mounted for its last lease. No new leases are given out while the move is pending.
+func (m Manager) MoveOnUnmount(ctx *context.Context, name string, poolName string, lock sync.Locker) (moved bool, err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/MoveOnUnmount")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/poolName", poolName).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Field(":return/moved", moved).
+					Message("finished")
+			}
+		}()
+	}
+
+	// get metadata
+	var volume Volume
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.Get(ctx.Derived(), name)
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume metadata")
+			return
+		}
+		err = checkRestored(volume)
+		if err != nil {
+			return
+		}
+		err = m.checkNotDeleting(volume)
+		if err != nil {
+			return
+		}
+	}
+
+	// validation
+	{
+		ctx.
+			Level(context.Trace).
+			Field("pool", poolName).
+			Message("validating target pool")
+		_, err = m.Pool(poolName)
+		if err != nil {
+			return
+		}
+		if poolName == volume.Pool {
+			err = errors.Wrapf(ErrInvalid, "volume '%s' is already in pool '%s'", name, poolName)
+			return
+		}
+	}
+
+	// check usage
+	{
+		ctx.
+			Level(context.Trace).
+			Message("checking if volume is mounted")
+		var isMounted bool
+		isMounted, err = volume.IsMounted(ctx.Derived())
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume mount status")
+			return
+		}
+		if !isMounted {
+			var dispose func(lock sync.Locker)
+			dispose, err = m.move(ctx.Derived(), volume, poolName)
+			if err != nil {
+				return
+			}
+			dispose(lock)
+			moved = true
+			return
+		}
+	}
+
+	// record pending move
+	{
+		ctx.
+			Level(context.Trace).
+			Message("recording pending move in metadata-file")
+		volume.Metadata.PendingMove = poolName
+		err = writeMetadata(ctx.Derived(), volume.MetadataFilePath, volume.Metadata)
+		if err != nil {
+			err = errors.Wrap(err, "cannot persist volume metadata")
+		}
+	}
+
+	return
+}
+
+// completePendingMove moves a volume that is no longer in use if a move was recorded for it, the returned func
+// disposes of the original data file and is to be called once the caller is done with the volume
+func (m Manager) completePendingMove(ctx *context.Context, volume Volume) (dispose func(lock sync.Locker), err error) {
+	dispose = func(sync.Locker) {}
+	if volume.Metadata.PendingMove == "" {
+		return
+	}
+
+	ctx.
+		Level(context.Info).
+		Field("volume", volume.Name).
+		Field("pool", volume.Metadata.PendingMove).
+		Message("completing pending move")
+
+	disposeOriginal, err := m.move(ctx.Derived(), volume, volume.Metadata.PendingMove)
+	if err == nil {
+		dispose = disposeOriginal
+		return
+	}
+
+	// volume must not stay frozen if the move cannot be completed
+	volume.Metadata.PendingMove = ""
+	errWrite := writeMetadata(ctx.Derived(), volume.MetadataFilePath, volume.Metadata)
+	if errWrite != nil {
+		ctx.
+			Level(context.Error).
+			Field("err", errWrite).
+			Message("cannot clear pending move from metadata-file")
+	}
+	return
+}
+
+// move copies data file of a volume into another pool and swaps the copy in, the returned func erases and removes the
+// original data file releasing the lock, if given, meanwhile. The move stays journaled until the original is gone.
+func (m Manager) move(ctx *context.Context, volume Volume, poolName string) (dispose func(lock sync.Locker), err error) {
+	ctx = ctx.
+		Field(":func", "manager/move").
+		Field("volume", volume.Name)
+
+	// validation
+	var pool Pool
+	{
+		ctx.
+			Level(context.Trace).
+			Field("pool", poolName).
+			Message("validating target pool")
+		pool, err = m.Pool(poolName)
+		if err != nil {
+			return
+		}
+		if pool.Name == volume.Pool {
+			err = errors.Wrapf(ErrInvalid, "volume '%s' is already in pool '%s'", volume.Name, pool.Name)
+			return
+		}
+	}
+
+	// check capacity
+	{
+		ctx.
+			Level(context.Trace).
+			Message("checking whether target data dir can fit the volume")
+		err = os.MkdirAll(pool.DataDir, 0755)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot create data dir: '%s'", pool.DataDir)
+			return
+		}
+		err = m.admit(ctx.Derived(), pool, int64(volume.MaxSizeInBytes), volume.Metadata.Sparse)
+		if err != nil {
+			return
+		}
+	}
+
+	// journal - the original is moved aside under a name of its own as it may be still erased when the volume is moved
+	// back to its pool
+	newDataFilePath := filepath.Join(pool.DataDir, volume.Name)
+	asidePath := filepath.Join(filepath.Dir(volume.DataFilePath), tmpDirName, volume.Name+"."+ctx.Trace)
+	var finish func()
+	{
+		journalFilePath := m.journalFilePath(journalMove, volume.Name)
+		_, err = os.Lstat(journalFilePath)
+		if err == nil {
+			err = errors.Wrapf(ErrInUse,
+				"original data file of volume '%s' is still being erased after its last move", volume.Name)
+			return
+		}
+		if !os.IsNotExist(err) {
+			err = errors.Wrapf(err, "cannot access '%s'", journalFilePath)
+			return
+		}
+
+		finish, err = m.journal(ctx.Derived(), journalEntry{
+			Operation:   journalMove,
+			Volume:      volume.Name,
+			DataFile:    volume.DataFilePath,
+			NewDataFile: newDataFilePath,
+			AsideFile:   asidePath,
+		})
+		if err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				finish()
+			}
+		}()
+	}
+
+	// copy data file
+	tmpDataFilePath := filepath.Join(pool.DataDir, tmpDirName, volume.Name)
+	{
+		ctx := ctx.
+			Field("data-file", volume.DataFilePath).
+			Field("tmp-data-file", tmpDataFilePath)
+
+		var tmpDirMode os.FileMode = 0755
+		err = os.MkdirAll(filepath.Dir(tmpDataFilePath), tmpDirMode)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot create dir '%s'", filepath.Dir(tmpDataFilePath))
+			return
+		}
+
+		sparse := "--sparse=never"
+		if volume.Metadata.Sparse {
+			sparse = "--sparse=always"
+		}
+
+		ctx.
+			Level(context.Trace).
+			Field("sparse", sparse).
+			Message("copying data-file")
+		var errStr string
+		errStr, err = runCommand(ctx.Derived(), "cp", "--reflink=auto", sparse, volume.DataFilePath, tmpDataFilePath)
+		if err != nil {
+			_ = os.Remove(tmpDataFilePath)
+			err = errors.Wrapf(err, "cannot copy data file '%s': %s", volume.DataFilePath, errStr)
+			return
+		}
+		defer func() {
+			if err != nil {
+				ctx.
+					Level(context.Trace).
+					Message("attempting to cleanup data-file copy")
+				_ = os.Remove(tmpDataFilePath)
+			}
+		}()
+	}
+
+	// verify copy
+	{
+		ctx.
+			Level(context.Trace).
+			Message("verifying data-file copy")
+
+		var checksum, copyChecksum string
+		checksum, err = fileChecksum(volume.DataFilePath)
+		if err != nil {
+			return
+		}
+		copyChecksum, err = fileChecksum(tmpDataFilePath)
+		if err != nil {
+			return
+		}
+
+		ctx.
+			Level(context.Debug).
+			Field("checksum", checksum).
+			Field("copy-checksum", copyChecksum).
+			Message("compared checksums")
+		if checksum != copyChecksum {
+			err = errors.Errorf(
+				"copy of data file '%s' does not match the original - sha256 '%s' instead of '%s'",
+				volume.DataFilePath, copyChecksum, checksum)
+			return
+		}
+	}
+
+	// write metadata
+	newMetadataFilePath := metadataFilePath(pool.DataDir, volume.Name)
+	{
+		metadata := volume.Metadata
+		metadata.PendingMove = ""
+
+		ctx.
+			Level(context.Trace).
+			Field("metadata-file", newMetadataFilePath).
+			Message("writing metadata-file in target pool")
+		err = writeMetadata(ctx.Derived(), newMetadataFilePath, metadata)
+		if err != nil {
+			err = errors.Wrap(err, "cannot persist volume metadata")
+			return
+		}
+		defer func() {
+			if err != nil {
+				ctx.
+					Level(context.Trace).
+					Message("attempting to cleanup metadata-file in target pool")
+				_ = os.Remove(newMetadataFilePath)
+			}
+		}()
+	}
+
+	// swap data files - the copy is moved into place first so that the volume exists in one of the pools at any time
+	{
+		ctx := ctx.
+			Field("new-data-file", newDataFilePath).
+			Field("aside", asidePath)
+
+		ctx.
+			Level(context.Trace).
+			Message("moving data-file copy into place")
+		err = os.Rename(tmpDataFilePath, newDataFilePath)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot move data file '%s' into place", tmpDataFilePath)
+			return
+		}
+
+		ctx.
+			Level(context.Trace).
+			Message("moving original data-file aside")
+		err = os.MkdirAll(filepath.Dir(asidePath), 0755)
+		if err == nil {
+			err = os.Rename(volume.DataFilePath, asidePath)
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "cannot move data file '%s' aside", volume.DataFilePath)
+			ctx.
+				Level(context.Trace).
+				Message("attempting to cleanup data-file copy")
+			_ = os.Remove(newDataFilePath)
+			return
+		}
+
+		// the move is complete at this point, leftovers are reported but do not fail it
+		_ = os.Remove(volume.MetadataFilePath)
+
+		aside := volume
+		aside.DataFilePath = asidePath
+		dispose = func(lock sync.Locker) {
+			errDispose := m.disposeOfDataFile(ctx.Derived(), aside, lock)
+			if errDispose != nil {
+				ctx.
+					Level(context.Warning).
+					Field("err", errDispose).
+					Message("cannot dispose of original data-file - it will be done on next start")
+				return
+			}
+			finish()
+		}
+	}
+
+	ctx.
+		Level(context.Info).
+		Field("from", volume.Pool).
+		Field("to", pool.Name).
+		Message("moved volume")
+	return
+}
+
+// disposeOfDataFile securely erases and removes data file of a volume that was moved aside, the lock that guards
+// volumes, if given, is released while it's erased
+func (m Manager) disposeOfDataFile(ctx *context.Context, volume Volume, lock sync.Locker) (err error) {
+	method := m.secureDeleteMethod(volume)
+	if method != SecureDeleteNone {
+		ctx.
+			Level(context.Trace).
+			Field("data-file", volume.DataFilePath).
+			Field("method", method).
+			Message("securely erasing original data-file")
+		err = func() error {
+			if lock != nil {
+				lock.Unlock()
+				defer lock.Lock()
+			}
+			return m.eraseDataFile(ctx.Derived(), volume, method)
+		}()
+		if err != nil {
+			return errors.Wrap(err, "cannot securely erase original data file")
+		}
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("data-file", volume.DataFilePath).
+		Message("removing original data-file")
+	err = os.Remove(volume.DataFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "cannot remove '%s'", volume.DataFilePath)
+	}
+	return nil
+}
+
+func fileChecksum(path string) (checksum string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot open '%s'", path)
+		return
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot read '%s'", path)
+		return
+	}
+	checksum = hex.EncodeToString(hash.Sum(nil))
+	return
+}
@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Name of the pool that keeps volumes in the data dir specified directly in manager config
+const DefaultPool = "default"
+
+// Placement strategies used to pick a pool for a volume when one is not requested explicitly
+const (
+	PlacementMostFree   = "most-free"   // pool with the most disk space available
+	PlacementRoundRobin = "round-robin" // pools in turn, in the order they are configured
+)
+
+var PlacementStrategies = []string{PlacementMostFree, PlacementRoundRobin}
+
+// Pool is a data dir with its own defaults and capacity limits, volume names are unique across all pools
+type Pool struct {
+	Name    string
+	DataDir string
+	Fs      string // fs of volumes created without 'fs' option
+	Sparse  bool   // whether volumes created without 'sparse' option are sparse
+
+	MinFreeSpace        int64   // bytes to be kept available in data dir
+	MaxOversubscription float64 // max ratio of volumes' total size to data dir capacity, 0 for no limit
+}
+
+func validatePool(pool Pool) error {
+	if !NameRegex.MatchString(pool.Name) {
+		return errors.Errorf("pool name '%s' must match '%s'", pool.Name, NamePattern)
+	}
+	if pool.DataDir == "" {
+		return errors.Errorf("data dir of pool '%s' is not specified", pool.Name)
+	}
+	if !filepath.IsAbs(pool.DataDir) {
+		return errors.Errorf("data dir of pool '%s' (%s) must be an absolute path", pool.Name, pool.DataDir)
+	}
+	if _, ok := MkFsOptions[pool.Fs]; !ok {
+		return errors.Errorf("fs of pool '%s' must be either xfs or ext4, '%s' given", pool.Name, pool.Fs)
+	}
+	if pool.MinFreeSpace < 0 {
+		return errors.Errorf("MinFreeSpace (%d) of pool '%s' must not be negative", pool.MinFreeSpace, pool.Name)
+	}
+	if pool.MaxOversubscription < 0 {
+		return errors.Errorf(
+			"MaxOversubscription (%g) of pool '%s' must not be negative", pool.MaxOversubscription, pool.Name)
+	}
+	return nil
+}
+
+// Pools returns all pools, default one goes first
+func (m Manager) Pools() []Pool {
+	return append([]Pool(nil), m.pools...)
+}
+
+// Pool looks a pool up by its name
+func (m Manager) Pool(name string) (pool Pool, err error) {
+	for _, pool = range m.pools {
+		if pool.Name == name {
+			return
+		}
+	}
+	err = errors.Wrapf(ErrInvalid, "pool '%s' does not exist", name)
+	return
+}
+
+// Place picks a pool for a new volume according to the placement strategy
+func (m Manager) Place(ctx *context.Context) (pool Pool, err error) {
+	ctx = ctx.
+		Field(":func", "manager/Place")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field("placement", m.placement).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Field(":return/pool", pool.Name).
+					Message("finished")
+			}
+		}()
+	}
+
+	if len(m.pools) == 1 {
+		pool = m.pools[0]
+		return
+	}
+
+	switch m.placement {
+	case PlacementRoundRobin:
+		turn := atomic.AddUint64(m.placements, 1) - 1
+		pool = m.pools[turn%uint64(len(m.pools))]
+	default:
+		mostAvailable := int64(-1)
+		for _, candidate := range m.pools {
+			// space cannot be checked before data dir exists while it's about to be created anyway
+			err = os.MkdirAll(candidate.DataDir, 0755)
+			if err != nil {
+				err = errors.Wrapf(err, "cannot create data dir: '%s'", candidate.DataDir)
+				return
+			}
+			var available int64
+			_, available, err = diskSpace(candidate.DataDir)
+			if err != nil {
+				return
+			}
+			ctx.
+				Level(context.Trace).
+				Field("pool", candidate.Name).
+				Field("available", available).
+				Message("considering pool")
+			if available > mostAvailable {
+				pool, mostAvailable = candidate, available
+			}
+		}
+	}
+
+	return
+}
+
+// namePaths lists files in every pool that would clash with a volume of a given name
+func (m Manager) namePaths(name string) (paths []string) {
+	for _, pool := range m.pools {
+		paths = append(paths,
+			filepath.Join(pool.DataDir, name), metadataFilePath(pool.DataDir, name), archiveFilePath(pool.DataDir, name))
+	}
+	return
+}
@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+)
+
+// Rename changes name of a volume that is not in use by moving its data and metadata files.
+// Snapshots are independent volumes that keep no link to their source so they are not affected by its rename.
+func (m Manager) Rename(ctx *context.Context, name string, newName string) (err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/Rename")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/newName", newName).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// validation
+	{
+		ctx.
+			Level(context.Trace).
+			Field("new-name", newName).
+			Message("validating new name")
+		err = validateName(ctx.Derived(), newName)
+		if err != nil {
+			return
+		}
+	}
+
+	// get metadata
+	var volume Volume
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.Get(ctx.Derived(), name)
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume metadata")
+			return
+		}
+		err = checkRestored(volume)
+		if err != nil {
+			return
+		}
+		err = m.checkNotDeleting(volume)
+		if err != nil {
+			return
+		}
+	}
+
+	// is it still mounted?
+	{
+		ctx.
+			Level(context.Trace).
+			Message("checking if volume is still mounted")
+
+		var isMounted bool
+		isMounted, err = volume.IsMounted(ctx.Derived())
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume mount status")
+			return
+		}
+		if isMounted {
+			err = errors.Wrapf(ErrInUse, "cannot rename volume '%s'", name)
+			return
+		}
+	}
+
+	// is new name free?
+	// volume stays in the same pool
+	dataDir := filepath.Dir(volume.DataFilePath)
+	newDataFilePath := filepath.Join(dataDir, newName)
+	{
+		ctx.
+			Level(context.Trace).
+			Field("data-file", newDataFilePath).
+			Message("checking if new name is free")
+
+		for _, path := range append(m.namePaths(newName),
+			filepath.Join(m.stateDir, newName),
+			filepath.Join(m.mountDir, newName),
+		) {
+			_, err = os.Lstat(path)
+			if err == nil {
+				err = errors.Wrapf(ErrExists, "cannot rename volume '%s' to '%s' - '%s' already exists", name, newName, path)
+				return
+			}
+			if !os.IsNotExist(err) {
+				err = errors.Wrapf(err, "cannot access '%s'", path)
+				return
+			}
+			err = nil
+		}
+	}
+
+	// journal
+	{
+		var finish func()
+		finish, err = m.journal(ctx.Derived(), journalEntry{
+			Operation:   journalRename,
+			Volume:      name,
+			DataFile:    volume.DataFilePath,
+			NewDataFile: newDataFilePath,
+		})
+		if err != nil {
+			return
+		}
+		defer finish()
+	}
+
+	// move data file
+	{
+		ctx.
+			Level(context.Trace).
+			Field("data-file", volume.DataFilePath).
+			Field("new-data-file", newDataFilePath).
+			Message("renaming data-file")
+
+		err = os.Rename(volume.DataFilePath, newDataFilePath)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot rename data file '%s'", volume.DataFilePath)
+			return
+		}
+		defer func() {
+			if err != nil {
+				ctx.
+					Level(context.Trace).
+					Message("attempting to restore data-file")
+				_ = os.Rename(newDataFilePath, volume.DataFilePath)
+			}
+		}()
+	}
+
+	// move metadata file
+	{
+		newMetadataFilePath := metadataFilePath(dataDir, newName)
+		metadataFilePath := volume.MetadataFilePath
+
+		ctx.
+			Level(context.Trace).
+			Field("metadata-file", metadataFilePath).
+			Field("new-metadata-file", newMetadataFilePath).
+			Message("renaming metadata-file")
+
+		err = os.Rename(metadataFilePath, newMetadataFilePath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				err = errors.Wrapf(err, "cannot rename metadata file '%s'", metadataFilePath)
+				return
+			}
+			ctx.
+				Level(context.Trace).
+				Message("volume has no metadata-file")
+			err = nil
+		}
+	}
+
+	return
+}
@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"os"
+	"syscall"
+)
+
+// Reset wipes volume data by re-creating its filesystem in place with the options it was originally created with.
+func (m Manager) Reset(ctx *context.Context, name string) (err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/Reset")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// get metadata
+	var volume Volume
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.Get(ctx.Derived(), name)
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume metadata")
+			return
+		}
+		err = checkRestored(volume)
+		if err != nil {
+			return
+		}
+		err = m.checkNotDeleting(volume)
+		if err != nil {
+			return
+		}
+	}
+
+	// is it protected?
+	{
+		ctx.
+			Level(context.Trace).
+			Field("protected", volume.Metadata.Protected).
+			Message("checking if volume is protected")
+
+		if volume.Metadata.Protected {
+			err = errors.Wrapf(ErrProtected, "cannot reset volume '%s' until it is unprotected", name)
+			return
+		}
+	}
+
+	// is it still mounted?
+	{
+		ctx.
+			Level(context.Trace).
+			Message("checking if volume is still mounted")
+
+		var isMounted bool
+		isMounted, err = volume.IsMounted(ctx.Derived())
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume mount status")
+			return
+		}
+		if isMounted {
+			err = errors.Wrapf(ErrInUse, "cannot reset volume '%s'", name)
+			return
+		}
+	}
+
+	// resolve fs
+	var fs string
+	{
+		ctx.
+			Level(context.Trace).
+			Message("resolving volume fs")
+		fs, err = volume.Fs(ctx.Derived())
+		if err != nil {
+			err = errors.Wrap(err, "cannot resolve volume fs")
+			return
+		}
+	}
+
+	// reclaim space
+	if volume.Metadata.Sparse {
+		ctx.
+			Level(context.Trace).
+			Field("data-file", volume.DataFilePath).
+			Message("punching holes over entire data-file to reclaim disk space")
+
+		err = punchHoles(ctx.Derived(), volume.DataFilePath, 0, int64(volume.MaxSizeInBytes))
+		if err != nil {
+			err = errors.Wrap(err, "cannot reclaim disk space")
+			return
+		}
+	}
+
+	// format data file
+	{
+		ctx.
+			Level(context.Trace).
+			Field("fs", fs).
+			Field("data-file", volume.DataFilePath).
+			Message("re-creating fs within data-file")
+
+		err = formatDataFile(ctx.Derived(), volume.DataFilePath, fs, int64(volume.MaxSizeInBytes), volume.Metadata.Reserve)
+		if err != nil {
+			return
+		}
+	}
+
+	// restore ownership and mode
+	{
+		ctx.
+			Level(context.Trace).
+			Message("restoring volume's root ownership and mode")
+
+		err = m.adjustRoot(ctx.Derived(), name, volume.Metadata.Uid, volume.Metadata.Gid, volume.Metadata.Mode)
+	}
+
+	return
+}
+
+func punchHoles(ctx *context.Context, path string, offset, length int64) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/punchHoles")
+
+	ctx.
+		Level(context.Debug).
+		Field(":param/path", path).
+		Field(":param/offset", offset).
+		Field(":param/length", length).
+		Message("invoked")
+
+	defer func() {
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field(":return/err", err).
+				Message("failed with an error")
+			return
+		} else {
+			ctx.
+				Level(context.Debug).
+				Message("finished")
+		}
+	}()
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot open '%s'", path)
+		return
+	}
+	defer file.Close()
+
+	err = syscall.Fallocate(int(file.Fd()), fallocPunchHole|fallocKeepSize, offset, length)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot punch holes in '%s'", path)
+	}
+
+	return
+}
@@ -0,0 +1,216 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// Resize grows volume's data file and the filesystem within it, volume may stay in use while it's being resized.
+func (m Manager) Resize(ctx *context.Context, name string, sizeInBytes int64) (err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/Resize")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/sizeInBytes", sizeInBytes).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// get metadata
+	var volume Volume
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.Get(ctx.Derived(), name)
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume metadata")
+			return
+		}
+		err = checkRestored(volume)
+		if err != nil {
+			return
+		}
+		err = m.checkNotDeleting(volume)
+		if err != nil {
+			return
+		}
+	}
+
+	// validate size
+	currentSize := int64(volume.MaxSizeInBytes)
+	{
+		ctx.
+			Level(context.Trace).
+			Field("current-size", currentSize).
+			Message("validating new size")
+		if sizeInBytes <= currentSize {
+			err = errors.Wrapf(ErrInvalid,
+				"volume '%s' can only grow - new size %d must be greater than current size %d",
+				name, sizeInBytes, currentSize)
+			return
+		}
+	}
+
+	// check capacity
+	{
+		ctx.
+			Level(context.Trace).
+			Message("checking whether data dir can fit the volume after resize")
+		var pool Pool
+		pool, err = m.Pool(volume.Pool)
+		if err != nil {
+			return
+		}
+		err = m.admit(ctx.Derived(), pool, sizeInBytes-currentSize, volume.Metadata.Sparse)
+		if err != nil {
+			return
+		}
+	}
+
+	// resolve fs
+	var fs string
+	{
+		ctx.
+			Level(context.Trace).
+			Message("resolving volume fs")
+		fs, err = volume.Fs(ctx.Derived())
+		if err != nil {
+			err = errors.Wrap(err, "cannot resolve volume fs")
+			return
+		}
+	}
+
+	// grow data file
+	grown := false
+	{
+		ctx := ctx.
+			Field("data-file", volume.DataFilePath)
+
+		if volume.Metadata.Sparse {
+			ctx.
+				Level(context.Trace).
+				Message("extending sparse data-file")
+			err = os.Truncate(volume.DataFilePath, sizeInBytes)
+			if err != nil {
+				err = errors.Wrapf(err, "cannot extend data file '%s'", volume.DataFilePath)
+			}
+		} else {
+			ctx.
+				Level(context.Trace).
+				Message("allocating extended data-file")
+			err = allocateDataFile(ctx.Derived(), volume.DataFilePath, sizeInBytes)
+		}
+
+		defer func() {
+			if err != nil && !grown {
+				ctx.
+					Level(context.Trace).
+					Message("attempting to restore data-file size")
+				_ = os.Truncate(volume.DataFilePath, currentSize)
+			}
+		}()
+
+		if err != nil {
+			return
+		}
+	}
+
+	// mount volume to grow fs online
+	var mountPath string
+	{
+		lease := internalLease
+		ctx := ctx.Field("lease", lease)
+
+		ctx.
+			Level(context.Trace).
+			Message("mounting volume to grow its fs")
+		mountPath, err = m.Mount(ctx.Derived(), name, lease, nil)
+		if err != nil {
+			err = errors.Wrap(err, "cannot mount volume to grow its fs")
+			return
+		}
+
+		defer func() {
+			ctx.
+				Level(context.Trace).
+				Message("un-mounting volume to clean-up")
+
+			errUnMount := m.UnMount(ctx.Derived(), name, lease, nil)
+			if err == nil {
+				err = errUnMount
+			}
+		}()
+	}
+
+	// let loop device pick up the new size
+	var device string
+	{
+		ctx.
+			Level(context.Trace).
+			Message("looking up loop device")
+		device, err = volume.LoopDevice(ctx.Derived())
+		if err != nil {
+			return
+		}
+		if device == "" {
+			err = errors.Errorf("cannot find loop device for volume '%s' mounted at '%s'", name, mountPath)
+			return
+		}
+
+		ctx.
+			Level(context.Trace).
+			Field("device", device).
+			Message("refreshing loop device capacity")
+		var errStr string
+		errStr, err = runCommand(ctx.Derived(), "losetup", "-c", device)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot refresh capacity of loop device '%s': %s", device, errStr)
+			return
+		}
+	}
+
+	// grow fs
+	{
+		ctx.
+			Level(context.Trace).
+			Field("fs", fs).
+			Message("growing fs")
+
+		var errStr string
+		switch fs {
+		case "xfs":
+			errStr, err = runCommand(ctx.Derived(), "xfs_growfs", mountPath)
+		case "ext4":
+			errStr, err = runCommand(ctx.Derived(), "resize2fs", device)
+		default:
+			err = errors.Errorf("growing '%s' fs is not supported", fs)
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "cannot grow '%s' fs of volume '%s': %s", fs, name, errStr)
+			return
+		}
+		grown = true
+	}
+
+	return
+}
@@ -0,0 +1,233 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot creates a new volume with a point-in-time copy of an existing one, volume in use is frozen while copied.
+func (m Manager) Snapshot(ctx *context.Context, name string, snapshotName string) (err error) {
+	// tracing
+	ctx = ctx.
+		Field(":func", "manager/Snapshot")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/snapshotName", snapshotName).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	// validation
+	{
+		ctx.
+			Level(context.Trace).
+			Field("snapshot-name", snapshotName).
+			Message("validating snapshot name")
+		err = validateName(ctx.Derived(), snapshotName)
+		if err != nil {
+			return
+		}
+	}
+
+	// get metadata
+	var volume Volume
+	{
+		ctx.
+			Level(context.Trace).
+			Message("retrieving metadata")
+		volume, err = m.Get(ctx.Derived(), name)
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume metadata")
+			return
+		}
+		err = checkRestored(volume)
+		if err != nil {
+			return
+		}
+		err = m.checkNotDeleting(volume)
+		if err != nil {
+			return
+		}
+	}
+
+	// is snapshot name free? snapshot is kept in the same pool as the volume so that it can be a reflink copy
+	dataDir := filepath.Dir(volume.DataFilePath)
+	snapshotDataFilePath := filepath.Join(dataDir, snapshotName)
+	{
+		ctx.
+			Level(context.Trace).
+			Field("data-file", snapshotDataFilePath).
+			Message("checking if snapshot name is free")
+
+		for _, path := range m.namePaths(snapshotName) {
+			_, err = os.Lstat(path)
+			if err == nil {
+				err = errors.Wrapf(ErrExists, "cannot snapshot volume '%s' as '%s' - '%s' already exists",
+					name, snapshotName, path)
+				return
+			}
+			if !os.IsNotExist(err) {
+				err = errors.Wrapf(err, "cannot access '%s'", path)
+				return
+			}
+			err = nil
+		}
+	}
+
+	// check capacity
+	{
+		ctx.
+			Level(context.Trace).
+			Message("checking whether data dir can fit the snapshot")
+		var pool Pool
+		pool, err = m.Pool(volume.Pool)
+		if err != nil {
+			return
+		}
+		err = m.admit(ctx.Derived(), pool, int64(volume.MaxSizeInBytes), volume.Metadata.Sparse)
+		if err != nil {
+			return
+		}
+	}
+
+	// freeze fs if it's in use so that the copy is consistent
+	{
+		var isMounted bool
+		isMounted, err = volume.IsMounted(ctx.Derived())
+		if err != nil {
+			err = errors.Wrap(err, "cannot get volume mount status")
+			return
+		}
+
+		if isMounted {
+			ctx := ctx.
+				Field("mount-point", volume.MountPointPath)
+
+			ctx.
+				Level(context.Trace).
+				Message("freezing fs")
+			var errStr string
+			errStr, err = runCommand(ctx.Derived(), "fsfreeze", "--freeze", volume.MountPointPath)
+			if err != nil {
+				err = errors.Wrapf(err, "cannot freeze fs of volume '%s': %s", name, errStr)
+				return
+			}
+
+			defer func() {
+				ctx.
+					Level(context.Trace).
+					Message("un-freezing fs")
+				errStr, errUnfreeze := runCommand(ctx.Derived(), "fsfreeze", "--unfreeze", volume.MountPointPath)
+				if errUnfreeze != nil {
+					ctx.
+						Level(context.Error).
+						Field("err", errUnfreeze).
+						Field("output", errStr).
+						Message("cannot un-freeze fs - volume stays read-only until un-frozen manually")
+					if err == nil {
+						err = errors.Wrapf(errUnfreeze, "cannot un-freeze fs of volume '%s': %s", name, errStr)
+					}
+				}
+			}()
+		}
+	}
+
+	// copy data file
+	tmpDataFilePath := filepath.Join(dataDir, tmpDirName, snapshotName)
+	{
+		ctx := ctx.
+			Field("data-file", volume.DataFilePath).
+			Field("tmp-data-file", tmpDataFilePath)
+
+		var tmpDirMode os.FileMode = 0755
+		err = os.MkdirAll(filepath.Dir(tmpDataFilePath), tmpDirMode)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot create dir '%s'", filepath.Dir(tmpDataFilePath))
+			return
+		}
+
+		sparse := "--sparse=never"
+		if volume.Metadata.Sparse {
+			sparse = "--sparse=always"
+		}
+
+		ctx.
+			Level(context.Trace).
+			Field("sparse", sparse).
+			Message("copying data-file")
+		var errStr string
+		errStr, err = runCommand(ctx.Derived(), "cp", "--reflink=auto", sparse, volume.DataFilePath, tmpDataFilePath)
+		if err != nil {
+			_ = os.Remove(tmpDataFilePath)
+			err = errors.Wrapf(err, "cannot copy data file '%s': %s", volume.DataFilePath, errStr)
+			return
+		}
+		defer func() {
+			if err != nil {
+				ctx.
+					Level(context.Trace).
+					Message("attempting to cleanup data-file copy")
+				_ = os.Remove(tmpDataFilePath)
+			}
+		}()
+	}
+
+	// write metadata
+	{
+		metadata := volume.Metadata
+		metadata.CreatedAt = time.Now()
+		metadata.UnmountedAt = nil
+		metadata.Protected = false
+
+		ctx.
+			Level(context.Trace).
+			Message("writing snapshot metadata-file")
+		err = writeMetadata(ctx.Derived(), metadataFilePath(dataDir, snapshotName), metadata)
+		if err != nil {
+			err = errors.Wrap(err, "cannot persist snapshot metadata")
+			return
+		}
+		defer func() {
+			if err != nil {
+				ctx.
+					Level(context.Trace).
+					Message("attempting to cleanup metadata-file")
+				_ = os.Remove(metadataFilePath(dataDir, snapshotName))
+			}
+		}()
+	}
+
+	// move data file into place
+	{
+		ctx.
+			Level(context.Trace).
+			Field("data-file", snapshotDataFilePath).
+			Message("moving data-file copy into place")
+		err = os.Rename(tmpDataFilePath, snapshotDataFilePath)
+		if err != nil {
+			err = errors.Wrapf(err, "cannot move data file '%s' into place", tmpDataFilePath)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/pkg/errors"
+)
+
+// DiskSpace reports total and available bytes of the filesystem that data dir of a pool resides on
+func (m Manager) DiskSpace(ctx *context.Context, poolName string) (total, available int64, err error) {
+	ctx = ctx.
+		Field(":func", "manager/DiskSpace")
+
+	ctx.
+		Level(context.Debug).
+		Field(":param/poolName", poolName).
+		Message("invoked")
+
+	defer func() {
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field(":return/err", err).
+				Message("failed with an error")
+			return
+		} else {
+			ctx.
+				Level(context.Debug).
+				Field(":return/total", total).
+				Field(":return/available", available).
+				Message("finished")
+		}
+	}()
+
+	pool, err := m.Pool(poolName)
+	if err != nil {
+		return
+	}
+
+	total, available, err = diskSpace(pool.DataDir)
+	return
+}
+
+// Remount switches a mounted volume between read-only and read-write modes without affecting its leases
+func (m Manager) Remount(ctx *context.Context, name string, readOnly bool) (err error) {
+	ctx = ctx.
+		Field(":func", "manager/Remount")
+	{
+		initial := ctx.Copy() // we need a copy to avoid late binding and "junk" in fields in defer
+
+		initial.
+			Level(context.Debug).
+			Field(":param/name", name).
+			Field(":param/readOnly", readOnly).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				initial.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				initial.
+					Level(context.Debug).
+					Message("finished")
+			}
+		}()
+	}
+
+	volume, err := m.Get(ctx.Derived(), name)
+	if err != nil {
+		return
+	}
+
+	mounted, err := volume.IsMounted(ctx.Derived())
+	if err != nil {
+		return
+	}
+	if !mounted {
+		err = errors.Errorf("volume '%s' is not mounted", name)
+		return
+	}
+
+	mode := "rw"
+	if readOnly {
+		mode = "ro"
+	}
+
+	ctx.
+		Level(context.Trace).
+		Field("mount-point", volume.MountPointPath).
+		Field("mode", mode).
+		Message("re-mounting data-file")
+	errStr, err := runCommand(ctx.Derived(), "mount", "-o", "remount,"+mode, volume.MountPointPath)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"cannot re-mount volume '%s' at '%s' as '%s': %s",
+			name, volume.MountPointPath, mode, errStr)
+	}
+
+	return
+}
@@ -1,10 +1,13 @@
 package manager
 
 import (
+	"bufio"
 	"github.com/ashald/docker-volume-loopback/context"
 	"github.com/pkg/errors"
+	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 )
 
 func validateName(ctx *context.Context, name string) (err error) {
@@ -31,12 +34,13 @@ func validateName(ctx *context.Context, name string) (err error) {
 	}()
 
 	if name == "" {
-		err = errors.New("invalid volume name: cannot be an empty string")
+		err = errors.Wrap(ErrInvalid, "invalid volume name: cannot be an empty string")
 		return
 	}
 
 	if !NameRegex.MatchString(name) {
-		err = errors.Errorf("invalid volume name - '%s' does not match allowed pattern '%s'", name, NamePattern)
+		err = errors.Wrapf(ErrInvalid,
+			"invalid volume name - '%s' does not match allowed pattern '%s'", name, NamePattern)
 		return
 	}
 
@@ -73,3 +77,44 @@ func runCommand(ctx *context.Context, name string, args ...string) (output strin
 
 	return
 }
+
+// diskSpace reports total and available (to unprivileged users) bytes of a filesystem that the path belongs to
+func diskSpace(path string) (total, available int64, err error) {
+	var stat syscall.Statfs_t
+	err = syscall.Statfs(path, &stat)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot stat filesystem of '%s'", path)
+		return
+	}
+
+	total = int64(stat.Blocks) * stat.Bsize
+	available = int64(stat.Bavail) * stat.Bsize
+	return
+}
+
+const mountsFilePath = "/proc/mounts"
+
+// readMounts returns devices mounted in current mount namespace keyed by their mount points
+func readMounts() (mounts map[string]string, err error) {
+	file, err := os.Open(mountsFilePath)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot read '%s'", mountsFilePath)
+		return
+	}
+	defer file.Close()
+
+	mounts = make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 {
+			mounts[fields[1]] = fields[0]
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		err = errors.Wrapf(err, "cannot read '%s'", mountsFilePath)
+	}
+
+	return
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -15,11 +16,44 @@ type Volume struct {
 	MaxSizeInBytes       uint64
 	StateDir             string
 	DataFilePath         string
+	MetadataFilePath     string
+	ArchiveFilePath      string // empty unless volume is archived
+	Pool                 string
 	MountPointPath       string
 	CreatedAt            time.Time
+	Metadata             Metadata
 	fs                   string
 }
 
+// Usage describes space and inodes consumption of a filesystem inside a mounted volume
+type Usage struct {
+	BytesUsed   uint64
+	BytesFree   uint64
+	InodesUsed  uint64
+	InodesFree  uint64
+	PercentUsed float64
+}
+
+// IdleSince reports either creation or last un-mount of a volume, whichever is later
+func (v Volume) IdleSince() time.Time {
+	since := v.CreatedAt
+	if v.Metadata.UnmountedAt != nil && v.Metadata.UnmountedAt.After(since) {
+		since = *v.Metadata.UnmountedAt
+	}
+	return since
+}
+
+// ExpiresAt reports when volume's TTL runs out - TTL is counted from the moment volume became idle
+func (v Volume) ExpiresAt() (expiresAt time.Time, expires bool) {
+	if v.Metadata.TTL <= 0 {
+		return
+	}
+
+	expiresAt = v.IdleSince().Add(v.Metadata.TTL)
+	expires = true
+	return
+}
+
 func (v Volume) IsMounted(ctx *context.Context) (mounted bool, err error) {
 	{
 		ctx = ctx.
@@ -97,3 +131,129 @@ func (v Volume) Fs(ctx *context.Context) (fs string, err error) {
 	fs = v.fs
 	return
 }
+
+// Leases returns IDs of leases currently held on the volume
+func (v Volume) Leases(ctx *context.Context) (leases []string, err error) {
+	{
+		ctx = ctx.
+			Field(":func", "Volume/Leases")
+
+		ctx.
+			Level(context.Debug).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				ctx.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				ctx.
+					Level(context.Debug).
+					Field(":return/leases", leases).
+					Message("finished")
+			}
+		}()
+	}
+
+	files, err := ioutil.ReadDir(v.StateDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+		err = errors.Wrapf(err, "cannot read volume state dir '%s'", v.StateDir)
+		return
+	}
+
+	for _, file := range files {
+		leases = append(leases, file.Name())
+	}
+	return
+}
+
+// Usage reports consumption of the filesystem inside the volume, the volume has to be mounted
+func (v Volume) Usage(ctx *context.Context) (usage Usage, err error) {
+	{
+		ctx = ctx.
+			Field(":func", "Volume/Usage")
+
+		ctx.
+			Level(context.Debug).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				ctx.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				ctx.
+					Level(context.Debug).
+					Field(":return/usage", usage).
+					Message("finished")
+			}
+		}()
+	}
+
+	var stat syscall.Statfs_t
+	err = syscall.Statfs(v.MountPointPath, &stat)
+	if err != nil {
+		err = errors.Wrapf(err, "cannot stat filesystem mounted at '%s'", v.MountPointPath)
+		return
+	}
+
+	blockSize := uint64(stat.Bsize)
+	usage = Usage{
+		BytesUsed:  (stat.Blocks - stat.Bfree) * blockSize,
+		BytesFree:  stat.Bavail * blockSize,
+		InodesUsed: stat.Files - stat.Ffree,
+		InodesFree: stat.Ffree,
+	}
+
+	// same as df(1) - space reserved for root is not considered to be available
+	if usable := usage.BytesUsed + usage.BytesFree; usable > 0 {
+		usage.PercentUsed = float64(usage.BytesUsed) * 100 / float64(usable)
+	}
+
+	return
+}
+
+// LoopDevice looks up the loop device that backs volume's internal mount-point, empty if it's not mounted
+func (v Volume) LoopDevice(ctx *context.Context) (device string, err error) {
+	{
+		ctx = ctx.
+			Field(":func", "Volume/LoopDevice")
+
+		ctx.
+			Level(context.Debug).
+			Message("invoked")
+
+		defer func() {
+			if err != nil {
+				ctx.
+					Level(context.Error).
+					Field(":return/err", err).
+					Message("failed with an error")
+				return
+			} else {
+				ctx.
+					Level(context.Debug).
+					Field(":return/device", device).
+					Message("finished")
+			}
+		}()
+	}
+
+	mounts, err := readMounts()
+	if err != nil {
+		return
+	}
+	device = mounts[v.MountPointPath]
+
+	return
+}
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Prefix shared by names of all metrics exposed by the plugin
+const Namespace = "docker_volume_loopback"
+
+// Metric types as understood by Prometheus
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+// Upper bounds (in seconds) of operation latency histogram buckets
+var LatencyBuckets = []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+type Labels map[string]string
+
+type Sample struct {
+	Suffix string // appended to family name, e.g. '_bucket' for histograms
+	Labels Labels
+	Value  float64
+}
+
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector returns current values of metrics, it's called upon every scrape
+type Collector func() []Family
+
+// Operations records latency and errors of operations reported via context.Observer
+type Operations struct {
+	sync.Mutex
+	operations map[string]*operation
+}
+
+type operation struct {
+	count   uint64
+	errors  uint64
+	sum     float64
+	buckets []uint64
+}
+
+func NewOperations() *Operations {
+	return &Operations{operations: make(map[string]*operation)}
+}
+
+// Observe matches context.Observer signature
+func (o *Operations) Observe(name string, elapsed time.Duration, err error) {
+	o.Lock()
+	defer o.Unlock()
+
+	op, ok := o.operations[name]
+	if !ok {
+		op = &operation{buckets: make([]uint64, len(LatencyBuckets))}
+		o.operations[name] = op
+	}
+
+	seconds := elapsed.Seconds()
+	op.count++
+	op.sum += seconds
+	for idx, bound := range LatencyBuckets {
+		if seconds <= bound {
+			op.buckets[idx]++
+		}
+	}
+	if err != nil {
+		op.errors++
+	}
+}
+
+// Collect matches Collector signature
+func (o *Operations) Collect() []Family {
+	o.Lock()
+	defer o.Unlock()
+
+	latency := Family{
+		Name: Namespace + "_operation_duration_seconds",
+		Help: "Latency of driver operations.",
+		Type: Histogram,
+	}
+	failures := Family{
+		Name: Namespace + "_operation_errors_total",
+		Help: "Number of driver operations that failed with an error.",
+		Type: Counter,
+	}
+
+	names := make([]string, 0, len(o.operations))
+	for name := range o.operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		op := o.operations[name]
+		for idx, bound := range LatencyBuckets {
+			latency.Samples = append(latency.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: Labels{"operation": name, "le": formatValue(bound)},
+				Value:  float64(op.buckets[idx]),
+			})
+		}
+		latency.Samples = append(latency.Samples,
+			Sample{Suffix: "_bucket", Labels: Labels{"operation": name, "le": "+Inf"}, Value: float64(op.count)},
+			Sample{Suffix: "_sum", Labels: Labels{"operation": name}, Value: op.sum},
+			Sample{Suffix: "_count", Labels: Labels{"operation": name}, Value: float64(op.count)},
+		)
+		failures.Samples = append(failures.Samples, Sample{
+			Labels: Labels{"operation": name},
+			Value:  float64(op.errors),
+		})
+	}
+
+	return []Family{latency, failures}
+}
+
+// Write renders metrics in Prometheus text exposition format
+func Write(w io.Writer, families []Family) (err error) {
+	for _, family := range families {
+		_, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family.Name, family.Help, family.Name, family.Type)
+		if err != nil {
+			return
+		}
+		for _, sample := range family.Samples {
+			_, err = fmt.Fprintf(w, "%s%s%s %s\n",
+				family.Name, sample.Suffix, formatLabels(sample.Labels), formatValue(sample.Value))
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Handler serves metrics returned by collectors
+func Handler(collectors ...Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var families []Family
+		for _, collect := range collectors {
+			families = append(families, collect()...)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = Write(w, families)
+	})
+}
+
+// Listen opens a listener for metrics endpoint - absolute paths are treated as unix sockets and anything else as
+// TCP addresses, e.g. ':9100'
+func Listen(address string) (listener net.Listener, err error) {
+	if strings.HasPrefix(address, "/") {
+		err = os.Remove(address)
+		if err != nil && !os.IsNotExist(err) {
+			err = errors.Wrapf(err, "cannot remove stale socket '%s'", address)
+			return
+		}
+		listener, err = net.Listen("unix", address)
+	} else {
+		listener, err = net.Listen("tcp", address)
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "cannot listen on '%s'", address)
+	}
+	return
+}
+
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for idx, name := range names {
+		pairs[idx] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, +1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
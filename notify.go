@@ -0,0 +1,69 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/ashald/docker-volume-loopback/driver"
+	"github.com/ashald/docker-volume-loopback/systemd"
+)
+
+// How often to update status reported to systemd when its watchdog is not enabled
+const statusInterval = 30 * time.Second
+
+// notifySystemd tells systemd that the plugin is ready, then keeps its status up to date and pings its watchdog for as
+// long as the driver passes health checks so that systemd restarts the plugin once it's stuck
+func notifySystemd(ctx *context.Context, d *driver.Driver) {
+	ctx = ctx.
+		Field(":func", "main/notifySystemd")
+
+	notify := func(state string) {
+		err := systemd.Notify(state)
+		if err != nil {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Message("cannot notify systemd")
+		}
+	}
+
+	watchdog, err := systemd.WatchdogInterval()
+	if err != nil {
+		ctx.
+			Level(context.Warning).
+			Field("err", err).
+			Message("ignoring systemd watchdog")
+	}
+
+	// systemd advises to ping watchdog twice as often as it expects
+	interval := statusInterval
+	if watchdog > 0 {
+		interval = watchdog / 2
+	}
+
+	ctx.
+		Level(context.Info).
+		Field("watchdog", watchdog.String()).
+		Message("notifying systemd that plugin is ready")
+	notify("READY=1")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		summary, err := d.Health(interval / 2)
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", err).
+				Message("health check failed - not pinging systemd watchdog")
+			notify("STATUS=Unhealthy: " + err.Error())
+			continue
+		}
+
+		state := "STATUS=Serving " + summary
+		if watchdog > 0 {
+			state += "\nWATCHDOG=1"
+		}
+		notify(state)
+	}
+}
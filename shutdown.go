@@ -0,0 +1,82 @@
+package main
+
+import (
+	gocontext "context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ashald/docker-volume-loopback/context"
+	"github.com/ashald/docker-volume-loopback/driver"
+	"github.com/ashald/docker-volume-loopback/systemd"
+)
+
+// awaitShutdown blocks until a signal is received, then stops accepting requests, waits for requests and operations
+// in progress until the deadline and removes sockets opened by the plugin. It returns the exit code for the process.
+func awaitShutdown(ctx *context.Context, signals <-chan os.Signal, d *driver.Driver, servers []*http.Server,
+	sockets []string) int {
+	sig := <-signals
+
+	ctx = ctx.
+		Field(":func", "main/awaitShutdown").
+		Field("signal", sig.String()).
+		Field("timeout", args.ShutdownTimeout.String())
+
+	ctx.
+		Level(context.Info).
+		Message("shutting down")
+	if systemd.Notifying() {
+		_ = systemd.Notify("STOPPING=1")
+	}
+
+	deadline := time.Now().Add(args.ShutdownTimeout)
+	code := 0
+
+	ctx.
+		Level(context.Debug).
+		Message("waiting for requests in progress")
+	stdCtx, cancel := gocontext.WithDeadline(gocontext.Background(), deadline)
+	defer cancel()
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			errs <- server.Shutdown(stdCtx)
+		}(server)
+	}
+	for range servers {
+		err := <-errs
+		if err != nil {
+			ctx.
+				Level(context.Error).
+				Field("err", err).
+				Message("requests are still in progress - interrupting them")
+			code = 1
+		}
+	}
+
+	err := d.Shutdown(time.Until(deadline), args.UnmountOnShutdown)
+	if err != nil {
+		ctx.
+			Level(context.Error).
+			Field("err", err).
+			Message("failed to shut down driver")
+		code = 1
+	}
+
+	for _, socket := range sockets {
+		err := os.Remove(socket)
+		if err != nil && !os.IsNotExist(err) {
+			ctx.
+				Level(context.Warning).
+				Field("err", err).
+				Field("socket", socket).
+				Message("cannot remove socket")
+		}
+	}
+
+	ctx.
+		Level(context.Info).
+		Field("exit-code", code).
+		Message("shut down")
+	return code
+}
@@ -0,0 +1,73 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/coreos/go-systemd/activation"
+	"github.com/pkg/errors"
+)
+
+// Listeners returns sockets passed by systemd socket activation keyed by their addresses, i.e. paths of UNIX sockets.
+// There are none unless the process is started by a socket unit.
+func Listeners() (listeners map[string]net.Listener, err error) {
+	activated, err := activation.Listeners()
+	if err != nil {
+		err = errors.Wrap(err, "cannot use sockets passed by systemd")
+		return
+	}
+	listeners = make(map[string]net.Listener, len(activated))
+	for _, listener := range activated {
+		if listener != nil {
+			listeners[listener.Addr().String()] = listener
+		}
+	}
+	return
+}
+
+// Notify sends a state such as 'READY=1' or 'STATUS=...' to systemd, it does nothing unless systemd expects
+// notifications from the process, i.e. unless it runs as a service with 'Type=notify'
+func Notify(state string) (err error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return errors.Wrapf(err, "cannot connect to systemd notification socket '%s'", socket)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return errors.Wrapf(err, "cannot notify systemd about '%s'", state)
+	}
+	return
+}
+
+// Notifying tells whether systemd expects notifications from the process
+func Notifying() bool {
+	return os.Getenv("NOTIFY_SOCKET") != ""
+}
+
+// WatchdogInterval returns how often systemd expects 'WATCHDOG=1' from the process, 0 if watchdog is not enabled
+func WatchdogInterval() (interval time.Duration, err error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	value, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || value <= 0 {
+		err = errors.Errorf("WATCHDOG_USEC value '%s' is not a positive integer", usec)
+		return
+	}
+	interval = time.Duration(value) * time.Microsecond
+	return
+}
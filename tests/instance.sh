@@ -0,0 +1,83 @@
+#!/usr/bin/env bash
+
+# Runs a dedicated plugin instance next to the one under test so that features that have to be configured in a config
+# file can be tested without reconfiguring it. Instance is run on the host with its own dirs and serves a driver named
+# after ${INSTANCE} - Docker picks its socket up from /run/docker/plugins/ as for any plugin run manually.
+
+INSTANCE=${INSTANCE:-"loop-test"}
+INSTANCE_SOCKET="/run/docker/plugins/${INSTANCE}.sock"
+INSTANCE_ADMIN_SOCKET="/run/docker/plugins/${INSTANCE}-admin.sock"
+BINARY=${BINARY:-"$(command -v docker-volume-loopback || echo "/proc/$(pidof docker-volume-loopback)/exe")"}
+INSTANCE_DATA_SIZE=${INSTANCE_DATA_SIZE:-""} # size of a tmpfs to hold instance's data dir, empty for a plain dir
+INSTANCE_LAUNCHER=${INSTANCE_LAUNCHER:-""}   # command to run the instance with, e.g. systemd-socket-activate
+
+# startInstance takes config file contents on stdin, ${INSTANCE_DIR} within them is substituted with a dir that holds
+# instance's data, state and mount dirs - any extra arguments are passed to the instance
+startInstance() {
+    INSTANCE_DIR=$(mktemp -d)
+    mkdir -p "${INSTANCE_DIR}/data" "${INSTANCE_DIR}/state" "${INSTANCE_DIR}/mnt"
+    if [ -n "${INSTANCE_DATA_SIZE}" ]; then
+        mount -t tmpfs -o size="${INSTANCE_DATA_SIZE}" tmpfs "${INSTANCE_DIR}/data" || return 1
+    fi
+    cp "${BINARY}" "${INSTANCE_DIR}/docker-volume-loopback"
+    sed "s|\${INSTANCE_DIR}|${INSTANCE_DIR}|g" > "${INSTANCE_DIR}/config.yaml"
+    launchInstance "${@}"
+}
+
+# restartInstance stops the instance with SIGTERM and starts it again over the same dirs and config, its exit code is
+# kept in ${INSTANCE_EXIT_CODE} - any extra arguments are passed to the new instance
+restartInstance() {
+    kill -TERM "${INSTANCE_PID}"
+    wait "${INSTANCE_PID}"
+    INSTANCE_EXIT_CODE=$?
+    launchInstance "${@}"
+}
+
+launchInstance() {
+    ${INSTANCE_LAUNCHER} "${INSTANCE_DIR}/docker-volume-loopback" \
+        --config "${INSTANCE_DIR}/config.yaml" \
+        --socket "${INSTANCE_SOCKET}" \
+        --data-dir "${INSTANCE_DIR}/data" \
+        --state-dir "${INSTANCE_DIR}/state" \
+        --mount-dir "${INSTANCE_DIR}/mnt" \
+        --log-level 3 --log-format json \
+        "${@}" >> "${INSTANCE_DIR}/log" 2>&1 &
+    INSTANCE_PID=$!
+
+    for _ in $(seq 50); do
+        test -S "${INSTANCE_SOCKET}" && return 0
+        kill -0 "${INSTANCE_PID}" 2> /dev/null || break
+        sleep 0.2
+    done
+    echo "Plugin instance '${INSTANCE}' failed to start:"
+    cat "${INSTANCE_DIR}/log"
+    return 1
+}
+
+stopInstance() {
+    local volume
+    for volume in $(docker volume ls -q -f driver="${INSTANCE}" 2> /dev/null); do
+        docker volume rm -f "${volume}" &> /dev/null
+    done
+    kill -TERM "${INSTANCE_PID}" 2> /dev/null
+    wait "${INSTANCE_PID}" 2> /dev/null
+    for mount_point in "${INSTANCE_DIR}"/mnt/*; do
+        umount -ld "${mount_point}" &> /dev/null
+    done
+    umount -l "${INSTANCE_DIR}/data" &> /dev/null
+    rm -rf "${INSTANCE_DIR}"
+}
+
+# plugin calls volume plugin protocol of the instance directly, e.g. 'plugin Create {"Name": "foo"}'
+plugin() {
+    curl -s --unix-socket "${INSTANCE_SOCKET}" -X POST "http://plugin/VolumeDriver.${1}" -d "${2:-{\}}"
+}
+
+# admin calls admin API of the instance, e.g. 'admin POST /v1/volumes/foo/resize -d ...'
+admin() {
+    local method path
+    method="${1}"
+    path="${2}"
+    shift 2
+    curl -s --unix-socket "${INSTANCE_ADMIN_SOCKET}" -X "${method}" "http://admin${path}" "${@}"
+}
@@ -7,12 +7,33 @@ DRIVER="docker-volume-loopback"
 eval $(cat /proc/$(pidof docker-volume-loopback)/environ 2>/dev/null | tr '\0' '\n' | grep DATA_DIR)
 DATA_DIR=${DATA_DIR:-"/var/lib/${DRIVER}"} # a default fall-back
 
+ADMIN_SOCKET=${ADMIN_SOCKET:-"/run/docker/plugins/${DRIVER}-admin.sock"}
+
 run() {
     nsenter -t $(pidof "${DRIVER}") -a "${@}"
 }
 
+# api calls admin API of the plugin for a volume path, e.g. 'api POST /foo/resize -d ...'
+api() {
+    local method path
+    method="${1}"
+    path="${2}"
+    shift 2
+    curl -s --unix-socket "${ADMIN_SOCKET}" -X "${method}" "http://admin/v1/volumes${path}" "${@}"
+}
+
 oneTimeSetUp() {
     docker volume rm $(docker volume create -d "${DRIVER}" -o size=100MiB) &> /dev/null
+    # suites can define their own one-time setup, e.g. to start a plugin instance - see instance.sh
+    if type suiteSetUp &> /dev/null; then
+        suiteSetUp || exit 1
+    fi
+}
+
+oneTimeTearDown() {
+    if type suiteTearDown &> /dev/null; then
+        suiteTearDown
+    fi
 }
 
 setUp() {
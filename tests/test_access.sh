@@ -0,0 +1,116 @@
+#!/usr/bin/env bash
+
+. instance.sh
+ACCESS_GID=4242
+ACCESS_UID=4243
+
+# adminAs calls admin API of the instance as a given uid and gid with a given curl binary
+adminAs() {
+    local uid gid curl path
+    uid="${1}"
+    gid="${2}"
+    curl="${3}"
+    path="${4}"
+    setpriv --reuid "${uid}" --regid "${gid}" --clear-groups \
+        "${curl}" -s --unix-socket "${INSTANCE_ADMIN_SOCKET}" "http://admin${path}"
+}
+
+suiteSetUp() {
+    startInstance --admin-socket-group "${ACCESS_GID}" --admin-socket-mode 0660 <<YAML
+access:
+  admin:
+    - allow-all: true
+      paths: ["/v1/volumes"]
+    - gids: [${ACCESS_GID}]
+      executables: [$(readlink -f "$(command -v curl)")]
+      paths: ["/v1/volumes/*"]
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+testAdminSocketPermissions() {
+    local permissions
+    # setup
+    permissions=$(stat -c '%a %g' "${INSTANCE_ADMIN_SOCKET}")
+
+    # checks
+    assertEquals "Admin socket mode and group check" "660 ${ACCESS_GID}" "${permissions}"
+}
+
+testAccessAllowAll() {
+    local volumes
+    # setup
+    volumes=$(adminAs "${ACCESS_UID}" "${ACCESS_GID}" curl /v1/volumes | jq -r '.volumes | length')
+
+    # checks
+    assertEquals "Any caller should be allowed to list volumes" "0" "${volumes}"
+}
+
+testAccessAllowedByGidAndExecutable() {
+    local volume name
+    # setup
+    volume=$(docker volume create -d "${INSTANCE}")
+    name=$(adminAs "${ACCESS_UID}" "${ACCESS_GID}" curl "/v1/volumes/${volume}" | jq -r '.volume.name')
+
+    # checks
+    assertEquals "Caller with listed gid and executable should be allowed" "${volume}" "${name}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testAccessDeniedByGid() {
+    local volume code
+    # setup
+    volume=$(docker volume create -d "${INSTANCE}")
+    code=$(adminAs "${ACCESS_UID}" "${ACCESS_UID}" curl "/v1/volumes/${volume}" | jq -r '.error.code')
+
+    # checks
+    assertEquals "Caller with gid that is not listed should be denied" "forbidden" "${code}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testAccessDeniedByExecutable() {
+    local volume copy code
+    # setup
+    volume=$(docker volume create -d "${INSTANCE}")
+    copy=$(mktemp)
+    cp "$(command -v curl)" "${copy}"
+    chmod 755 "${copy}"
+    code=$(adminAs "${ACCESS_UID}" "${ACCESS_GID}" "${copy}" "/v1/volumes/${volume}" | jq -r '.error.code')
+
+    # checks
+    assertEquals "Caller with executable that is not listed should be denied" "forbidden" "${code}"
+
+    # cleanup
+    rm -f "${copy}"
+    docker volume rm "${volume}" > /dev/null
+}
+
+testAccessRuleWithoutCallersIsRejected() {
+    local instance_dir
+    # setup
+    instance_dir=$(mktemp -d)
+    echo '{"access": {"admin": [{"executables": ["/usr/bin/curl"], "paths": ["/v1/volumes"]}]}}' \
+        > "${instance_dir}/config.yaml"
+    "${INSTANCE_DIR}/docker-volume-loopback" \
+        --config "${instance_dir}/config.yaml" \
+        --socket "${instance_dir}/plugin.sock" \
+        --data-dir "${instance_dir}" --state-dir "${instance_dir}" --mount-dir "${instance_dir}" \
+        &> "${instance_dir}/log"
+
+    # checks
+    assertNotEquals "Rule without uids, gids or allow-all should fail start" "0" "$?"
+    assertContains "Rule without uids, gids or allow-all should be reported" \
+        "$(cat "${instance_dir}/log")" "has to list uids or gids"
+
+    # cleanup
+    rm -rf "${instance_dir}"
+}
+
+. test.sh
@@ -0,0 +1,76 @@
+#!/usr/bin/env bash
+
+testAdminResize() {
+    local volume response size
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    response=$(api POST "/${volume}/resize" -d '{"size": "200MiB"}')
+    size=$(echo "${response}" | jq -r '.volume.status["size-max"]')
+
+    # checks
+    assertEquals "Reported max size check" "209715200" "${size}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testAdminSnapshot() {
+    local volume snapshot content
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    docker run --rm -v "${volume}:/srv" "${IMAGE}" sh -c 'echo hello > /srv/file'
+    api POST "/${volume}/snapshot" -d "{\"name\": \"${volume}-snapshot\"}" > /dev/null
+    snapshot="${volume}-snapshot"
+    content=$(docker run --rm -v "${snapshot}:/srv" "${IMAGE}" cat /srv/file)
+
+    # checks
+    assertEquals "Snapshot content check" "hello" "${content}"
+
+    # cleanup
+    docker volume rm "${volume}" "${snapshot}" > /dev/null
+}
+
+testAdminExport() {
+    local volume files
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    docker run --rm -v "${volume}:/srv" "${IMAGE}" sh -c 'echo hello > /srv/file'
+    files=$(api GET "/${volume}/export" | tar -t)
+
+    # checks
+    assertContains "Exported archive check" "${files}" "./file"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testAdminErrorCodes() {
+    local volume code
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB -o protected=true)
+
+    # checks
+    code=$(api GET "/does-not-exist" | jq -r '.error.code')
+    assertEquals "Missing volume code check" "not-found" "${code}"
+
+    code=$(api POST "/${volume}/reset" | jq -r '.error.code')
+    assertEquals "Protected volume code check" "protected" "${code}"
+
+    code=$(api POST "/${volume}/resize" -d '{"size": 1}' | jq -r '.error.code')
+    assertEquals "Malformed request code check" "bad-request" "${code}"
+
+    code=$(api POST "/${volume}/resize" -d '{"size": "not-a-size"}' | jq -r '.error.code')
+    assertEquals "Invalid size code check" "bad-request" "${code}"
+
+    code=$(api POST "/${volume}/move" -d '{"pool": "does-not-exist"}' | jq -r '.error.code')
+    assertEquals "Unknown pool code check" "bad-request" "${code}"
+
+    code=$(api POST "/${volume}/rename" -d '{"name": "-invalid-"}' | jq -r '.error.code')
+    assertEquals "Invalid name code check" "bad-request" "${code}"
+
+    # cleanup
+    api POST "/${volume}/protect" -d '{"protected": false}' > /dev/null
+    docker volume rm "${volume}" > /dev/null
+}
+
+. test.sh
@@ -0,0 +1,105 @@
+#!/usr/bin/env bash
+
+. instance.sh
+
+suiteSetUp() {
+    startInstance --janitor-interval 1s --archive-after 2s <<YAML
+{}
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# archived prints whether a volume of the instance is archived
+archived() {
+    admin GET "/v1/volumes/${1}" | jq -r '.volume.status.archived'
+}
+
+# waitArchived waits for the janitor to archive a volume of the instance
+waitArchived() {
+    for _ in $(seq 50); do
+        [ "$(archived "${1}")" == "true" ] && return 0
+        sleep 0.2
+    done
+    return 1
+}
+
+# createWithFile makes a volume of the instance that holds a file with given content
+createWithFile() {
+    local mount_point
+    docker volume create -d "${INSTANCE}" --name "${1}" -o size=20MiB -o fs=ext4 > /dev/null
+    mount_point=$(plugin Mount "{\"Name\": \"${1}\", \"ID\": \"setup\"}" | jq -r '.Mountpoint')
+    echo "${2}" > "${mount_point}/file"
+    plugin Unmount "{\"Name\": \"${1}\", \"ID\": \"setup\"}" > /dev/null
+}
+
+testIdleVolumeArchived() {
+    # setup
+    createWithFile idle hello
+
+    # checks
+    assertTrue "Idle volume should be archived" "waitArchived idle"
+    assertTrue "Archive should be created" "test -e ${INSTANCE_DIR}/data/.archive/idle.zst"
+    assertFalse "Data file should be removed" "test -e ${INSTANCE_DIR}/data/idle"
+    assertContains "Archived volume should be listed" "$(docker volume ls -q)" "idle"
+
+    # cleanup
+    docker volume rm idle > /dev/null
+}
+
+testArchivedVolumeRestoredOnMount() {
+    local mount_point content
+    # setup
+    createWithFile restored hello
+    waitArchived restored
+    mount_point=$(plugin Mount '{"Name": "restored", "ID": "lease"}' | jq -r '.Mountpoint')
+    content=$(cat "${mount_point}/file")
+
+    # checks
+    assertEquals "Data should survive archiving" "hello" "${content}"
+    assertEquals "Mounted volume should not be archived" "false" "$(archived restored)"
+    assertFalse "Archive should be removed" "test -e ${INSTANCE_DIR}/data/.archive/restored.zst"
+    sleep 3
+    assertEquals "Mounted volume should not be archived by janitor" "false" "$(archived restored)"
+
+    # cleanup
+    plugin Unmount '{"Name": "restored", "ID": "lease"}' > /dev/null
+    docker volume rm restored > /dev/null
+}
+
+testArchivedVolumeOperationsRejected() {
+    local resize snapshot
+    # setup
+    createWithFile frozen hello
+    waitArchived frozen
+    resize=$(admin POST /v1/volumes/frozen/resize -d '{"size": "30MiB"}' | jq -r '.error.message')
+    snapshot=$(admin POST /v1/volumes/frozen/snapshot -d '{"name": "frozen-copy"}' | jq -r '.error.message')
+
+    # checks
+    assertContains "Resize of archived volume should be rejected" "${resize}" "is archived"
+    assertContains "Snapshot of archived volume should be rejected" "${snapshot}" "is archived"
+    assertEquals "Volume should stay archived" "true" "$(archived frozen)"
+
+    # cleanup
+    docker volume rm frozen > /dev/null
+}
+
+testArchiveWithoutJanitorRejected() {
+    local dir output code
+    # setup
+    dir=$(mktemp -d)
+    output=$(timeout 10 "${INSTANCE_DIR}/docker-volume-loopback" --archive-after 1h --janitor-interval 0 \
+        --socket "${dir}/plugin.sock" --data-dir "${dir}" --state-dir "${dir}" --mount-dir "${dir}" 2>&1)
+    code=$?
+
+    # checks
+    assertNotEquals "Archiving without janitor should fail startup" "0" "${code}"
+    assertContains "Archiving without janitor should be reported" "${output}" "JanitorInterval must be positive"
+
+    # cleanup
+    rm -rf "${dir}"
+}
+
+. test.sh
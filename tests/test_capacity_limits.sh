@@ -0,0 +1,68 @@
+#!/usr/bin/env bash
+
+# data dir of the instance is a tmpfs of a known size
+INSTANCE_DATA_SIZE=200M
+. instance.sh
+
+suiteSetUp() {
+    startInstance --min-free-space 50MiB --max-oversubscription 2 <<YAML
+{}
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# create makes a volume of the instance with a given name and size, extra arguments are passed to docker
+create() {
+    local name size
+    name="${1}"
+    size="${2}"
+    shift 2
+    docker volume create -d "${INSTANCE}" --name "${name}" -o size="${size}" -o fs=ext4 "${@}" 2>&1
+}
+
+testRegularVolumeKeepsMinFreeSpace() {
+    local output created
+    # setup
+    output=$(create regular-big 160MiB -o sparse=false)
+    created=$(create regular-small 100MiB -o sparse=false)
+
+    # checks
+    assertContains "Regular volume eating into min free space should be rejected" "${output}" "must be kept free"
+    assertEquals "Regular volume that leaves min free space should be created" "regular-small" "${created}"
+
+    # cleanup
+    docker volume rm regular-small > /dev/null
+}
+
+testSparseVolumeOversubscription() {
+    local created output
+    # setup
+    created=$(create sparse-first 300MiB -o sparse=true)
+    output=$(create sparse-second 200MiB -o sparse=true)
+
+    # checks
+    assertEquals "Sparse volume within over-subscription limit should be created" "sparse-first" "${created}"
+    assertContains "Sparse volume over over-subscription limit should be rejected" "${output}" \
+        "may only be over-subscribed up to 419430400 bytes"
+
+    # cleanup
+    docker volume rm sparse-first > /dev/null
+}
+
+testResizeOverOversubscription() {
+    local code
+    # setup
+    create sparse-resized 300MiB -o sparse=true > /dev/null
+    code=$(admin POST /v1/volumes/sparse-resized/resize -d '{"size": "500MiB"}' | jq -r '.error.code')
+
+    # checks
+    assertEquals "Resize over over-subscription limit should be rejected" "insufficient-capacity" "${code}"
+
+    # cleanup
+    docker volume rm sparse-resized > /dev/null
+}
+
+. test.sh
@@ -0,0 +1,122 @@
+#!/usr/bin/env bash
+
+. instance.sh
+
+suiteSetUp() {
+    startInstance <<YAML
+default-size: 30MiB
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# reload replaces config file of the instance with contents of stdin, sends SIGHUP and waits for the given log message
+reload() {
+    local message count
+    message="${1}"
+    count=$(grep -c "\"msg\":\"${message}\"" "${INSTANCE_DIR}/log")
+    cat > "${INSTANCE_DIR}/config.yaml"
+    kill -HUP "${INSTANCE_PID}"
+    for _ in $(seq 50); do
+        [ "$(grep -c "\"msg\":\"${message}\"" "${INSTANCE_DIR}/log")" -gt "${count}" ] && return 0
+        sleep 0.2
+    done
+    return 1
+}
+
+# sizeOf creates a volume of the instance with given options and prints its size, the volume is removed afterwards
+sizeOf() {
+    local volume size
+    volume=$(docker volume create -d "${INSTANCE}" -o fs=ext4 "${@}")
+    size=$(docker volume inspect "${volume}" | jq -r '.[0].Status["size-max"]')
+    docker volume rm "${volume}" > /dev/null
+    echo "${size}"
+}
+
+testConfigFileApplied() {
+    # checks
+    assertEquals "Default size should come from config file" "31457280" "$(sizeOf)"
+}
+
+testReloadDefaultSize() {
+    # setup
+    reload "changed setting" <<YAML
+default-size: 40MiB
+YAML
+
+    # checks
+    assertEquals "Default size should be reloaded" "41943040" "$(sizeOf)"
+    assertContains "Changed setting should be logged" \
+        "$(grep '"msg":"changed setting"' "${INSTANCE_DIR}/log" | jq -r '.key')" "default-size"
+}
+
+testReloadProfiles() {
+    local code
+    # setup
+    reload "changed setting" <<YAML
+default-size: 30MiB
+profiles:
+  - name: small
+    defaults:
+      size: 20MiB
+YAML
+
+    # checks
+    assertEquals "Reloaded profile should apply" "20971520" "$(sizeOf -o profile=small)"
+    reload "changed setting" <<YAML
+default-size: 30MiB
+YAML
+    docker volume create -d "${INSTANCE}" --name unknown-profile -o profile=small &> /dev/null
+    code=$?
+    assertNotEquals "Removed profile should be rejected" "0" "${code}"
+}
+
+testReloadIgnoresNonReloadable() {
+    # setup
+    reload "setting cannot be changed without restart - ignoring it" <<YAML
+default-size: 30MiB
+secure-delete: zero
+YAML
+
+    # checks
+    assertContains "Non-reloadable setting should be reported" \
+        "$(grep '"msg":"setting cannot be changed without restart - ignoring it"' "${INSTANCE_DIR}/log" | jq -r '.key')" \
+        "secure-delete"
+    assertEquals "Reloadable settings should still apply" "31457280" "$(sizeOf)"
+}
+
+testReloadInvalidConfigRejected() {
+    # setup
+    reload "changed setting" <<YAML
+default-size: 50MiB
+YAML
+    reload "failed to reload config file - keeping current config" <<YAML
+default-size: 20MiB
+unknown-key: true
+YAML
+
+    # checks
+    assertEquals "Invalid config should not be applied" "52428800" "$(sizeOf)"
+    assertTrue "Instance should keep running" "kill -0 ${INSTANCE_PID}"
+}
+
+testStartupInvalidConfigRejected() {
+    local dir output code
+    # setup
+    dir=$(mktemp -d)
+    echo "unknown-key: true" > "${dir}/config.yaml"
+    output=$(timeout 10 "${INSTANCE_DIR}/docker-volume-loopback" --config "${dir}/config.yaml" \
+        --socket "${dir}/plugin.sock" --data-dir "${dir}" --state-dir "${dir}" --mount-dir "${dir}" 2>&1)
+    code=$?
+
+    # checks
+    assertNotEquals "Invalid config should fail startup" "0" "${code}"
+    assertContains "Invalid config should be reported" "${output}" "invalid config file"
+
+    # cleanup
+    rm -rf "${dir}"
+}
+
+. test.sh
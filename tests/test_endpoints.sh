@@ -0,0 +1,73 @@
+#!/usr/bin/env bash
+
+. instance.sh
+ENDPOINT="${INSTANCE}-ep"
+
+suiteSetUp() {
+    startInstance <<YAML
+endpoints:
+  - name: ${ENDPOINT}
+    default-size: 60MiB
+    fs: ext4
+YAML
+}
+
+suiteTearDown() {
+    for volume in $(docker volume ls -q -f driver="${ENDPOINT}"); do
+        docker volume rm -f "${volume}" &> /dev/null
+    done
+    stopInstance
+}
+
+testEndpointDefaults() {
+    local volume status size endpoint fs
+    # setup
+    volume=$(docker volume create -d "${ENDPOINT}")
+    status=$(docker volume inspect "${volume}" | jq '.[0].Status')
+    size=$(echo "${status}" | jq -r '.["size-max"]')
+    endpoint=$(echo "${status}" | jq -r '.endpoint')
+    fs=$(echo "${status}" | jq -r '.fs')
+
+    # checks
+    assertEquals "Endpoint default size check" "62914560" "${size}"
+    assertEquals "Endpoint fs check" "ext4" "${fs}"
+    assertEquals "Endpoint name check" "${ENDPOINT}" "${endpoint}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testEndpointVolumeHiddenFromPluginSocket() {
+    local volume error
+    # setup
+    volume=$(docker volume create -d "${ENDPOINT}")
+    error=$(plugin Get "{\"Name\": \"${volume}\"}" | jq -r '.Err')
+
+    # checks
+    assertContains "Endpoint volume should not be visible through plugin socket" "${error}" "does not exist"
+    assertNotContains "Endpoint volume should not be listed through plugin socket" \
+        "$(plugin List | jq -r '.Volumes[].Name')" "${volume}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testEndpointVolumeInAdminApi() {
+    local volume listed endpoint protected
+    # setup
+    volume=$(docker volume create -d "${ENDPOINT}")
+    listed=$(admin GET /v1/volumes | jq -r '.volumes[].name')
+    endpoint=$(admin GET "/v1/volumes/${volume}" | jq -r '.volume.status.endpoint')
+    protected=$(admin POST "/v1/volumes/${volume}/protect" -d '{"protected": true}' | jq -r '.volume.status.protected')
+
+    # checks
+    assertContains "Endpoint volume should be listed by admin API" "${listed}" "${volume}"
+    assertEquals "Endpoint volume should be inspected by admin API" "${ENDPOINT}" "${endpoint}"
+    assertEquals "Endpoint volume should be changed by admin API" "true" "${protected}"
+
+    # cleanup
+    admin POST "/v1/volumes/${volume}/protect" -d '{"protected": false}' > /dev/null
+    docker volume rm "${volume}" > /dev/null
+}
+
+. test.sh
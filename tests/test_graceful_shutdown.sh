@@ -0,0 +1,166 @@
+#!/usr/bin/env bash
+
+. instance.sh
+
+suiteSetUp() {
+    startInstance <<YAML
+{}
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# journal records an interrupted operation for a volume of the instance the same way the plugin does before it starts
+journal() {
+    local operation volume lease new_data_file
+    operation="${1}"
+    volume="${2}"
+    lease="${3:-}"
+    new_data_file="${4:-}"
+    mkdir -p "${INSTANCE_DIR}/state/.journal"
+    jq -n --arg operation "${operation}" --arg volume "${volume}" --arg lease "${lease}" \
+        --arg data_file "${INSTANCE_DIR}/data/${volume}" --arg new_data_file "${new_data_file}" \
+        '{"operation": $operation, "volume": $volume, "lease": $lease, "data-file": $data_file,
+          "new-data-file": $new_data_file, "trace": "test", "started-at": "2020-01-01T00:00:00Z"}' \
+        > "${INSTANCE_DIR}/state/.journal/${operation}-${volume}.json"
+}
+
+testShutdownRemovesSockets() {
+    local code
+    # setup
+    kill -TERM "${INSTANCE_PID}"
+    wait "${INSTANCE_PID}"
+    code=$?
+
+    # checks
+    assertEquals "Plugin should exit cleanly" "0" "${code}"
+    assertFalse "Plugin socket should be removed" "test -S ${INSTANCE_SOCKET}"
+    assertFalse "Admin socket should be removed" "test -S ${INSTANCE_ADMIN_SOCKET}"
+    assertContains "Shutdown should be logged" "$(cat "${INSTANCE_DIR}/log")" '"msg":"shut down"'
+
+    # cleanup
+    launchInstance
+}
+
+testInterruptedCreateRolledBack() {
+    # setup
+    docker volume create -d "${INSTANCE}" --name partial -o size=20MiB -o fs=ext4 > /dev/null
+    journal create partial
+    restartInstance
+
+    # checks
+    assertNotContains "Partially created volume should be removed" "$(docker volume ls -q)" "partial"
+    assertFalse "Data file should be removed" "test -e ${INSTANCE_DIR}/data/partial"
+    assertFalse "Journal file should be removed" "test -e ${INSTANCE_DIR}/state/.journal/create-partial.json"
+}
+
+testInterruptedMountRolledBack() {
+    # setup
+    docker volume create -d "${INSTANCE}" --name leased -o size=20MiB -o fs=ext4 > /dev/null
+    plugin Mount '{"Name": "leased", "ID": "dropped"}' > /dev/null
+    journal mount leased dropped
+    restartInstance
+
+    # checks
+    assertFalse "Lease Docker never got should be dropped" "test -e ${INSTANCE_DIR}/state/leased/dropped"
+    assertFalse "Volume without leases should be un-mounted" "mountpoint -q ${INSTANCE_DIR}/mnt/leased"
+    assertContains "Volume should be kept" "$(docker volume ls -q)" "leased"
+
+    # cleanup
+    docker volume rm leased > /dev/null
+}
+
+testInterruptedMountKeepsOtherLeases() {
+    # setup
+    docker volume create -d "${INSTANCE}" --name shared -o size=20MiB -o fs=ext4 > /dev/null
+    plugin Mount '{"Name": "shared", "ID": "kept"}' > /dev/null
+    plugin Mount '{"Name": "shared", "ID": "dropped"}' > /dev/null
+    journal mount shared dropped
+    restartInstance
+
+    # checks
+    assertFalse "Lease Docker never got should be dropped" "test -e ${INSTANCE_DIR}/state/shared/dropped"
+    assertTrue "Other leases should be kept" "test -e ${INSTANCE_DIR}/state/shared/kept"
+    assertTrue "Volume with leases should stay mounted" "mountpoint -q ${INSTANCE_DIR}/mnt/shared"
+
+    # cleanup
+    plugin Unmount '{"Name": "shared", "ID": "kept"}' > /dev/null
+    docker volume rm shared > /dev/null
+}
+
+testInterruptedRenameRolledBack() {
+    # setup
+    docker volume create -d "${INSTANCE}" --name original -o size=20MiB -o fs=ext4 > /dev/null
+    mv "${INSTANCE_DIR}/data/original" "${INSTANCE_DIR}/data/renamed" # killed before metadata file was renamed
+    journal rename original "" "${INSTANCE_DIR}/data/renamed"
+    restartInstance
+
+    # checks
+    assertTrue "Data file should be renamed back" "test -e ${INSTANCE_DIR}/data/original"
+    assertFalse "Renamed data file should be gone" "test -e ${INSTANCE_DIR}/data/renamed"
+    assertContains "Volume should keep its old name" "$(docker volume ls -q)" "original"
+    assertNotContains "Volume should not be listed under new name" "$(docker volume ls -q)" "renamed"
+    assertFalse "Journal file should be removed" "test -e ${INSTANCE_DIR}/state/.journal/rename-original.json"
+
+    # cleanup
+    docker volume rm original > /dev/null
+}
+
+testInterruptedConvertReconciled() {
+    local metadata_file tmp_file
+    # setup
+    docker volume create -d "${INSTANCE}" --name converted -o size=20MiB -o fs=ext4 > /dev/null
+    metadata_file="${INSTANCE_DIR}/data/.metadata/converted"
+    tmp_file="${INSTANCE_DIR}/data/.tmp/converted"
+    # killed after metadata was updated but before data files were swapped
+    jq '.fs = "xfs"' "${metadata_file}" > "${metadata_file}.new" && mv "${metadata_file}.new" "${metadata_file}"
+    mkdir -p "${tmp_file}.source"
+    truncate -s 20MiB "${tmp_file}"
+    journal convert converted "" "${tmp_file}"
+    restartInstance
+
+    # checks
+    assertEquals "Metadata should match fs of data file" "ext4" "$(jq -r '.fs' "${metadata_file}")"
+    assertFalse "New data file should be removed" "test -e ${tmp_file}"
+    assertFalse "Mount point should be removed" "test -e ${tmp_file}.source"
+    assertFalse "Journal file should be removed" "test -e ${INSTANCE_DIR}/state/.journal/convert-converted.json"
+
+    # cleanup
+    docker volume rm converted > /dev/null
+}
+
+testUnmountOnShutdown() {
+    # setup
+    docker volume create -d "${INSTANCE}" --name idle -o size=20MiB -o fs=ext4 > /dev/null
+    docker volume create -d "${INSTANCE}" --name busy -o size=20MiB -o fs=ext4 > /dev/null
+    plugin Mount '{"Name": "idle", "ID": "lost"}' > /dev/null
+    plugin Mount '{"Name": "busy", "ID": "lease"}' > /dev/null
+    rm "${INSTANCE_DIR}/state/idle/lost"
+    restartInstance --unmount-on-shutdown # the option applies to the shutdown that follows
+    restartInstance
+
+    # checks
+    assertFalse "Volume without leases should be un-mounted" "mountpoint -q ${INSTANCE_DIR}/mnt/idle"
+    assertTrue "Volume with leases should stay mounted" "mountpoint -q ${INSTANCE_DIR}/mnt/busy"
+
+    # cleanup
+    plugin Unmount '{"Name": "busy", "ID": "lease"}' > /dev/null
+    docker volume rm idle busy > /dev/null
+}
+
+testUnreadableJournalRemoved() {
+    # setup
+    mkdir -p "${INSTANCE_DIR}/state/.journal"
+    echo "not json" > "${INSTANCE_DIR}/state/.journal/create-broken.json"
+    restartInstance
+
+    # checks
+    assertEquals "Plugin should exit cleanly" "0" "${INSTANCE_EXIT_CODE}"
+    assertFalse "Unreadable journal file should be removed" "test -e ${INSTANCE_DIR}/state/.journal/create-broken.json"
+    assertContains "Unreadable journal file should be reported" "$(cat "${INSTANCE_DIR}/log")" \
+        '"msg":"cannot read journal file - removing it"'
+}
+
+. test.sh
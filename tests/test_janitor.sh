@@ -0,0 +1,49 @@
+#!/usr/bin/env bash
+
+. instance.sh
+
+suiteSetUp() {
+    startInstance --janitor-interval 1s <<YAML
+{}
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# create makes a volume of the instance with a given name, extra arguments are passed to docker
+create() {
+    local name
+    name="${1}"
+    shift
+    docker volume create -d "${INSTANCE}" --name "${name}" -o size=20MiB -o fs=ext4 "${@}" 2>&1
+}
+
+testExpiredVolumeRemoved() {
+    local error
+    # setup
+    create expiring -o ttl=1s > /dev/null
+    sleep 3
+    error=$(plugin Get '{"Name": "expiring"}' | jq -r '.Err')
+
+    # checks
+    assertContains "Expired volume should be removed" "${error}" "does not exist"
+}
+
+testExpiredProtectedVolumeSkipped() {
+    local name skipped
+    # setup
+    create expiring-protected -o ttl=1s -o protected=true > /dev/null
+    sleep 4
+    name=$(plugin Get '{"Name": "expiring-protected"}' | jq -r '.Volume.Name')
+    skipped=$(grep -c '"msg":"expired volume is protected - skipping it until it.s unprotected"' "${INSTANCE_DIR}/log")
+
+    # checks
+    assertEquals "Expired protected volume should be kept" "expiring-protected" "${name}"
+    assertEquals "Expired protected volume should be reported once" "1" "${skipped}"
+    assertNotContains "Expired protected volume should not fail deletion" "$(cat "${INSTANCE_DIR}/log")" \
+        "failed to delete expired volume"
+}
+
+. test.sh
@@ -0,0 +1,92 @@
+#!/usr/bin/env bash
+
+. instance.sh
+
+suiteSetUp() {
+    LOG_DIR=$(mktemp -d)
+}
+
+suiteTearDown() {
+    rm -rf "${LOG_DIR}"
+}
+
+# receive collects syslog datagrams sent to a unixgram socket into a file, one per line
+receive() {
+    python3 -c '
+import socket, sys
+receiver = socket.socket(socket.AF_UNIX, socket.SOCK_DGRAM)
+receiver.bind(sys.argv[1])
+with open(sys.argv[2], "a", buffering=1) as messages:
+    while True:
+        messages.write(receiver.recv(65536).decode() + "\n")
+' "${1}" "${2}" &
+    RECEIVER_PID=$!
+    for _ in $(seq 50); do
+        test -S "${1}" && return 0
+        sleep 0.2
+    done
+    return 1
+}
+
+# startupError runs the plugin with given arguments expecting it to fail on startup and prints what it reported
+startupError() {
+    timeout 10 "${BINARY}" --socket "${LOG_DIR}/plugin.sock" \
+        --data-dir "${LOG_DIR}" --state-dir "${LOG_DIR}" --mount-dir "${LOG_DIR}" "${@}" 2>&1 && echo "started"
+}
+
+testFileOutputRotated() {
+    local size
+    # setup
+    startInstance --log-output "${LOG_DIR}/plugin.log" --log-max-size 4KiB --log-max-files 2 <<YAML
+{}
+YAML
+    for _ in $(seq 5); do
+        plugin Get '{"Name": "does-not-exist"}' > /dev/null
+    done
+
+    # checks
+    assertTrue "Log file should be written" "grep -q '\"msg\":' ${LOG_DIR}/plugin.log"
+    assertTrue "Log file should be rotated" "test -e ${LOG_DIR}/plugin.log.1"
+    assertTrue "Rotated log files should be kept" "test -e ${LOG_DIR}/plugin.log.2"
+    assertFalse "Only LOG_MAX_FILES rotated log files should be kept" "test -e ${LOG_DIR}/plugin.log.3"
+    size=$(stat -c %s "${LOG_DIR}/plugin.log.1")
+    assertTrue "Rotated log file should not grow beyond LOG_MAX_SIZE" "[ ${size} -le 4096 ]"
+    assertEquals "Nothing should be logged to stdout" "" "$(cat "${INSTANCE_DIR}/log")"
+
+    # cleanup
+    stopInstance
+}
+
+testSyslogOutput() {
+    local messages
+    # setup
+    receive "${LOG_DIR}/syslog.sock" "${LOG_DIR}/messages"
+    startInstance --log-output "syslog:${LOG_DIR}/syslog.sock" <<YAML
+{}
+YAML
+    plugin List > /dev/null
+    sleep 0.5
+    messages=$(cat "${LOG_DIR}/messages")
+
+    # checks
+    assertContains "Entries should be tagged" "${messages}" "docker-volume-loopback["
+    assertContains "Entries should be formatted according to LOG_FORMAT" "${messages}" '"msg":"finished processing"'
+    assertTrue "Info entries should have daemon.info priority" "grep -q '^<30>' ${LOG_DIR}/messages"
+    assertTrue "Debug entries should have daemon.debug priority" "grep -q '^<31>' ${LOG_DIR}/messages"
+
+    # cleanup
+    stopInstance
+    kill "${RECEIVER_PID}"
+}
+
+testInvalidOutputRejected() {
+    # checks
+    assertContains "Relative log file path should be rejected" "$(startupError --log-output plugin.log)" \
+        "wrong log output 'plugin.log'"
+    assertContains "Unavailable syslog socket should be rejected" \
+        "$(startupError --log-output "syslog:${LOG_DIR}/missing.sock")" "cannot connect to syslog via"
+    assertContains "Invalid LOG_MAX_SIZE should be rejected" \
+        "$(startupError --log-output "${LOG_DIR}/plugin.log" --log-max-size lots)" "invalid size: 'lots'"
+}
+
+. test.sh
@@ -0,0 +1,56 @@
+#!/usr/bin/env bash
+
+. instance.sh
+METRICS_SOCKET="/run/docker/plugins/${INSTANCE}-metrics.sock"
+
+suiteSetUp() {
+    startInstance --metrics-address "${METRICS_SOCKET}" <<YAML
+{}
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+    rm -f "${METRICS_SOCKET}"
+}
+
+# metric prints the value of a sample given by its name along with labels, e.g. 'metric foo{bar="baz"}'
+metric() {
+    curl -s --unix-socket "${METRICS_SOCKET}" http://metrics/metrics | awk -v sample="${1}" '$1 == sample {printf "%d", $2}'
+}
+
+testVolumeMetrics() {
+    local volume container size leases mounted
+    # setup
+    volume=$(docker volume create -d "${INSTANCE}" -o size=30MiB -o fs=ext4)
+    container=$(docker run -d -v "${volume}:/srv" "${IMAGE}" sleep 60)
+    size=$(metric "docker_volume_loopback_volume_size_bytes{volume=\"${volume}\"}")
+    leases=$(metric "docker_volume_loopback_volume_leases{volume=\"${volume}\"}")
+    mounted=$(metric "docker_volume_loopback_volumes_mounted")
+
+    # checks
+    assertEquals "Volume size metric check" "31457280" "${size}"
+    assertEquals "Volume leases metric check" "1" "${leases}"
+    assertEquals "Mounted volumes metric check" "1" "${mounted}"
+    assertNotEquals "Data dir available space metric check" "" \
+        "$(metric 'docker_volume_loopback_data_dir_available_bytes{pool="default"}')"
+
+    # cleanup
+    docker rm -f "${container}" > /dev/null
+    docker volume rm "${volume}" > /dev/null
+}
+
+testOperationMetrics() {
+    local errors_before errors_after count
+    # setup
+    errors_before=$(metric 'docker_volume_loopback_operation_errors_total{operation="driver/Create"}')
+    docker volume create -d "${INSTANCE}" -o size=foo &> /dev/null
+    errors_after=$(metric 'docker_volume_loopback_operation_errors_total{operation="driver/Create"}')
+    count=$(metric 'docker_volume_loopback_operation_duration_seconds_count{operation="driver/Create"}')
+
+    # checks
+    assertEquals "Failed operation should be counted" "$((${errors_before:-0} + 1))" "${errors_after}"
+    assertTrue "Operation latency should be recorded" "[ ${count:-0} -ge 1 ]"
+}
+
+. test.sh
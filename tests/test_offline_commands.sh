@@ -0,0 +1,112 @@
+#!/usr/bin/env bash
+
+. instance.sh
+
+suiteSetUp() {
+    CLI_DIR=$(mktemp -d)
+    mkdir -p "${CLI_DIR}/data" "${CLI_DIR}/state" "${CLI_DIR}/mnt"
+    cp "${BINARY}" "${CLI_DIR}/docker-volume-loopback"
+}
+
+suiteTearDown() {
+    for mount_point in "${CLI_DIR}"/mnt/*; do
+        umount -ld "${mount_point}" &> /dev/null
+    done
+    rm -rf "${CLI_DIR}"
+}
+
+# cli runs an offline command against a given dir, e.g. 'cli "${CLI_DIR}" ls'
+cli() {
+    local dir command
+    dir="${1}"
+    command="${2}"
+    shift 2
+    "${CLI_DIR}/docker-volume-loopback" "${command}" \
+        --data-dir "${dir}/data" --state-dir "${dir}/state" --mount-dir "${dir}/mnt" "${@}"
+}
+
+testCreateInspectRemove() {
+    local created listed fs removed
+    # setup
+    created=$(cli "${CLI_DIR}" create offline -o size=30MiB -o fs=ext4)
+    listed=$(cli "${CLI_DIR}" ls)
+    fs=$(cli "${CLI_DIR}" inspect offline | jq -r '.Status.fs')
+    cli "${CLI_DIR}" rm offline
+    removed=$(cli "${CLI_DIR}" ls)
+
+    # checks
+    assertEquals "Created volume should be printed" "offline" "${created}"
+    assertContains "Created volume should be listed" "${listed}" "offline"
+    assertEquals "Created volume should be inspected" "ext4" "${fs}"
+    assertNotContains "Removed volume should not be listed" "${removed}" "offline"
+}
+
+testMountUmount() {
+    local mount_point content mounted
+    # setup
+    cli "${CLI_DIR}" create offline -o size=30MiB -o fs=ext4 > /dev/null
+    mount_point=$(cli "${CLI_DIR}" mount offline)
+    echo hello > "${mount_point}/file"
+    cli "${CLI_DIR}" umount offline
+    mountpoint -q "${mount_point}"
+    mounted=$?
+    mount_point=$(cli "${CLI_DIR}" mount offline)
+    content=$(cat "${mount_point}/file")
+    cli "${CLI_DIR}" umount offline
+
+    # checks
+    assertNotEquals "Volume should be un-mounted" "0" "${mounted}"
+    assertEquals "Content should survive re-mount" "hello" "${content}"
+
+    # cleanup
+    cli "${CLI_DIR}" rm offline
+}
+
+testFsck() {
+    # setup
+    cli "${CLI_DIR}" create offline -o size=30MiB -o fs=ext4 > /dev/null
+
+    # checks
+    assertTrue "Fsck of a healthy volume should succeed" "cli ${CLI_DIR} fsck offline > /dev/null"
+
+    # cleanup
+    cli "${CLI_DIR}" rm offline
+}
+
+testGcRemovesStaleLeases() {
+    local reported
+    # setup
+    cli "${CLI_DIR}" create offline -o size=30MiB -o fs=ext4 > /dev/null
+    mkdir -p "${CLI_DIR}/state/offline"
+    touch "${CLI_DIR}/state/offline/stale"
+    reported=$(cli "${CLI_DIR}" gc --dry-run)
+
+    # checks
+    assertEquals "Stale state dir should be reported" "${CLI_DIR}/state/offline" "${reported}"
+    assertTrue "Dry run should keep stale state dir" "test -e ${CLI_DIR}/state/offline/stale"
+    cli "${CLI_DIR}" gc > /dev/null
+    assertFalse "Stale state dir should be removed" "test -e ${CLI_DIR}/state/offline"
+    assertContains "Volume should be kept" "$(cli "${CLI_DIR}" ls)" "offline"
+
+    # cleanup
+    cli "${CLI_DIR}" rm offline
+}
+
+testLockedWhilePluginRuns() {
+    local output result
+    # setup
+    startInstance <<YAML
+{}
+YAML
+    output=$(cli "${INSTANCE_DIR}" ls 2>&1)
+    result=$?
+
+    # checks
+    assertEquals "Command should fail while plugin runs" "1" "${result}"
+    assertContains "Command should report the lock" "${output}" "is held by the plugin or another command"
+
+    # cleanup
+    stopInstance
+}
+
+. test.sh
@@ -0,0 +1,165 @@
+#!/usr/bin/env bash
+
+. instance.sh
+
+suiteSetUp() {
+    startInstance <<YAML
+policies:
+  - name: small
+    match: "small-*"
+    max-size: 60MiB
+    fs: [ext4]
+    max-total-size: 100MiB
+  - name: owned
+    match: "owned-*"
+    uid: 1000
+  - name: dense
+    match: "dense-*"
+    deny-sparse: true
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# create makes a volume of the instance with a given name and size, extra arguments are passed to docker
+create() {
+    local name size
+    name="${1}"
+    size="${2}"
+    shift 2
+    docker volume create -d "${INSTANCE}" --name "${name}" -o size="${size}" -o fs=ext4 "${@}" 2>&1
+}
+
+# failure reports error message of an admin API call
+failure() {
+    admin "${@}" | jq -r '.error.message'
+}
+
+testPolicyCreateOverMaxSize() {
+    local output
+    # setup
+    output=$(create small-big 80MiB)
+
+    # checks
+    assertContains "Creation over max size should be rejected" "${output}" "breaks policy 'small'"
+    assertContains "Creation over max size should be explained" "${output}" "exceeds max size"
+}
+
+testPolicyCreateWithDeniedFs() {
+    local output
+    # setup
+    output=$(docker volume create -d "${INSTANCE}" --name small-xfs -o size=40MiB -o fs=xfs 2>&1)
+
+    # checks
+    assertContains "Creation with fs that is not allowed should be rejected" "${output}" "is not among allowed ones"
+}
+
+testPolicyCreateWithDifferentUid() {
+    local output
+    # setup
+    output=$(create owned-root 40MiB -o uid=0)
+
+    # checks
+    assertContains "Creation with uid other than forced one should be rejected" "${output}" "uid is forced to be 1000"
+}
+
+testPolicyResizeOverMaxSize() {
+    local output
+    # setup
+    create small-resized 40MiB > /dev/null
+    output=$(failure POST /v1/volumes/small-resized/resize -d '{"size": "80MiB"}')
+
+    # checks
+    assertContains "Resize over max size should be rejected" "${output}" "exceeds max size"
+
+    # cleanup
+    docker volume rm small-resized > /dev/null
+}
+
+testPolicyResizeOverMaxTotalSize() {
+    local output size
+    # setup
+    create small-first 50MiB > /dev/null
+    create small-second 40MiB > /dev/null
+    output=$(failure POST /v1/volumes/small-second/resize -d '{"size": "55MiB"}')
+    size=$(admin POST /v1/volumes/small-second/resize -d '{"size": "45MiB"}' | jq -r '.volume.status["size-max"]')
+
+    # checks
+    assertContains "Resize over max total size should be rejected" "${output}" "max total size"
+    assertEquals "Resize within max total size should succeed" "47185920" "${size}"
+
+    # cleanup
+    docker volume rm small-first small-second > /dev/null
+}
+
+testPolicySnapshotOverMaxTotalSize() {
+    local output
+    # setup
+    create small-original 60MiB > /dev/null
+    output=$(failure POST /v1/volumes/small-original/snapshot -d '{"name": "small-snapshot"}')
+
+    # checks
+    assertContains "Snapshot over max total size should be rejected" "${output}" "max total size"
+
+    # cleanup
+    docker volume rm small-original > /dev/null
+}
+
+testPolicyRenameIntoPolicy() {
+    local output name
+    # setup
+    create outside 80MiB > /dev/null
+    output=$(failure POST /v1/volumes/outside/rename -d '{"name": "small-renamed"}')
+    name=$(admin POST /v1/volumes/outside/rename -d '{"name": "outside-renamed"}' | jq -r '.volume.name')
+
+    # checks
+    assertContains "Rename into policy over max size should be rejected" "${output}" "breaks policy 'small'"
+    assertEquals "Rename that matches no policy should succeed" "outside-renamed" "${name}"
+
+    # cleanup
+    docker volume rm outside-renamed > /dev/null
+}
+
+testPolicyRenameWithDifferentUid() {
+    local output
+    # setup
+    create outside 40MiB -o uid=0 > /dev/null
+    output=$(failure POST /v1/volumes/outside/rename -d '{"name": "owned-renamed"}')
+
+    # checks
+    assertContains "Rename of volume with uid other than forced one should be rejected" "${output}" \
+        "uid is forced to be 1000"
+
+    # cleanup
+    docker volume rm outside > /dev/null
+}
+
+testPolicyConvertToDeniedFs() {
+    local output
+    # setup
+    create small-converted 40MiB > /dev/null
+    output=$(failure POST /v1/volumes/small-converted/convert -d '{"fs": "xfs"}')
+
+    # checks
+    assertContains "Conversion to fs that is not allowed should be rejected" "${output}" "is not among allowed ones"
+
+    # cleanup
+    docker volume rm small-converted > /dev/null
+}
+
+testPolicyConvertToSparse() {
+    local output
+    # setup
+    create dense-converted 40MiB -o sparse=false > /dev/null
+    output=$(failure POST /v1/volumes/dense-converted/convert -d '{"sparse": true}')
+
+    # checks
+    assertContains "Conversion to sparse volume should be rejected" "${output}" "sparse volumes are not allowed"
+
+    # cleanup
+    docker volume rm dense-converted > /dev/null
+}
+
+. test.sh
@@ -0,0 +1,112 @@
+#!/usr/bin/env bash
+
+. instance.sh
+INSTANCE_DATA_SIZE="200M" # default pool is kept smaller than the other one so that most-free placement is predictable
+
+# startPools runs the instance with a pool named 'fast' next to the default one and a given placement strategy
+startPools() {
+    startInstance --placement "${1}" <<YAML
+pools:
+  - name: fast
+    data-dir: \${INSTANCE_DIR}/fast
+    fs: ext4
+    sparse: true
+YAML
+}
+
+suiteSetUp() {
+    startPools most-free
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# poolOf prints the pool reported in status of a volume
+poolOf() {
+    docker volume inspect "${1}" | jq -r '.[0].Status.pool'
+}
+
+testPoolOption() {
+    local volume pool
+    # setup
+    volume=$(docker volume create -d "${INSTANCE}" -o size=20MiB -o fs=ext4 -o pool=default)
+    pool=$(poolOf "${volume}")
+
+    # checks
+    assertEquals "Volume should be placed into requested pool" "default" "${pool}"
+    assertTrue "Data file should be in pool's data dir" "test -e ${INSTANCE_DIR}/data/${volume}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testPoolDefaults() {
+    local volume status
+    # setup
+    volume=$(docker volume create -d "${INSTANCE}" -o size=20MiB -o pool=fast)
+    status=$(docker volume inspect "${volume}" | jq '.[0].Status')
+
+    # checks
+    assertEquals "Pool fs should be used by default" "ext4" "$(echo "${status}" | jq -r '.fs')"
+    assertEquals "Pool sparse should be used by default" "true" "$(echo "${status}" | jq -r '.sparse')"
+    assertTrue "Data file should be in pool's data dir" "test -e ${INSTANCE_DIR}/fast/${volume}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testMostFreePlacement() {
+    local volume pool
+    # setup
+    volume=$(docker volume create -d "${INSTANCE}" -o size=20MiB -o fs=ext4)
+    pool=$(poolOf "${volume}")
+
+    # checks
+    assertEquals "Volume should be placed into pool with the most free space" "fast" "${pool}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testRoundRobinPlacement() {
+    local first second
+    # setup
+    stopInstance
+    startPools round-robin
+    first=$(docker volume create -d "${INSTANCE}" -o size=20MiB -o fs=ext4)
+    second=$(docker volume create -d "${INSTANCE}" -o size=20MiB -o fs=ext4)
+
+    # checks
+    assertNotEquals "Volumes should be placed into pools in turn" "$(poolOf "${first}")" "$(poolOf "${second}")"
+
+    # cleanup
+    docker volume rm "${first}" "${second}" > /dev/null
+    stopInstance
+    startPools most-free
+}
+
+testNamesUniqueAcrossPools() {
+    local error
+    # setup
+    docker volume create -d "${INSTANCE}" --name pooled -o size=20MiB -o fs=ext4 -o pool=default > /dev/null
+    error=$(plugin Create '{"Name": "pooled", "Opts": {"size": "20MiB", "pool": "fast"}}' | jq -r '.Err')
+
+    # checks
+    assertContains "Volume name taken in another pool should be rejected" "${error}" "already exists"
+    assertFalse "Data file should not be created in another pool" "test -e ${INSTANCE_DIR}/fast/pooled"
+
+    # cleanup
+    docker volume rm pooled > /dev/null
+}
+
+testUnknownPoolRejected() {
+    local error
+    # setup
+    error=$(docker volume create -d "${INSTANCE}" -o size=20MiB -o pool=does-not-exist 2>&1)
+
+    # checks
+    assertContains "Unknown pool should be rejected" "${error}" "pool 'does-not-exist' does not exist"
+}
+
+. test.sh
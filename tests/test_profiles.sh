@@ -0,0 +1,103 @@
+#!/usr/bin/env bash
+
+. instance.sh
+
+suiteSetUp() {
+    startInstance <<YAML
+profiles:
+  - name: ci
+    defaults:
+      size: 30MiB
+      sparse: true
+      ttl: 12h
+    enforced:
+      fs: ext4
+      uid: 1000
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+testProfileDefaults() {
+    local volume status mount_point owner
+    # setup
+    volume=$(docker volume create -d "${INSTANCE}" -o profile=ci)
+    status=$(docker volume inspect "${volume}" | jq '.[0].Status')
+    mount_point=$(plugin Mount "{\"Name\": \"${volume}\", \"ID\": \"lease\"}" | jq -r '.Mountpoint')
+    owner=$(stat -c %u "${mount_point}")
+    plugin Unmount "{\"Name\": \"${volume}\", \"ID\": \"lease\"}" > /dev/null
+
+    # checks
+    assertEquals "Profile size check" "31457280" "$(echo "${status}" | jq -r '.["size-max"]')"
+    assertEquals "Profile sparse check" "true" "$(echo "${status}" | jq -r '.sparse')"
+    assertEquals "Profile ttl check" "12h0m0s" "$(echo "${status}" | jq -r '.ttl')"
+    assertEquals "Profile fs check" "ext4" "$(echo "${status}" | jq -r '.fs')"
+    assertEquals "Profile uid check" "1000" "${owner}"
+    assertEquals "Profile should be reported" "ci" "$(echo "${status}" | jq -r '.profile')"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testProfileDefaultsOverridden() {
+    local volume status
+    # setup
+    volume=$(docker volume create -d "${INSTANCE}" -o profile=ci -o size=20MiB -o sparse=false -o fs=ext4)
+    status=$(docker volume inspect "${volume}" | jq '.[0].Status')
+
+    # checks
+    assertEquals "Explicit size should win over default" "20971520" "$(echo "${status}" | jq -r '.["size-max"]')"
+    assertEquals "Explicit sparse should win over default" "false" "$(echo "${status}" | jq -r '.sparse')"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testEnforcedConflictRejected() {
+    local error
+    # setup
+    error=$(docker volume create -d "${INSTANCE}" --name conflicting -o profile=ci -o uid=0 2>&1)
+
+    # checks
+    assertContains "Enforced option conflict should be rejected" "${error}" \
+        "option 'uid' is enforced to be '1000' by profile 'ci' but '0' given"
+    assertNotContains "Rejected volume should not be created" "$(docker volume ls -q)" "conflicting"
+}
+
+testUnknownProfileRejected() {
+    local error
+    # setup
+    error=$(docker volume create -d "${INSTANCE}" -o profile=does-not-exist 2>&1)
+
+    # checks
+    assertContains "Unknown profile should be rejected" "${error}" "profile 'does-not-exist' does not exist"
+}
+
+testInvalidProfileRejectedAtStartup() {
+    local dir output code
+    # setup
+    dir=$(mktemp -d)
+    cat > "${dir}/config.yaml" <<YAML
+profiles:
+  - name: broken
+    defaults:
+      fs: xfs
+    enforced:
+      fs: ext4
+YAML
+    output=$(timeout 10 "${INSTANCE_DIR}/docker-volume-loopback" --config "${dir}/config.yaml" \
+        --socket "${dir}/plugin.sock" --data-dir "${dir}" --state-dir "${dir}" --mount-dir "${dir}" 2>&1)
+    code=$?
+
+    # checks
+    assertNotEquals "Invalid profile should fail startup" "0" "${code}"
+    assertContains "Invalid profile should be reported" "${output}" \
+        "option 'fs' of profile 'broken' is both a default and enforced"
+
+    # cleanup
+    rm -rf "${dir}"
+}
+
+. test.sh
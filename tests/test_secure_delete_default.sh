@@ -0,0 +1,73 @@
+#!/usr/bin/env bash
+
+. instance.sh
+
+suiteSetUp() {
+    startInstance --secure-delete random <<YAML
+{}
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# create makes a volume of the instance with a given name and size, extra arguments are passed to docker
+create() {
+    local name size
+    name="${1}"
+    size="${2}"
+    shift 2
+    docker volume create -d "${INSTANCE}" --name "${name}" -o size="${size}" -o fs=ext4 "${@}" 2>&1
+}
+
+# erased tells whether data of a volume was erased according to instance logs
+erased() {
+    grep '"msg":"erasing volume data"' "${INSTANCE_DIR}/log" | jq -r '.volume' | grep -qx "${1}"
+}
+
+testPluginWideMethod() {
+    # setup
+    create erased-default 20MiB > /dev/null
+    docker volume rm erased-default > /dev/null
+
+    # checks
+    assertTrue "Volume without a method should be erased with plugin-wide one" "erased erased-default"
+}
+
+testVolumeOptsOut() {
+    local method
+    for method in none false; do
+        # setup
+        create "erased-${method}" 20MiB -o secure-delete="${method}" > /dev/null
+        docker volume rm "erased-${method}" > /dev/null
+
+        # checks
+        assertFalse "Volume with '${method}' method should not be erased" "erased erased-${method}"
+        assertFalse "Volume with '${method}' method should be removed" "test -e ${INSTANCE_DIR}/data/erased-${method}"
+    done
+}
+
+testErasureDoesNotBlockOtherVolumes() {
+    local pid error created
+    # setup
+    create erased-big 1GiB > /dev/null
+    docker volume rm erased-big > /dev/null &
+    pid=$!
+    for _ in $(seq 50); do
+        error=$(plugin Mount '{"Name": "erased-big", "ID": "erasure"}' | jq -r '.Err')
+        [[ "${error}" == *"being deleted"* ]] && break
+        sleep 0.1
+    done
+    created=$(create erased-other 20MiB)
+
+    # checks
+    assertContains "Volume being erased should be refused by other operations" "${error}" "is being deleted"
+    assertEquals "Other volumes should be created while a volume is being erased" "erased-other" "${created}"
+
+    # cleanup
+    wait "${pid}"
+    docker volume rm erased-other > /dev/null
+}
+
+. test.sh
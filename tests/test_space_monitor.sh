@@ -0,0 +1,76 @@
+#!/usr/bin/env bash
+
+# data dir of the instance is a tmpfs of a known size that is filled up by a file in a hidden dir
+INSTANCE_DATA_SIZE=200M
+. instance.sh
+
+suiteSetUp() {
+    startInstance --space-warning 100MiB --space-critical 50MiB --space-check-interval 1s --read-only-on-critical <<YAML
+{}
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# fill takes up a given amount of data dir space, 0 to free it again, and waits for the monitor to notice
+fill() {
+    mkdir -p "${INSTANCE_DIR}/data/.filler"
+    rm -f "${INSTANCE_DIR}/data/.filler/file"
+    if [ "${1}" != "0" ]; then
+        fallocate -l "${1}" "${INSTANCE_DIR}/data/.filler/file"
+    fi
+    sleep 2
+}
+
+# status reports a field of volume status
+status() {
+    docker volume inspect "${1}" | jq -r ".[0].Status[\"${2}\"]"
+}
+
+testSpaceWarning() {
+    local volume warning ok
+    # setup
+    volume=$(docker volume create -d "${INSTANCE}" -o size=100MiB -o fs=ext4 -o sparse=true)
+    fill 120M
+    warning=$(status "${volume}" data-dir-space)
+    fill 0
+    ok=$(status "${volume}" data-dir-space)
+
+    # checks
+    assertEquals "Space state should be reported as warning" "warning" "${warning}"
+    assertEquals "Space state should recover" "ok" "${ok}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testSpaceCritical() {
+    local mounted unmounted container state read_only write output recovered
+    # setup
+    mounted=$(docker volume create -d "${INSTANCE}" -o size=100MiB -o fs=ext4 -o sparse=true)
+    unmounted=$(docker volume create -d "${INSTANCE}" -o size=100MiB -o fs=ext4 -o sparse=true)
+    container=$(docker run -d -v "${mounted}:/srv" "${IMAGE}" sleep 60)
+    fill 170M
+    state=$(status "${mounted}" data-dir-space)
+    read_only=$(status "${mounted}" read-only)
+    docker exec "${container}" touch /srv/file &> /dev/null
+    write=$?
+    output=$(docker run --rm -v "${unmounted}:/srv" "${IMAGE}" true 2>&1)
+    fill 0
+    recovered=$(status "${mounted}" read-only)
+
+    # checks
+    assertEquals "Space state should be reported as critical" "critical" "${state}"
+    assertEquals "Sparse volume in use should be re-mounted read-only" "true" "${read_only}"
+    assertNotEquals "Sparse volume in use should refuse writes" "0" "${write}"
+    assertContains "Sparse volume should not be mounted" "${output}" "critically low on free space"
+    assertEquals "Sparse volume should be re-mounted read-write once space is freed" "false" "${recovered}"
+
+    # cleanup
+    docker rm -f "${container}" > /dev/null
+    docker volume rm "${mounted}" "${unmounted}" > /dev/null
+}
+
+. test.sh
@@ -0,0 +1,118 @@
+#!/usr/bin/env bash
+
+. instance.sh
+INSTANCE_LAUNCHER="systemd-socket-activate -l ${INSTANCE_SOCKET} -E PATH -E NOTIFY_SOCKET -E WATCHDOG_USEC"
+
+# receive collects notifications sent to a unixgram socket into a file, one per line, the way systemd gets them
+receive() {
+    python3 -c '
+import socket, sys
+receiver = socket.socket(socket.AF_UNIX, socket.SOCK_DGRAM)
+receiver.bind(sys.argv[1])
+with open(sys.argv[2], "a", buffering=1) as notifications:
+    while True:
+        notifications.write(receiver.recv(4096).decode() + "\n")
+' "${1}" "${2}" &
+    RECEIVER_PID=$!
+    for _ in $(seq 50); do
+        test -S "${1}" && return 0
+        sleep 0.2
+    done
+    return 1
+}
+
+# waitNotified waits for a given notification to be received at least a given number of times
+waitNotified() {
+    for _ in $(seq 50); do
+        [ "$(grep -c "^${1}" "${NOTIFY_DIR}/notifications")" -ge "${2:-1}" ] && return 0
+        sleep 0.2
+    done
+    return 1
+}
+
+suiteSetUp() {
+    NOTIFY_DIR=$(mktemp -d)
+    receive "${NOTIFY_DIR}/notify.sock" "${NOTIFY_DIR}/notifications"
+    export NOTIFY_SOCKET="${NOTIFY_DIR}/notify.sock" WATCHDOG_USEC=1000000
+    startInstance <<YAML
+{}
+YAML
+    plugin List > /dev/null # plugin is started by the first connection to its socket
+    unset NOTIFY_SOCKET WATCHDOG_USEC
+}
+
+suiteTearDown() {
+    stopInstance
+    kill "${RECEIVER_PID}"
+    rm -rf "${NOTIFY_DIR}" "${INSTANCE_SOCKET}"
+}
+
+testSocketActivation() {
+    local volumes sockets
+    # setup
+    volumes=$(plugin List | jq -r '.Volumes | length')
+    sockets=$(grep '"msg":"using socket passed by systemd"' "${INSTANCE_DIR}/log" | jq -r '.socket')
+
+    # checks
+    assertEquals "Plugin should serve passed socket" "0" "${volumes}"
+    assertEquals "Passed socket should be used" "${INSTANCE_SOCKET}" "${sockets}"
+    assertEquals "Sockets that are not passed should be opened" "0" "$(admin GET /v1/volumes | jq -r '.volumes | length')"
+}
+
+testReadiness() {
+    # checks
+    assertTrue "Readiness should be reported" "waitNotified READY=1"
+    assertTrue "Status should be reported" "waitNotified STATUS=Serving"
+}
+
+testWatchdog() {
+    local before after
+    # setup
+    waitNotified WATCHDOG=1
+    before=$(grep -c '^WATCHDOG=1' "${NOTIFY_DIR}/notifications")
+    sleep 3
+    after=$(grep -c '^WATCHDOG=1' "${NOTIFY_DIR}/notifications")
+
+    # checks
+    assertTrue "Watchdog should be pinged twice as often as expected" "[ $((after - before)) -ge 5 ]"
+}
+
+testUnknownSocketClosed() {
+    local dir output
+    # setup
+    dir=$(mktemp -d)
+    systemd-socket-activate -l "${dir}/unknown.sock" "${INSTANCE_DIR}/docker-volume-loopback" \
+        --socket "${dir}/plugin.sock" --data-dir "${dir}" --state-dir "${dir}" --mount-dir "${dir}" \
+        --log-level 3 --log-format json > "${dir}/log" 2>&1 &
+    for _ in $(seq 50); do
+        test -S "${dir}/unknown.sock" && break
+        sleep 0.2
+    done
+    curl -s --unix-socket "${dir}/unknown.sock" -X POST http://plugin/VolumeDriver.List > /dev/null
+    for _ in $(seq 50); do
+        test -S "${dir}/plugin.sock" && break
+        sleep 0.2
+    done
+    output=$(grep '"msg":"socket passed by systemd does not match any of configured ones - closing it"' "${dir}/log")
+
+    # checks
+    assertContains "Passed socket that is not configured should be closed" "${output}" "${dir}/unknown.sock"
+    assertTrue "Configured socket should be opened" "test -S ${dir}/plugin.sock"
+
+    # cleanup
+    kill -TERM $!
+    wait $!
+    rm -rf "${dir}"
+}
+
+testPassedSocketKeptOnShutdown() {
+    # setup
+    kill -TERM "${INSTANCE_PID}"
+    wait "${INSTANCE_PID}"
+
+    # checks
+    assertTrue "Passed socket should be left in place" "test -S ${INSTANCE_SOCKET}"
+    assertFalse "Opened sockets should be removed" "test -S ${INSTANCE_ADMIN_SOCKET}"
+}
+
+. test.sh
@@ -0,0 +1,146 @@
+#!/usr/bin/env bash
+
+. instance.sh
+TENANT="small"
+
+suiteSetUp() {
+    startInstance <<YAML
+tenants:
+  - name: ${TENANT}
+    prefix: ${TENANT}-
+    max-size: 100MiB
+    max-volumes: 2
+  - name: other
+    max-allocated: 50MiB
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# create makes a volume of the instance with a given name and size, extra arguments are passed to docker
+create() {
+    local name size
+    name="${1}"
+    size="${2}"
+    shift 2
+    docker volume create -d "${INSTANCE}" --name "${name}" -o size="${size}" -o fs=ext4 "${@}" 2>&1
+}
+
+testTenantUsage() {
+    local usage
+    # setup
+    create "${TENANT}-usage" 60MiB > /dev/null
+    usage=$(admin GET "/v1/tenants/${TENANT}")
+
+    # checks
+    assertEquals "Tenant volumes check" "1" "$(echo "${usage}" | jq -r '.tenant.volumes')"
+    assertEquals "Tenant size check" "62914560" "$(echo "${usage}" | jq -r '.tenant.size')"
+
+    # cleanup
+    docker volume rm "${TENANT}-usage" > /dev/null
+}
+
+testTenantCreateOverMaxSize() {
+    local output
+    # setup
+    create "${TENANT}-first" 60MiB > /dev/null
+    output=$(create "${TENANT}-second" 60MiB)
+
+    # checks
+    assertContains "Creation over max size should be rejected" "${output}" "may only add up to 104857600 bytes"
+
+    # cleanup
+    docker volume rm "${TENANT}-first" > /dev/null
+}
+
+testTenantCreateOverMaxVolumes() {
+    local output
+    # setup
+    create "${TENANT}-first" 20MiB > /dev/null
+    create "${TENANT}-second" 20MiB > /dev/null
+    output=$(create "${TENANT}-third" 20MiB)
+
+    # checks
+    assertContains "Creation over max volumes should be rejected" "${output}" "may only have 2"
+
+    # cleanup
+    docker volume rm "${TENANT}-first" "${TENANT}-second" > /dev/null
+}
+
+testTenantResizeOverMaxSize() {
+    local code
+    # setup
+    create "${TENANT}-resized" 60MiB > /dev/null
+    code=$(admin POST "/v1/volumes/${TENANT}-resized/resize" -d '{"size": "120MiB"}' | jq -r '.error.code')
+
+    # checks
+    assertEquals "Resize over max size should be rejected" "insufficient-capacity" "${code}"
+
+    # cleanup
+    docker volume rm "${TENANT}-resized" > /dev/null
+}
+
+testTenantSnapshotOverMaxSize() {
+    local code
+    # setup
+    create "${TENANT}-original" 60MiB > /dev/null
+    code=$(admin POST "/v1/volumes/${TENANT}-original/snapshot" -d "{\"name\": \"${TENANT}-snapshot\"}" \
+        | jq -r '.error.code')
+
+    # checks
+    assertEquals "Snapshot over max size should be rejected" "insufficient-capacity" "${code}"
+
+    # cleanup
+    docker volume rm "${TENANT}-original" > /dev/null
+}
+
+testTenantRenameIntoTenant() {
+    local code name
+    # setup
+    create "${TENANT}-existing" 60MiB > /dev/null
+    create "outside" 60MiB > /dev/null
+    code=$(admin POST "/v1/volumes/outside/rename" -d "{\"name\": \"${TENANT}-renamed\"}" | jq -r '.error.code')
+    name=$(admin POST "/v1/volumes/outside/rename" -d '{"name": "outside-renamed"}' | jq -r '.volume.name')
+
+    # checks
+    assertEquals "Rename into tenant over max size should be rejected" "insufficient-capacity" "${code}"
+    assertEquals "Rename outside of tenant should succeed" "outside-renamed" "${name}"
+
+    # cleanup
+    docker volume rm "${TENANT}-existing" "outside-renamed" > /dev/null
+}
+
+testTenantOptionCannotOverridePrefix() {
+    local output tenant
+    # setup
+    output=$(create "${TENANT}-elsewhere" 20MiB -o tenant=other)
+    create "${TENANT}-own" 20MiB -o tenant="${TENANT}" > /dev/null
+    create "outside" 20MiB -o tenant=other > /dev/null
+    tenant=$(docker volume inspect outside | jq -r '.[0].Status.tenant')
+
+    # checks
+    assertContains "Tenant option other than prefix owner should be rejected" "${output}" "owns the name prefix"
+    assertTrue "Tenant option equal to prefix owner should be accepted" \
+        "admin GET /v1/volumes/${TENANT}-own | jq -e .volume > /dev/null"
+    assertEquals "Tenant option should apply to volumes outside of prefixes" "other" "${tenant}"
+
+    # cleanup
+    docker volume rm "${TENANT}-own" "outside" > /dev/null
+}
+
+testTenantConvertToRegularOverMaxAllocated() {
+    local code
+    # setup
+    create "outside" 60MiB -o sparse=true -o tenant=other > /dev/null
+    code=$(admin POST "/v1/volumes/outside/convert" -d '{"sparse": false}' | jq -r '.error.code')
+
+    # checks
+    assertEquals "Conversion to regular volume over max allocated should be rejected" "insufficient-capacity" "${code}"
+
+    # cleanup
+    docker volume rm "outside" > /dev/null
+}
+
+. test.sh
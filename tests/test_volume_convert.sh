@@ -0,0 +1,67 @@
+#!/usr/bin/env bash
+
+testConvertSparse() {
+    local volume response sparse content
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    docker run --rm -v "${volume}:/srv" "${IMAGE}" sh -c 'echo hello > /srv/file'
+    response=$(api POST "/${volume}/convert" -d '{"sparse": true}')
+    sparse=$(echo "${response}" | jq -r '.volume.status.sparse')
+    content=$(docker run --rm -v "${volume}:/srv" "${IMAGE}" cat /srv/file)
+
+    # checks
+    assertEquals "Reported sparse check" "true" "${sparse}"
+    assertEquals "Content should survive conversion" "hello" "${content}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testConvertFs() {
+    local volume response fs metadata_fs content
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB -o fs=xfs)
+    docker run --rm -v "${volume}:/srv" "${IMAGE}" sh -c 'echo hello > /srv/file'
+    response=$(api POST "/${volume}/convert" -d '{"fs": "ext4"}')
+    fs=$(echo "${response}" | jq -r '.volume.status.fs')
+    metadata_fs=$(run cat "${DATA_DIR}/.metadata/${volume}" | jq -r '.fs')
+    content=$(docker run --rm -v "${volume}:/srv" "${IMAGE}" cat /srv/file)
+
+    # checks
+    assertEquals "Reported fs check" "ext4" "${fs}"
+    assertEquals "Persisted fs check" "ext4" "${metadata_fs}"
+    assertEquals "Content should survive conversion" "hello" "${content}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testConvertToSameFs() {
+    local volume message
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB -o fs=xfs)
+    message=$(api POST "/${volume}/convert" -d '{"fs": "xfs"}' | jq -r '.error.message')
+
+    # checks
+    assertContains "Conversion into the same fs should be rejected" "${message}" "is already formatted as 'xfs'"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testConvertVolumeInUse() {
+    local volume container code
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    container=$(docker run -d -v "${volume}:/srv" "${IMAGE}" sleep 60)
+    code=$(api POST "/${volume}/convert" -d '{"sparse": true}' | jq -r '.error.code')
+
+    # checks
+    assertEquals "Conversion of volume in use should be rejected" "in-use" "${code}"
+
+    # cleanup
+    docker rm -f "${container}" > /dev/null
+    docker volume rm "${volume}" > /dev/null
+}
+
+. test.sh
@@ -8,7 +8,7 @@ testWrongOptionNames() {
 
     # checks
     assertEquals "Volume creation should fail if unsupported options passed" "1" "${result}"
-    assertContains "Error mentions wrong and correct options" "${error}" "options 'x, y' are not among supported ones: size, sparse, fs, uid, gid, mode"
+    assertContains "Error mentions wrong and correct options" "${error}" "options 'x, y' are not among supported ones: size, sparse, fs, uid, gid, mode, secure-delete, protected, ttl, reserve"
 }
 
 testBelowMinAllowedSize() {
@@ -41,4 +41,31 @@ testSparseExt4Status() {
     docker volume rm "${volume}" > /dev/null
 }
 
+testMountedUsageStatus() {
+    local volume container info status_sparse status_leases status_loop_device status_bytes_used status_inodes_free
+    # setup
+
+    volume=$(docker volume create -d "${DRIVER}" -o sparse=true -o size=100MB)
+    container=$(docker run -d -v "${volume}:/srv" "${IMAGE}" sh -c 'dd if=/dev/zero of=/srv/file bs=1M count=10 && sleep 60')
+    sleep 2
+
+    info=$(docker volume inspect "${volume}" | jq ".[0].Status")
+
+    status_sparse=$(echo "${info}" | jq -r ".sparse")
+    status_leases=$(echo "${info}" | jq -r ".leases")
+    status_loop_device=$(echo "${info}" | jq -r '.["loop-device"]')
+    status_bytes_used=$(echo "${info}" | jq -r '.["fs-bytes-used"]')
+    status_inodes_free=$(echo "${info}" | jq -r '.["fs-inodes-free"]')
+
+    assertEquals "Reported sparse check" "true" "${status_sparse}"
+    assertEquals "Reported leases check" "1" "${status_leases}"
+    assertContains "Reported loop device check" "${status_loop_device}" "/dev/loop"
+    assertTrue "Reported used bytes check" "[ ${status_bytes_used} -ge 10485760 ]"
+    assertTrue "Reported free inodes check" "[ ${status_inodes_free} -gt 0 ]"
+
+    # cleanup
+    docker rm -f "${container}" > /dev/null
+    docker volume rm "${volume}" > /dev/null
+}
+
 . test.sh
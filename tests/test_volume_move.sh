@@ -0,0 +1,181 @@
+#!/usr/bin/env bash
+
+. instance.sh
+
+suiteSetUp() {
+    startInstance <<YAML
+pools:
+  - name: fast
+    data-dir: \${INSTANCE_DIR}/fast
+    fs: ext4
+YAML
+}
+
+suiteTearDown() {
+    stopInstance
+}
+
+# create makes a volume in the default pool of the instance
+create() {
+    docker volume create -d "${INSTANCE}" --name "${1}" -o size=20MiB -o fs=ext4 -o pool=default > /dev/null
+}
+
+# journal records a move of a volume of the instance from default pool to fast one the same way the plugin does
+journal() {
+    mkdir -p "${INSTANCE_DIR}/state/.journal"
+    jq -n --arg volume "${1}" --arg data_file "${INSTANCE_DIR}/data/${1}" \
+        --arg new_data_file "${INSTANCE_DIR}/fast/${1}" --arg aside_file "${INSTANCE_DIR}/data/.tmp/${1}.test" \
+        '{"operation": "move", "volume": $volume, "data-file": $data_file, "new-data-file": $new_data_file,
+          "aside-file": $aside_file, "trace": "test", "started-at": "2020-01-01T00:00:00Z"}' \
+        > "${INSTANCE_DIR}/state/.journal/move-${1}.json"
+}
+
+# mountVolume mounts a volume of the instance for a given lease id and prints its mount point
+mountVolume() {
+    plugin Mount "{\"Name\": \"${1}\", \"ID\": \"${2}\"}" | jq -r '.Mountpoint'
+}
+
+# unmountVolume releases a lease of a volume of the instance
+unmountVolume() {
+    plugin Unmount "{\"Name\": \"${1}\", \"ID\": \"${2}\"}" > /dev/null
+}
+
+# status prints a status field of a volume of the instance
+status() {
+    admin GET "/v1/volumes/${1}" | jq -r ".volume.status[\"${2}\"] // empty"
+}
+
+testMovePreservesData() {
+    local mount_point checksums content
+    # setup
+    create moved
+    mount_point=$(mountVolume moved lease)
+    echo hello > "${mount_point}/file"
+    unmountVolume moved lease
+    admin POST /v1/volumes/moved/move -d '{"pool": "fast"}' > /dev/null
+    checksums=$(grep '"msg":"compared checksums"' "${INSTANCE_DIR}/log" | grep '"volume":"moved"' |
+        jq -r 'select(.checksum == .["copy-checksum"]) | .checksum')
+    mount_point=$(mountVolume moved lease)
+    content=$(cat "${mount_point}/file")
+    unmountVolume moved lease
+
+    # checks
+    assertEquals "Volume should be in target pool" "fast" "$(status moved pool)"
+    assertTrue "Data file should be in target pool" "test -e ${INSTANCE_DIR}/fast/moved"
+    assertFalse "Data file should be gone from source pool" "test -e ${INSTANCE_DIR}/data/moved"
+    assertNotEquals "Copy should be verified with a checksum" "" "${checksums}"
+    assertEquals "Data should survive the move" "hello" "${content}"
+
+    # cleanup
+    docker volume rm moved > /dev/null
+}
+
+testMoveInUseRejected() {
+    local code
+    # setup
+    create busy
+    mountVolume busy lease > /dev/null
+    code=$(admin POST /v1/volumes/busy/move -d '{"pool": "fast"}' | jq -r '.error.code')
+
+    # checks
+    assertEquals "Move of a volume in use should be rejected" "in-use" "${code}"
+    assertEquals "Volume should stay in its pool" "default" "$(status busy pool)"
+
+    # cleanup
+    unmountVolume busy lease
+    docker volume rm busy > /dev/null
+}
+
+testMoveOnUnmount() {
+    local error
+    # setup
+    create frozen
+    mountVolume frozen first > /dev/null
+    admin POST /v1/volumes/frozen/move -d '{"pool": "fast", "on-unmount": true}' > /dev/null
+
+    # checks
+    assertEquals "Pending move should be reported" "fast" "$(status frozen pending-move)"
+    assertEquals "Volume should stay in its pool until un-mounted" "default" "$(status frozen pool)"
+    error=$(plugin Mount '{"Name": "frozen", "ID": "second"}' | jq -r '.Err')
+    assertContains "Frozen volume should not be mounted again" "${error}" "is frozen until it's un-mounted"
+    unmountVolume frozen first
+    assertEquals "Volume should be moved once un-mounted" "fast" "$(status frozen pool)"
+    assertEquals "Pending move should be cleared" "" "$(status frozen pending-move)"
+
+    # cleanup
+    docker volume rm frozen > /dev/null
+}
+
+testMoveErasesOriginal() {
+    # setup
+    docker volume create -d "${INSTANCE}" --name erased -o size=20MiB -o fs=ext4 -o pool=default \
+        -o secure-delete=zero > /dev/null
+    admin POST /v1/volumes/erased/move -d '{"pool": "fast"}' > /dev/null
+
+    # checks
+    assertContains "Original data file should be erased" \
+        "$(grep '"msg":"erasing volume data"' "${INSTANCE_DIR}/log" | grep '"volume":"erased"')" '"method":"zero"'
+    assertEquals "Original data file should be removed" "" "$(ls "${INSTANCE_DIR}/data/.tmp")"
+    assertFalse "Journal file should be removed" "test -e ${INSTANCE_DIR}/state/.journal/move-erased.json"
+
+    # cleanup
+    docker volume rm erased > /dev/null
+}
+
+testInterruptedMoveRolledBack() {
+    # setup
+    create stale
+    mkdir -p "${INSTANCE_DIR}/fast/.metadata"
+    # killed after the copy was moved into place but before the original was moved aside
+    cp "${INSTANCE_DIR}/data/stale" "${INSTANCE_DIR}/fast/stale"
+    cp "${INSTANCE_DIR}/data/.metadata/stale" "${INSTANCE_DIR}/fast/.metadata/stale"
+    journal stale
+    restartInstance
+
+    # checks
+    assertEquals "Volume should stay in its pool" "default" "$(status stale pool)"
+    assertFalse "Copy should be removed from target pool" "test -e ${INSTANCE_DIR}/fast/stale"
+    assertFalse "Copy metadata should be removed from target pool" "test -e ${INSTANCE_DIR}/fast/.metadata/stale"
+    assertFalse "Journal file should be removed" "test -e ${INSTANCE_DIR}/state/.journal/move-stale.json"
+
+    # cleanup
+    docker volume rm stale > /dev/null
+}
+
+testInterruptedMoveCompleted() {
+    # setup
+    create aside
+    mkdir -p "${INSTANCE_DIR}/fast/.metadata" "${INSTANCE_DIR}/data/.tmp"
+    # killed after the original was moved aside but before it was erased
+    cp "${INSTANCE_DIR}/data/aside" "${INSTANCE_DIR}/fast/aside"
+    cp "${INSTANCE_DIR}/data/.metadata/aside" "${INSTANCE_DIR}/fast/.metadata/aside"
+    mv "${INSTANCE_DIR}/data/aside" "${INSTANCE_DIR}/data/.tmp/aside.test"
+    journal aside
+    restartInstance
+
+    # checks
+    assertEquals "Volume should be in target pool" "fast" "$(status aside pool)"
+    assertFalse "Original data file should be removed" "test -e ${INSTANCE_DIR}/data/.tmp/aside.test"
+    assertFalse "Original metadata should be removed" "test -e ${INSTANCE_DIR}/data/.metadata/aside"
+    assertFalse "Journal file should be removed" "test -e ${INSTANCE_DIR}/state/.journal/move-aside.json"
+
+    # cleanup
+    docker volume rm aside > /dev/null
+}
+
+testMoveInvalidPoolRejected() {
+    local same unknown
+    # setup
+    create stays
+    same=$(admin POST /v1/volumes/stays/move -d '{"pool": "default"}' | jq -r '.error.message')
+    unknown=$(admin POST /v1/volumes/stays/move -d '{"pool": "does-not-exist"}' | jq -r '.error.message')
+
+    # checks
+    assertContains "Move into the same pool should be rejected" "${same}" "is already in pool 'default'"
+    assertContains "Move into unknown pool should be rejected" "${unknown}" "pool 'does-not-exist' does not exist"
+
+    # cleanup
+    docker volume rm stays > /dev/null
+}
+
+. test.sh
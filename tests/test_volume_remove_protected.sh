@@ -0,0 +1,44 @@
+#!/usr/bin/env bash
+
+testProtectedVolumeRemoval() {
+    local volume error result protected
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB -o protected=true)
+    protected=$(docker volume inspect "${volume}" | jq -r '.[0].Status.protected')
+    error=$(docker volume rm "${volume}" 2>&1)
+    result=$?
+
+    # checks
+    assertEquals "Volume should be reported as protected" "true" "${protected}"
+    assertEquals "Volume removal should fail" "1" "${result}"
+    assertContains "${error}" "volume is protected"
+    assertTrue "Data file should be kept" "run test -e ${DATA_DIR}/${volume}"
+
+    # cleanup - drop metadata to lift the protection
+    run rm -f "${DATA_DIR}/.metadata/${volume}"
+    docker volume rm "${volume}" > /dev/null
+}
+
+testUnprotectedVolumeRemoval() {
+    local volume result
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB -o protected=false)
+    docker volume rm "${volume}" > /dev/null
+    result=$?
+
+    # checks
+    assertEquals "Volume removal should succeed" "0" "${result}"
+}
+
+testNonBooleanProtected() {
+    local error result
+    # setup
+    error=$(docker volume create -d "${DRIVER}" -o protected=x 2>&1)
+    result=$?
+
+    # checks
+    assertEquals "Volume creation should fail" "1" "${result}"
+    assertContains "${error}" "cannot parse 'protected' option value 'x' as bool"
+}
+
+. test.sh
@@ -0,0 +1,41 @@
+#!/usr/bin/env bash
+
+testSecureDeleteMethods() {
+    local volume result method
+    for method in none discard zero random true false; do
+        # setup
+        volume=$(docker volume create -d "${DRIVER}" -o size=100MiB -o secure-delete="${method}")
+        docker run --rm -v "${volume}:/srv" "${IMAGE}" dd if=/dev/urandom of=/srv/data bs=1M count=10 &> /dev/null
+
+        # checks
+        docker volume rm "${volume}" > /dev/null
+        result=$?
+        assertEquals "Volume removal should succeed with '${method}' method" "0" "${result}"
+        assertFalse "Data file should be removed" "run test -e ${DATA_DIR}/${volume}"
+    done
+}
+
+testSecureDeleteSparse() {
+    local volume result
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB -o sparse=true -o secure-delete=auto)
+    docker run --rm -v "${volume}:/srv" "${IMAGE}" dd if=/dev/urandom of=/srv/data bs=1M count=10 &> /dev/null
+
+    # checks
+    docker volume rm "${volume}" > /dev/null
+    result=$?
+    assertEquals "Volume removal should succeed" "0" "${result}"
+}
+
+testWrongSecureDeleteMethod() {
+    local error result
+    # setup
+    error=$(docker volume create -d "${DRIVER}" -o secure-delete=foo 2>&1)
+    result=$?
+
+    # checks
+    assertEquals "Volume creation should fail for unsupported method" "1" "${result}"
+    assertContains "${error}" "'secure-delete' option value 'foo' is not among supported ones: true, false, none, auto, discard, zero, random"
+}
+
+. test.sh
@@ -0,0 +1,65 @@
+#!/usr/bin/env bash
+
+testRenameKeepsContents() {
+    local volume renamed name content code
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    renamed="${volume}-renamed"
+    docker run --rm -v "${volume}:/srv" "${IMAGE}" sh -c 'echo hello > /srv/file'
+    name=$(api POST "/${volume}/rename" -d "{\"name\": \"${renamed}\"}" | jq -r '.volume.name')
+    content=$(docker run --rm -v "${renamed}:/srv" "${IMAGE}" cat /srv/file)
+    code=$(api GET "/${volume}" | jq -r '.error.code')
+
+    # checks
+    assertEquals "Reported name check" "${renamed}" "${name}"
+    assertEquals "Content should survive rename" "hello" "${content}"
+    assertEquals "Old name should be gone" "not-found" "${code}"
+    assertFalse "Old data file should be gone" "run test -e ${DATA_DIR}/${volume}"
+
+    # cleanup
+    docker volume rm "${renamed}" > /dev/null
+}
+
+testRenameToExistingName() {
+    local volume other code
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    other=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    code=$(api POST "/${volume}/rename" -d "{\"name\": \"${other}\"}" | jq -r '.error.code')
+
+    # checks
+    assertEquals "Rename to a taken name should be rejected" "exists" "${code}"
+
+    # cleanup
+    docker volume rm "${volume}" "${other}" > /dev/null
+}
+
+testRenameToInvalidName() {
+    local volume message
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    message=$(api POST "/${volume}/rename" -d '{"name": ".hidden"}' | jq -r '.error.message')
+
+    # checks
+    assertContains "Rename to an invalid name should be rejected" "${message}" "invalid volume name"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testRenameVolumeInUse() {
+    local volume container code
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    container=$(docker run -d -v "${volume}:/srv" "${IMAGE}" sleep 60)
+    code=$(api POST "/${volume}/rename" -d "{\"name\": \"${volume}-renamed\"}" | jq -r '.error.code')
+
+    # checks
+    assertEquals "Rename of volume in use should be rejected" "in-use" "${code}"
+
+    # cleanup
+    docker rm -f "${container}" > /dev/null
+    docker volume rm "${volume}" > /dev/null
+}
+
+. test.sh
@@ -0,0 +1,53 @@
+#!/usr/bin/env bash
+
+testStrictReserveExt4() {
+    local volume status_size_allocated
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o fs=ext4 -o size=100MB -o reserve=strict)
+
+    status_size_allocated=$(docker volume inspect "${volume}" | jq -r '.[0].Status["size-allocated"]')
+
+    # checks
+    assertTrue "Entire data file should be allocated" "[ ${status_size_allocated} -ge 100000000 ]"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testStrictReserveXfs() {
+    local volume status_size_allocated
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o fs=xfs -o size=100MB -o reserve=strict)
+
+    status_size_allocated=$(docker volume inspect "${volume}" | jq -r '.[0].Status["size-allocated"]')
+
+    # checks
+    assertTrue "Entire data file should be allocated" "[ ${status_size_allocated} -ge 100000000 ]"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testStrictReserveSparse() {
+    local error result
+    # setup
+    error=$(docker volume create -d "${DRIVER}" -o sparse=true -o reserve=strict 2>&1)
+    result=$?
+
+    # checks
+    assertEquals "Volume creation should fail" "1" "${result}"
+    assertContains "${error}" "'reserve' option value 'strict' cannot be used with sparse volumes"
+}
+
+testWrongReserve() {
+    local error result
+    # setup
+    error=$(docker volume create -d "${DRIVER}" -o reserve=foo 2>&1)
+    result=$?
+
+    # checks
+    assertEquals "Volume creation should fail" "1" "${result}"
+    assertContains "${error}" "'reserve' option value 'foo' is not among supported ones: none, strict"
+}
+
+. test.sh
@@ -0,0 +1,67 @@
+#!/usr/bin/env bash
+
+testResetWipesContents() {
+    local volume files
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    docker run --rm -v "${volume}:/srv" "${IMAGE}" sh -c 'echo hello > /srv/file'
+    api POST "/${volume}/reset" > /dev/null
+    files=$(docker run --rm -v "${volume}:/srv" "${IMAGE}" ls /srv)
+
+    # checks
+    assertNotContains "Contents should be wiped" "${files}" "file"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testResetKeepsOptions() {
+    local volume status info
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB -o fs=ext4 -o sparse=true -o uid=123 -o gid=456 -o mode=750)
+    status=$(api POST "/${volume}/reset" | jq '.volume.status')
+    info=$(docker run --rm -v "${volume}:/vol" "${IMAGE}" ls -lan | grep vol)
+
+    # checks
+    assertEquals "Size should be kept" "104857600" "$(echo "${status}" | jq -r '.["size-max"]')"
+    assertEquals "Fs should be kept" "ext4" "$(echo "${status}" | jq -r '.fs')"
+    assertEquals "Sparse setting should be kept" "true" "$(echo "${status}" | jq -r '.sparse')"
+    assertEquals "Owner should be re-applied" "123 456" "$(echo "${info}" | awk '{print $3, $4}')"
+    assertEquals "Mode should be re-applied" "drwxr-x---" "$(echo "${info}" | awk '{print $1}')"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testResetReclaimsSparseSpace() {
+    local volume before after
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB -o sparse=true)
+    docker run --rm -v "${volume}:/srv" "${IMAGE}" dd if=/dev/urandom of=/srv/data bs=1M count=50 &> /dev/null
+    before=$(run stat -c '%b' "${DATA_DIR}/${volume}")
+    api POST "/${volume}/reset" > /dev/null
+    after=$(run stat -c '%b' "${DATA_DIR}/${volume}")
+
+    # checks
+    assertTrue "Sparse volume should give space back: ${before} -> ${after} blocks" "[ ${after} -lt ${before} ]"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testResetVolumeInUse() {
+    local volume container code
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+    container=$(docker run -d -v "${volume}:/srv" "${IMAGE}" sleep 60)
+    code=$(api POST "/${volume}/reset" | jq -r '.error.code')
+
+    # checks
+    assertEquals "Reset of volume in use should be rejected" "in-use" "${code}"
+
+    # cleanup
+    docker rm -f "${container}" > /dev/null
+    docker volume rm "${volume}" > /dev/null
+}
+
+. test.sh
@@ -0,0 +1,56 @@
+#!/usr/bin/env bash
+
+testExpiryReported() {
+    local volume info status_ttl status_expires_at
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB -o ttl=24h)
+
+    info=$(docker volume inspect "${volume}" | jq ".[0].Status")
+    status_ttl=$(echo "${info}" | jq -r '.ttl')
+    status_expires_at=$(echo "${info}" | jq -r '.["expires-at"]')
+
+    # checks
+    assertEquals "Reported TTL check" "24h0m0s" "${status_ttl}"
+    assertNotEquals "Reported expiry check" "null" "${status_expires_at}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testNoExpiryByDefault() {
+    local volume status_expires_at
+    # setup
+    volume=$(docker volume create -d "${DRIVER}" -o size=100MiB)
+
+    status_expires_at=$(docker volume inspect "${volume}" | jq -r '.[0].Status["expires-at"]')
+
+    # checks
+    assertEquals "Expiry should not be reported" "null" "${status_expires_at}"
+
+    # cleanup
+    docker volume rm "${volume}" > /dev/null
+}
+
+testWrongTtl() {
+    local error result
+    # setup
+    error=$(docker volume create -d "${DRIVER}" -o ttl=x 2>&1)
+    result=$?
+
+    # checks
+    assertEquals "Volume creation should fail" "1" "${result}"
+    assertContains "${error}" "cannot parse 'ttl' option value 'x' as duration"
+}
+
+testNegativeTtl() {
+    local error result
+    # setup
+    error=$(docker volume create -d "${DRIVER}" -o ttl=-1h 2>&1)
+    result=$?
+
+    # checks
+    assertEquals "Volume creation should fail" "1" "${result}"
+    assertContains "${error}" "'ttl' option should be positive but received '-1h'"
+}
+
+. test.sh
@@ -0,0 +1,122 @@
+package volumeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/go-connections/sockets"
+	"github.com/docker/go-plugins-helpers/sdk"
+	v "github.com/docker/go-plugins-helpers/volume"
+	"github.com/pkg/errors"
+)
+
+// Paths of Docker volume plugin protocol methods
+const (
+	ActivatePath     = "/Plugin.Activate"
+	CreatePath       = "/VolumeDriver.Create"
+	GetPath          = "/VolumeDriver.Get"
+	ListPath         = "/VolumeDriver.List"
+	RemovePath       = "/VolumeDriver.Remove"
+	PathPath         = "/VolumeDriver.Path"
+	MountPath        = "/VolumeDriver.Mount"
+	UnmountPath      = "/VolumeDriver.Unmount"
+	CapabilitiesPath = "/VolumeDriver.Capabilities"
+)
+
+const manifest = `{"Implements": ["VolumeDriver"]}`
+
+// NewHandler serves Docker volume plugin protocol the same way as go-plugins-helpers does. Unlike the handler from
+// go-plugins-helpers it's a plain http.Handler so that requests can be authorized before they reach the driver.
+func NewHandler(driver v.Driver) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(ActivatePath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", sdk.DefaultContentTypeV1_1)
+		fmt.Fprintln(w, manifest)
+	})
+	mux.HandleFunc(CreatePath, func(w http.ResponseWriter, r *http.Request) {
+		request := &v.CreateRequest{}
+		if sdk.DecodeRequest(w, r, request) == nil {
+			respond(w, struct{}{}, driver.Create(request))
+		}
+	})
+	mux.HandleFunc(RemovePath, func(w http.ResponseWriter, r *http.Request) {
+		request := &v.RemoveRequest{}
+		if sdk.DecodeRequest(w, r, request) == nil {
+			respond(w, struct{}{}, driver.Remove(request))
+		}
+	})
+	mux.HandleFunc(MountPath, func(w http.ResponseWriter, r *http.Request) {
+		request := &v.MountRequest{}
+		if sdk.DecodeRequest(w, r, request) == nil {
+			response, err := driver.Mount(request)
+			respond(w, response, err)
+		}
+	})
+	mux.HandleFunc(PathPath, func(w http.ResponseWriter, r *http.Request) {
+		request := &v.PathRequest{}
+		if sdk.DecodeRequest(w, r, request) == nil {
+			response, err := driver.Path(request)
+			respond(w, response, err)
+		}
+	})
+	mux.HandleFunc(GetPath, func(w http.ResponseWriter, r *http.Request) {
+		request := &v.GetRequest{}
+		if sdk.DecodeRequest(w, r, request) == nil {
+			response, err := driver.Get(request)
+			respond(w, response, err)
+		}
+	})
+	mux.HandleFunc(UnmountPath, func(w http.ResponseWriter, r *http.Request) {
+		request := &v.UnmountRequest{}
+		if sdk.DecodeRequest(w, r, request) == nil {
+			respond(w, struct{}{}, driver.Unmount(request))
+		}
+	})
+	mux.HandleFunc(ListPath, func(w http.ResponseWriter, r *http.Request) {
+		response, err := driver.List()
+		respond(w, response, err)
+	})
+	mux.HandleFunc(CapabilitiesPath, func(w http.ResponseWriter, r *http.Request) {
+		respond(w, driver.Capabilities(), nil)
+	})
+
+	return mux
+}
+
+func respond(w http.ResponseWriter, response interface{}, err error) {
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	sdk.EncodeResponse(w, response, false)
+}
+
+// WriteError responds with an error the way Docker expects plugins to report them
+func WriteError(w http.ResponseWriter, err error) {
+	sdk.EncodeResponse(w, v.NewErrorResponse(err.Error()), true)
+}
+
+// Forbidden responds to a call that the caller is not allowed to make
+func Forbidden(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", sdk.DefaultContentTypeV1_1)
+	w.WriteHeader(http.StatusForbidden)
+	_ = json.NewEncoder(w).Encode(v.NewErrorResponse(err.Error()))
+}
+
+// ListenUnix opens a UNIX socket accessible by root only, the same way as go-plugins-helpers does
+func ListenUnix(socket string) (listener net.Listener, err error) {
+	err = os.MkdirAll(filepath.Dir(socket), 0755)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create dir for socket '%s'", socket)
+	}
+	listener, err = sockets.NewUnixSocket(socket, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot listen on '%s'", socket)
+	}
+	return
+}